@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	"github.com/choestelus/super-duper-succotash/cmd/config"
+	"github.com/choestelus/super-duper-succotash/pkg/alert"
+	"github.com/choestelus/super-duper-succotash/pkg/notify"
+	"github.com/choestelus/super-duper-succotash/pkg/order"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// smtpTimeout bounds each mail so unresponsive SMTP server does not hold alert queue forever
+	smtpTimeout = 10 * time.Second
+	// alertQueue is number of alerts waiting for delivery before new ones are dropped
+	alertQueue = 64
+)
+
+// attachWatchers sets watcher of every alert rule matching engine and pair of each subscription,
+// subscriptions have their own watchers so state of rule is tracked per pair
+func attachWatchers(cfg config.Config, subs []*subscription) {
+	for _, sub := range subs {
+		for _, a := range cfg.Alerts {
+			if !a.Matches(sub.engineName, pairName(sub.engine)) {
+				continue
+			}
+			rule, err := alert.ParseRule(a.Name, a.Rule)
+			if err != nil {
+				logrus.Panic(err)
+			}
+			cooldown := cfg.AlertCooldown
+			if a.Cooldown != 0 {
+				cooldown = a.Cooldown
+			}
+			watcher, err := alert.NewWatcher(rule, pairName(sub.engine), cooldown)
+			if err != nil {
+				logrus.Panic(err)
+			}
+			sub.watchers = append(sub.watchers, watcher)
+		}
+	}
+}
+
+// mustAlertNotifier returns notifier sending to every --alert-notifiers in background,
+// so slow destination does not stall book loop of service mode
+func mustAlertNotifier(cfg config.Config) *notify.Async {
+	notifiers := notify.Multi{}
+	for _, name := range cfg.GetAlertNotifiers() {
+		switch name {
+		case "stdout":
+			notifiers = append(notifiers, notify.Stdout{Writer: os.Stdout})
+		case "webhook":
+			notifiers = append(notifiers, notify.NewWebhook(cfg.WebhookURL, webhookTimeout))
+		case "email":
+			notifiers = append(notifiers, notify.NewEmail(cfg.SMTPAddr, cfg.SMTPUsername, cfg.SMTPPassword, cfg.EmailFrom, cfg.GetEmailTo(), smtpTimeout))
+		default:
+			logrus.Panicf("unrecognized alert notifier: %v", name)
+		}
+	}
+	return notify.NewAsync(notifiers, alertQueue, func(err error) { logrus.Warn(err) })
+}
+
+// evaluateAlerts evaluates every watcher of subscription against book
+// and notifies alerts which are not deduplicated
+func evaluateAlerts(sub *subscription, book order.Book, notifier notify.Notifier) {
+	for _, watcher := range sub.watchers {
+		a, ok := watcher.Evaluate(book)
+		if !ok {
+			continue
+		}
+		logrus.WithFields(logrus.Fields{"rule": a.Rule, "pair": a.Pair}).Warnf("alert %v\t%v, value [%v]", a.State, a.Expression, a.Value.StringFixed(8))
+		deliver(notifier, notify.Event{Kind: "alert", Subject: a.Subject(), Payload: a, Time: a.At})
+	}
+}
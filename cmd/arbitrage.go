@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/choestelus/super-duper-succotash/cmd/config"
+	"github.com/choestelus/super-duper-succotash/pkg/arbitrage"
+	"github.com/choestelus/super-duper-succotash/pkg/notify"
+	"github.com/choestelus/super-duper-succotash/pkg/order"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+// webhookTimeout bounds each webhook call so slow receiver does not stall detection
+const webhookTimeout = 5 * time.Second
+
+// venueUpdate is order book received from venue, or from leg pair in triangle mode
+type venueUpdate struct {
+	venue string
+	book  order.Book
+}
+
+// WatchArbitrage streams order book of every venue and alerts when best bid of
+// one venue exceeds best ask of another by more than fees plus --arb-threshold-bps
+func WatchArbitrage(cfg config.Config) {
+	detector := arbitrage.NewDetector(
+		strings.ToUpper(cfg.Venues[0].Pair),
+		decimal.RequireFromString(cfg.ArbThresholdBps),
+		decimal.RequireFromString(cfg.ArbFeeBps),
+	)
+	detector.MaxBookAge = cfg.ArbMaxBookAge
+
+	notifier := newNotifier(cfg)
+
+	updates := make(chan venueUpdate)
+	for _, v := range cfg.Venues {
+		if v.FeeBps != "" {
+			detector.FeeBps[v.Name] = decimal.RequireFromString(v.FeeBps)
+		}
+		engineConfig := cfg.EngineConfigForVenue(v)
+		engine := AvailableEngines[v.Engine].Configure(engineConfig)
+		go func(name string) {
+			for book := range engine.OpenStream(engineConfig) {
+				updates <- venueUpdate{venue: name, book: book}
+			}
+		}(v.Name)
+	}
+
+	for update := range updates {
+		for _, op := range detector.Update(update.venue, update.book) {
+			ReportOpportunity(op)
+			deliver(notifier, notify.Event{
+				Kind:    "arbitrage",
+				Subject: fmt.Sprintf("buy %v on %v, sell on %v", op.Pair, op.BuyVenue, op.SellVenue),
+				Payload: op,
+				Time:    op.DetectedAt,
+			})
+		}
+	}
+}
+
+// WatchTriangles streams order book of every leg of triangles on --engine, and alerts
+// when round trip return after fees exceeds --arb-threshold-bps
+func WatchTriangles(cfg config.Config) {
+	triangles := []arbitrage.Triangle{}
+	for _, t := range cfg.Triangles {
+		triangle, err := t.Resolve()
+		if err != nil {
+			logrus.Panic(err)
+		}
+		triangles = append(triangles, triangle)
+	}
+	scanner := arbitrage.NewTriangleScanner(
+		triangles,
+		decimal.RequireFromString(cfg.ArbThresholdBps),
+		decimal.RequireFromString(cfg.ArbFeeBps),
+	)
+	scanner.MaxBookAge = cfg.ArbMaxBookAge
+	notifier := newNotifier(cfg)
+
+	updates := make(chan venueUpdate)
+	for _, pair := range scanner.Pairs() {
+		engineConfig := cfg.EngineConfigFor(cfg.Engine, pair)
+		engine := AvailableEngines[cfg.Engine].Configure(engineConfig)
+		go func(pair string) {
+			for book := range engine.OpenStream(engineConfig) {
+				updates <- venueUpdate{venue: pair, book: book}
+			}
+		}(pair)
+	}
+
+	for update := range updates {
+		for _, trip := range scanner.Update(update.venue, update.book) {
+			ReportRoundTrip(trip)
+			deliver(notifier, notify.Event{
+				Kind:    "triangle",
+				Subject: fmt.Sprintf("round trip %v of %v %v", trip.Triangle, trip.Size.StringFixed(8), trip.Start),
+				Payload: trip,
+				Time:    trip.DetectedAt,
+			})
+		}
+	}
+}
+
+// newNotifier returns webhook notifier when --webhook-url is supplied, otherwise nil
+func newNotifier(cfg config.Config) notify.Notifier {
+	if cfg.WebhookURL == "" {
+		return nil
+	}
+	return notify.NewWebhook(cfg.WebhookURL, webhookTimeout)
+}
+
+// deliver sends event to notifier when set, failure is only logged
+// so detection keeps running while receiver is down
+func deliver(notifier notify.Notifier, event notify.Event) {
+	if notifier == nil {
+		return
+	}
+	if err := notifier.Notify(event); err != nil {
+		logrus.Warn(err)
+	}
+}
+
+// ReportOpportunity prints arbitrage opportunity tagged with pair and venues
+func ReportOpportunity(op arbitrage.Opportunity) {
+	log := logrus.WithFields(logrus.Fields{"pair": op.Pair, "buy": op.BuyVenue, "sell": op.SellVenue})
+	log.Infof("---------------------%v---------------------------------------------", op.DetectedAt.UTC())
+	log.Infof("best ask / best bid    \t[%v] / [%v]", op.BestAsk.StringFixed(8), op.BestBid.StringFixed(8))
+	log.Infof("edge after fees        \t[%v] bps", op.EdgeBps.StringFixed(2))
+	log.Infof("size                   \t[%v]", op.Size.StringFixed(8))
+	log.Infof("cost / proceeds        \t[%v] / [%v]", op.Cost.StringFixed(8), op.Proceeds.StringFixed(8))
+	log.Infof("profit after fees      \t[%v]", op.Profit.StringFixed(8))
+}
+
+// ReportRoundTrip prints triangle round trip and fill of each leg tagged with triangle name
+func ReportRoundTrip(trip arbitrage.RoundTrip) {
+	log := logrus.WithField("triangle", trip.Triangle)
+	log.Infof("---------------------%v---------------------------------------------", trip.DetectedAt.UTC())
+	for _, leg := range trip.Legs {
+		log.Infof("%-23v\t[%v] %v -> [%v] %v @ [%v]", leg.Pair, leg.Input.StringFixed(8), leg.From, leg.Output.StringFixed(8), leg.To, leg.AvgPrice.StringFixed(8))
+	}
+	log.Infof("executable size        \t[%v] %v", trip.Size.StringFixed(8), trip.Start)
+	log.Infof("round trip output      \t[%v] %v", trip.Output.StringFixed(8), trip.Start)
+	log.Infof("return after fees      \t[%v] bps", trip.ReturnBps.StringFixed(2))
+}
@@ -1,32 +1,606 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/choestelus/super-duper-succotash/pkg/alert"
+	"github.com/choestelus/super-duper-succotash/pkg/arbitrage"
+	"github.com/choestelus/super-duper-succotash/pkg/engine/coinbase"
+	"github.com/choestelus/super-duper-succotash/pkg/execution"
+	"github.com/choestelus/super-duper-succotash/pkg/order"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/go-ozzo/ozzo-validation/is"
 	"github.com/jessevdk/go-flags"
+	"github.com/shopspring/decimal"
 )
 
+// EnvPrefix is prefix of every environment variable read as configuration
+const EnvPrefix = "SUCCOTASH_"
+
+// engineEnvPrefix is prefix of environment variables read as engine configuration
+// e.g. SUCCOTASH_ENGINE_CONFIG_POLL_INTERVAL=5s sets poll_interval:5s
+const engineEnvPrefix = EnvPrefix + "ENGINE_CONFIG_"
+
+// Config holds application configuration, values are resolved with precedence
+// flags > environment variables > config file > defaults
 type Config struct {
-	Amount       string            `short:"a" long:"amount" required:"true" description:"input amount to calculate"`
-	InputAsset   string            `short:"i" long:"input-asset" required:"true" description:"input asset type, output asset type will be automatically set via pair config according to exchange engine, if available"`
-	OutputAsset  string            `short:"o" long:"output-asset" required:"false" description:"output asset type, can be set if engine support exchange routing with more than 1 pair"`
-	Mode         string            `short:"m" long:"mode" required:"true" choice:"oneshot" choice:"service" description:"select wheter to run as oneshot or until manually stop"`
-	Engine       string            `short:"E" long:"engine" required:"true" choice:"coinbase_pro" description:"select exchange engine to use"`
-	EngineConfig map[string]string `short:"e" long:"engine-config" required:"true" description:"configuration for exchange engine, in key:value format, one pair per each flag"`
+	ConfigFile   string            `short:"c" long:"config" env:"SUCCOTASH_CONFIG" description:"path to YAML or TOML configuration file"`
+	Amount       string            `short:"a" long:"amount" env:"SUCCOTASH_AMOUNT" description:"input amount to calculate, required when no jobs or ladder are configured"`
+	Ladder       string            `short:"l" long:"ladder" env:"SUCCOTASH_LADDER" description:"amount ladder to calculate price impact curve, either comma-separated amounts e.g. 1,10,100 or start:stop:step range"`
+	InputAsset   string            `short:"i" long:"input-asset" env:"SUCCOTASH_INPUT_ASSET" description:"input asset type, output asset type will be automatically set via pair config according to exchange engine, if available"`
+	OutputAsset  string            `short:"o" long:"output-asset" env:"SUCCOTASH_OUTPUT_ASSET" required:"false" description:"output asset type, can be set if engine support exchange routing with more than 1 pair"`
+	Mode         string            `short:"m" long:"mode" env:"SUCCOTASH_MODE" required:"true" choice:"oneshot" choice:"service" choice:"query" choice:"candles" choice:"schedule" choice:"arbitrage" choice:"triangle" choice:"tui" description:"select wheter to run as oneshot or until manually stop, query stored quote, export historical candles, execute amount over time, watch venues for arbitrage, scan triangles within engine, or show live depth ladder"`
+	Engine       string            `short:"E" long:"engine" env:"SUCCOTASH_ENGINE" required:"true" choice:"coinbase_pro" description:"select exchange engine to use"`
+	EngineConfig map[string]string `short:"e" long:"engine-config" description:"configuration for exchange engine, in key:value format, one pair per each flag"`
+
+	LimitPrice     string `long:"limit-price" env:"SUCCOTASH_LIMIT_PRICE" description:"stop matching at this price, as IOC limit order would"`
+	MaxSlippageBps string `long:"max-slippage-bps" env:"SUCCOTASH_MAX_SLIPPAGE_BPS" description:"stop matching at this many basis points away from reference price, cannot be used with --limit-price"`
+	SlippageFrom   string `long:"slippage-from" env:"SUCCOTASH_SLIPPAGE_FROM" choice:"best" choice:"mid" default:"best" description:"reference price of --max-slippage-bps"`
+	FixedPoint     bool   `long:"fixed-point" env:"SUCCOTASH_FIXED_POINT" description:"match jobs on fixed-point copy of order book, base bought with quote is rounded down to book size precision"`
+
+	CandleIntervals string        `long:"candle-intervals" env:"SUCCOTASH_CANDLE_INTERVALS" description:"comma-separated candle intervals to build from trades in service mode, e.g. 1s,1m,5m,1h, requires ws_url engine configuration"`
+	CandleLateness  time.Duration `long:"candle-lateness" env:"SUCCOTASH_CANDLE_LATENESS" default:"5s" description:"how long to wait for late trades before emitting candle"`
+	CandleBackfill  time.Duration `long:"candle-backfill" env:"SUCCOTASH_CANDLE_BACKFILL" default:"1h" description:"how far back to backfill candles from exchange on startup, 0 to disable"`
+	StatsInterval   time.Duration `long:"stats-interval" env:"SUCCOTASH_STATS_INTERVAL" default:"1m" description:"how often to report HTTP request and rate limit counters of engines in service mode, 0 to disable"`
+
+	StorageDriver string        `long:"storage-driver" env:"SUCCOTASH_STORAGE_DRIVER" choice:"sqlite3" choice:"postgres" default:"sqlite3" description:"database driver to store order books and quotes with"`
+	StorageDSN    string        `long:"storage-dsn" env:"SUCCOTASH_STORAGE_DSN" description:"database data source name, storage is disabled when empty"`
+	StorageDepth  int           `long:"storage-depth" env:"SUCCOTASH_STORAGE_DEPTH" default:"10" description:"number of top levels per side to store for each order book"`
+	StorageBatch  int           `long:"storage-batch" env:"SUCCOTASH_STORAGE_BATCH" default:"100" description:"number of records to buffer before writing to database"`
+	StorageFlush  time.Duration `long:"storage-flush-interval" env:"SUCCOTASH_STORAGE_FLUSH_INTERVAL" default:"30s" description:"write buffered records at least this often even when batch is not full, 0 to disable"`
+	AsOf          string        `long:"as-of" env:"SUCCOTASH_AS_OF" description:"RFC3339 timestamp to query quote as of, used in query mode"`
+	QueryJob      string        `long:"query-job" env:"SUCCOTASH_QUERY_JOB" description:"name of job to query quote of in query mode, quote of any job when empty"`
+
+	From        string        `long:"from" env:"SUCCOTASH_FROM" description:"RFC3339 start of candles range, used in candles mode"`
+	To          string        `long:"to" env:"SUCCOTASH_TO" description:"RFC3339 end of candles range, default to now, used in candles mode"`
+	Granularity time.Duration `long:"granularity" env:"SUCCOTASH_GRANULARITY" default:"1m" description:"candle interval to fetch, used in candles mode"`
+	Output      string        `long:"output" env:"SUCCOTASH_OUTPUT" description:"output file of candles mode, either .csv or .parquet, write csv to stdout when empty"`
+
+	Execute bool `long:"execute" env:"SUCCOTASH_EXECUTE" description:"place order for each quoted amount after quoting in oneshot mode, as limit IOC order when job is limited, otherwise market order"`
+	DryRun  bool `long:"dry-run" env:"SUCCOTASH_DRY_RUN" description:"log orders that would be placed by --execute without placing them"`
+
+	PaperState    string `long:"paper-state" env:"SUCCOTASH_PAPER_STATE" description:"execute against paper trading account persisted at this JSON file instead of exchange, allows --execute in service mode"`
+	PaperBalances string `long:"paper-balances" env:"SUCCOTASH_PAPER_BALANCES" description:"initial balances of new paper trading account, e.g. usd:10000,btc:1"`
+	PaperFee      string `long:"paper-fee" env:"SUCCOTASH_PAPER_FEE" default:"bps:50" description:"fee model of paper trading account, bps:<n> of filled value, fixed:<n> per fill or zero, combined with +"`
+
+	Schedule          string        `long:"schedule" env:"SUCCOTASH_SCHEDULE" choice:"twap" choice:"vwap" default:"twap" description:"how schedule mode slices amount, evenly or weighted by historical volume of time of day"`
+	ScheduleWindow    time.Duration `long:"schedule-window" env:"SUCCOTASH_SCHEDULE_WINDOW" default:"1h" description:"time window to execute amount over in schedule mode"`
+	ScheduleSlices    int           `long:"schedule-slices" env:"SUCCOTASH_SCHEDULE_SLICES" default:"12" description:"number of child orders in schedule mode"`
+	ParticipationRate string        `long:"participation-rate" env:"SUCCOTASH_PARTICIPATION_RATE" description:"cap each child order to this fraction of market volume traded since previous child, e.g. 0.1, requires ws_url engine configuration"`
+	VWAPLookback      time.Duration `long:"vwap-lookback" env:"SUCCOTASH_VWAP_LOOKBACK" default:"168h" description:"how far back to build volume profile of vwap schedule from"`
+
+	TUIDepth int `long:"tui-depth" env:"SUCCOTASH_TUI_DEPTH" default:"10" description:"number of levels of each side shown in tui mode"`
+
+	ArbThresholdBps string        `long:"arb-threshold-bps" env:"SUCCOTASH_ARB_THRESHOLD_BPS" default:"0" description:"minimum edge or round trip return after fees to alert in arbitrage and triangle mode, in basis points"`
+	ArbFeeBps       string        `long:"arb-fee-bps" env:"SUCCOTASH_ARB_FEE_BPS" default:"50" description:"taker fee of venues without fee_bps in arbitrage mode, and of every leg in triangle mode, in basis points"`
+	ArbMaxBookAge   time.Duration `long:"arb-max-book-age" env:"SUCCOTASH_ARB_MAX_BOOK_AGE" default:"10s" description:"ignore books older than the newest book by more than this in arbitrage and triangle mode, 0 to disable"`
+	WebhookURL      string        `long:"webhook-url" env:"SUCCOTASH_WEBHOOK_URL" description:"post alerts as JSON to this URL"`
+
+	AlertNotifiers string        `long:"alert-notifiers" env:"SUCCOTASH_ALERT_NOTIFIERS" default:"stdout" description:"comma-separated notifiers of alert rules in service mode, any of stdout, webhook and email"`
+	AlertCooldown  time.Duration `long:"alert-cooldown" env:"SUCCOTASH_ALERT_COOLDOWN" default:"5m" description:"minimum time between notifications of the same alert rule, unless overridden by rule cooldown"`
+	SMTPAddr       string        `long:"smtp-addr" env:"SUCCOTASH_SMTP_ADDR" description:"host:port of SMTP server of email notifier"`
+	SMTPUsername   string        `long:"smtp-username" env:"SUCCOTASH_SMTP_USERNAME" description:"username of SMTP server, no authentication when empty"`
+	SMTPPassword   string        `long:"smtp-password" env:"SUCCOTASH_SMTP_PASSWORD" description:"password of SMTP server"`
+	EmailFrom      string        `long:"email-from" env:"SUCCOTASH_EMAIL_FROM" description:"sender address of email notifier"`
+	EmailTo        string        `long:"email-to" env:"SUCCOTASH_EMAIL_TO" description:"comma-separated recipient addresses of email notifier"`
+
+	// Jobs, Venues, Triangles, Alerts and Engines can only be declared in config file
+	Jobs      []Job                        `no-flag:"true"`
+	Venues    []Venue                      `no-flag:"true"`
+	Triangles []Triangle                   `no-flag:"true"`
+	Alerts    []AlertRule                  `no-flag:"true"`
+	Engines   map[string]map[string]string `no-flag:"true"`
+}
+
+// Venue is order book source watched by arbitrage mode, venues of the same engine
+// can point to different deployments by overriding engine configuration
+type Venue struct {
+	Name         string            `mapstructure:"name"`
+	Engine       string            `mapstructure:"engine"`
+	Pair         string            `mapstructure:"pair"`
+	FeeBps       string            `mapstructure:"fee_bps"`
+	EngineConfig map[string]string `mapstructure:"engine_config"`
+}
+
+// Validate checks venue fields
+func (v Venue) Validate() error {
+	return validation.ValidateStruct(&v,
+		validation.Field(&v.Name, validation.Required),
+		validation.Field(&v.Engine, validation.Required, validation.In("coinbase_pro")),
+		validation.Field(&v.Pair, validation.Required),
+		validation.Field(&v.FeeBps, validation.By(validateDecimal)),
+		validation.Field(&v.EngineConfig, validation.By(validateEngineConfig(v.Engine))),
+	)
+}
+
+// Triangle is round trip scanned by triangle mode, starting with Amount of StartAsset
+// through Pairs of --engine in order, back to StartAsset
+type Triangle struct {
+	Name       string   `mapstructure:"name"`
+	StartAsset string   `mapstructure:"start_asset"`
+	Amount     string   `mapstructure:"amount"`
+	Pairs      []string `mapstructure:"pairs"`
+}
+
+// Validate checks triangle fields and that pairs form round trip
+func (t Triangle) Validate() error {
+	err := validation.ValidateStruct(&t,
+		validation.Field(&t.Name, validation.Required),
+		validation.Field(&t.StartAsset, validation.Required),
+		validation.Field(&t.Amount, validation.Required, validation.By(validateDecimal)),
+		validation.Field(&t.Pairs, validation.Required),
+	)
+	if err != nil {
+		return err
+	}
+	_, err = t.Resolve()
+	return err
+}
+
+// Resolve returns legs of triangle
+func (t Triangle) Resolve() (arbitrage.Triangle, error) {
+	amount, err := decimal.NewFromString(t.Amount)
+	if err != nil {
+		return arbitrage.Triangle{}, err
+	}
+	return arbitrage.NewTriangle(t.Name, t.StartAsset, amount, t.Pairs)
+}
+
+// AlertRule is rule evaluated on every book update in service mode, of subscriptions
+// matching Engine and Pair, or every subscription when they are empty
+type AlertRule struct {
+	Name     string        `mapstructure:"name"`
+	Rule     string        `mapstructure:"rule"`
+	Engine   string        `mapstructure:"engine"`
+	Pair     string        `mapstructure:"pair"`
+	Cooldown time.Duration `mapstructure:"cooldown"`
+}
+
+// Validate checks alert rule fields and rule expression
+func (a AlertRule) Validate() error {
+	return validation.ValidateStruct(&a,
+		validation.Field(&a.Name, validation.Required),
+		validation.Field(&a.Rule, validation.Required, validation.By(func(value interface{}) error {
+			_, err := alert.ParseRule(a.Name, a.Rule)
+			return err
+		})),
+		validation.Field(&a.Engine, validation.In("coinbase_pro")),
+	)
+}
+
+// Matches reports whether rule applies to subscription of engine and pair
+func (a AlertRule) Matches(engine, pair string) bool {
+	return (a.Engine == "" || a.Engine == engine) && (a.Pair == "" || strings.EqualFold(a.Pair, pair))
+}
+
+// Job describes single quoting target, jobs with same engine and pair
+// share one order book subscription
+type Job struct {
+	Name       string   `mapstructure:"name"`
+	Engine     string   `mapstructure:"engine"`
+	Pair       string   `mapstructure:"pair"`
+	InputAsset string   `mapstructure:"input_asset"`
+	Amounts    []string `mapstructure:"amounts"`
+	Ladder     string   `mapstructure:"ladder"`
+
+	LimitPrice     string `mapstructure:"limit_price"`
+	MaxSlippageBps string `mapstructure:"max_slippage_bps"`
+	SlippageFrom   string `mapstructure:"slippage_from"`
+}
+
+// Validate checks job fields
+func (j Job) Validate() error {
+	var amountsRequired validation.Rule = validation.Skip
+	if j.Ladder == "" {
+		amountsRequired = validation.Required
+	}
+	return validation.ValidateStruct(&j,
+		validation.Field(&j.Engine, validation.Required, validation.In("coinbase_pro")),
+		validation.Field(&j.Pair, validation.Required),
+		validation.Field(&j.InputAsset, validation.Required),
+		validation.Field(&j.Amounts, amountsRequired),
+		validation.Field(&j.Ladder, validation.By(validateLadder)),
+		validation.Field(&j.LimitPrice, validation.By(validateDecimal)),
+		validation.Field(&j.MaxSlippageBps, validation.By(validateDecimal), validation.By(exclusiveWith("limit_price", j.LimitPrice))),
+		validation.Field(&j.SlippageFrom, validation.In("best", "mid")),
+	)
+}
+
+// validateLadder checks ladder notation, empty ladder is valid
+func validateLadder(value interface{}) error {
+	ladder, _ := value.(string)
+	if ladder == "" {
+		return nil
+	}
+	_, err := order.ParseLadder(ladder)
+	return err
+}
+
+// GetAlertNotifiers returns notifiers of alert rules
+func (cfg Config) GetAlertNotifiers() []string {
+	return splitList(cfg.AlertNotifiers)
+}
+
+// GetEmailTo returns recipients of email notifier
+func (cfg Config) GetEmailTo() []string {
+	return splitList(cfg.EmailTo)
+}
+
+// splitList splits comma-separated list, ignoring empty items
+func splitList(list string) []string {
+	items := []string{}
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// GetCandleIntervals returns parsed candle intervals, empty when not configured
+func (cfg Config) GetCandleIntervals() ([]time.Duration, error) {
+	intervals := []time.Duration{}
+	if cfg.CandleIntervals == "" {
+		return intervals, nil
+	}
+	for _, field := range strings.Split(cfg.CandleIntervals, ",") {
+		interval, err := time.ParseDuration(strings.TrimSpace(field))
+		if err != nil {
+			return nil, err
+		}
+		if interval <= 0 {
+			return nil, fmt.Errorf("interval must be positive, got %v", interval)
+		}
+		intervals = append(intervals, interval)
+	}
+	return intervals, nil
+}
+
+// validateIntervals checks candle intervals notation, empty value is valid
+func validateIntervals(value interface{}) error {
+	intervals, _ := value.(string)
+	_, err := Config{CandleIntervals: intervals}.GetCandleIntervals()
+	return err
+}
+
+// validateDecimal checks that value is decimal, empty value is valid
+func validateDecimal(value interface{}) error {
+	str, _ := value.(string)
+	if str == "" {
+		return nil
+	}
+	_, err := decimal.NewFromString(str)
+	return err
+}
+
+// exclusiveWith returns rule rejecting non-empty value when other field is also set
+func exclusiveWith(otherName, other string) validation.RuleFunc {
+	return func(value interface{}) error {
+		str, _ := value.(string)
+		if str != "" && other != "" {
+			return fmt.Errorf("cannot be used with %v", otherName)
+		}
+		return nil
+	}
+}
+
+// EngineConfigFor returns engine configuration for supplied engine and pair
+// configuration of selected engine has environment variables and flags applied
+func (cfg Config) EngineConfigFor(engine, pair string) map[string]string {
+	base := cfg.Engines[engine]
+	if engine == cfg.Engine {
+		base = cfg.EngineConfig
+	}
+	engineConfig := map[string]string{}
+	for k, v := range base {
+		engineConfig[k] = v
+	}
+	engineConfig["pair"] = pair
+	return engineConfig
+}
+
+// EngineConfigForVenue returns engine configuration of venue, which is
+// configuration of its engine and pair overridden by venue engine_config
+func (cfg Config) EngineConfigForVenue(v Venue) map[string]string {
+	engineConfig := cfg.EngineConfigFor(v.Engine, v.Pair)
+	for k, val := range v.EngineConfig {
+		engineConfig[k] = val
+	}
+	return engineConfig
+}
+
+// GetJobs returns configured jobs, or single job built from flags
+// when no jobs are configured. Unnamed jobs are named after engine, pair and input asset
+func (cfg Config) GetJobs() []Job {
+	jobs := cfg.Jobs
+	if len(jobs) == 0 {
+		jobs = []Job{{
+			Engine:     cfg.Engine,
+			Pair:       cfg.EngineConfig["pair"],
+			InputAsset: cfg.InputAsset,
+			Ladder:     cfg.Ladder,
+
+			LimitPrice:     cfg.LimitPrice,
+			MaxSlippageBps: cfg.MaxSlippageBps,
+			SlippageFrom:   cfg.SlippageFrom,
+		}}
+		if cfg.Amount != "" {
+			jobs[0].Amounts = []string{cfg.Amount}
+		}
+	}
+
+	named := make([]Job, 0, len(jobs))
+	for _, job := range jobs {
+		if job.Name == "" {
+			job.Name = fmt.Sprintf("%v/%v/%v", job.Engine, job.Pair, strings.ToLower(job.InputAsset))
+		}
+		named = append(named, job)
+	}
+	return named
+}
+
+// Validate checks values that go-flags does not verify
+// when they are supplied from environment variables or config file
+func (cfg Config) Validate() error {
+	// candles, arbitrage and triangle modes do not quote amount of flags or jobs
+	quoting := cfg.Mode != "candles" && cfg.Mode != "arbitrage" && cfg.Mode != "triangle"
+	var venuesRequired, venuesLength validation.Rule = validation.Skip, validation.Skip
+	if cfg.Mode == "arbitrage" {
+		venuesRequired, venuesLength = validation.Required, validation.Length(2, 0)
+	}
+	// notifiers are only used when alert rules are configured
+	var webhookRequired, emailRequired validation.Rule = validation.Skip, validation.Skip
+	if len(cfg.Alerts) > 0 {
+		for _, notifier := range cfg.GetAlertNotifiers() {
+			switch notifier {
+			case "webhook":
+				webhookRequired = validation.Required
+			case "email":
+				emailRequired = validation.Required
+			}
+		}
+	}
+	var trianglesRequired validation.Rule = validation.Skip
+	if cfg.Mode == "triangle" {
+		trianglesRequired = validation.Required
+	}
+	// schedule mode executes single amount supplied by flags
+	var scheduling, slippageRule validation.Rule = validation.Skip, validation.Skip
+	if cfg.Mode == "schedule" {
+		scheduling = validation.Required
+		slippageRule = validation.By(exclusiveWith("schedule mode, use limit_price instead", cfg.Mode))
+	}
+	var requiredWithoutJobs validation.Rule = validation.Skip
+	if len(cfg.Jobs) == 0 && quoting {
+		requiredWithoutJobs = validation.Required
+	}
+	var amountRequired validation.Rule = validation.Skip
+	if len(cfg.Jobs) == 0 && cfg.Ladder == "" && quoting {
+		amountRequired = validation.Required
+	}
+	var fromRequired validation.Rule = validation.Skip
+	if cfg.Mode == "candles" {
+		fromRequired = validation.Required
+	}
+	return validation.ValidateStruct(&cfg,
+		validation.Field(&cfg.Amount, amountRequired, scheduling),
+		validation.Field(&cfg.Ladder, validation.By(validateLadder)),
+		validation.Field(&cfg.LimitPrice, validation.By(validateDecimal)),
+		validation.Field(&cfg.MaxSlippageBps, validation.By(validateDecimal), validation.By(exclusiveWith("limit_price", cfg.LimitPrice)), slippageRule),
+		validation.Field(&cfg.SlippageFrom, validation.In("best", "mid")),
+		validation.Field(&cfg.CandleIntervals, validation.By(validateIntervals)),
+		validation.Field(&cfg.InputAsset, requiredWithoutJobs, scheduling),
+		validation.Field(&cfg.Mode, validation.Required, validation.In("oneshot", "service", "query", "candles", "schedule", "arbitrage", "triangle", "tui")),
+		validation.Field(&cfg.Engine, validation.Required, validation.In("coinbase_pro")),
+		validation.Field(&cfg.EngineConfig, requiredWithoutJobs, validation.By(validateEngineConfig(cfg.Engine))),
+		validation.Field(&cfg.Engines, validation.By(validateEngines)),
+		validation.Field(&cfg.From, fromRequired, validation.Date(time.RFC3339)),
+		validation.Field(&cfg.To, validation.Date(time.RFC3339)),
+		validation.Field(&cfg.StorageDriver, validation.In("sqlite3", "postgres")),
+		validation.Field(&cfg.Execute, validation.By(executableIn(cfg.Mode, cfg.PaperState))),
+		validation.Field(&cfg.Schedule, validation.In("twap", "vwap")),
+		validation.Field(&cfg.ScheduleWindow, validation.Required, validation.Min(time.Second)),
+		validation.Field(&cfg.ScheduleSlices, validation.Required, validation.Min(1)),
+		validation.Field(&cfg.ParticipationRate, validation.By(validateDecimal)),
+		validation.Field(&cfg.PaperBalances, validation.By(validateBalances)),
+		validation.Field(&cfg.PaperFee, validation.By(validateFeeModel)),
+		validation.Field(&cfg.TUIDepth, validation.Required, validation.Min(1)),
+		validation.Field(&cfg.ArbThresholdBps, validation.By(validateDecimal)),
+		validation.Field(&cfg.ArbFeeBps, validation.By(validateDecimal)),
+		validation.Field(&cfg.WebhookURL, is.URL, webhookRequired),
+		validation.Field(&cfg.AlertNotifiers, validation.By(validateNotifiers)),
+		validation.Field(&cfg.SMTPAddr, emailRequired),
+		validation.Field(&cfg.EmailFrom, is.Email, emailRequired),
+		validation.Field(&cfg.EmailTo, emailRequired),
+		validation.Field(&cfg.Jobs),
+		validation.Field(&cfg.Venues, venuesRequired, venuesLength, validation.By(samePair)),
+		validation.Field(&cfg.Triangles, trianglesRequired),
+		validation.Field(&cfg.Alerts),
+	)
+}
+
+// engineParsers parses configuration of every supported engine, so malformed
+// engine configuration is reported before engine is configured
+var engineParsers = map[string]func(engineConfig map[string]string) error{
+	"coinbase_pro": func(engineConfig map[string]string) error {
+		_, err := coinbase.ParseConfig(engineConfig)
+		return err
+	},
+}
+
+// validateEngineConfig checks configuration of engine, unsupported engine
+// is reported by validation of engine field itself
+func validateEngineConfig(engine string) validation.RuleFunc {
+	return func(value interface{}) error {
+		engineConfig, _ := value.(map[string]string)
+		parse, ok := engineParsers[engine]
+		if !ok {
+			return nil
+		}
+		return parse(engineConfig)
+	}
+}
+
+// validateEngines checks every section of engines in config file, keyed by engine name
+func validateEngines(value interface{}) error {
+	engines, _ := value.(map[string]map[string]string)
+	names := []string{}
+	for name := range engines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		parse, ok := engineParsers[name]
+		if !ok {
+			return fmt.Errorf("unsupported engine [%v]", name)
+		}
+		if err := parse(engines[name]); err != nil {
+			return fmt.Errorf("[%v] %v", name, err)
+		}
+	}
+	return nil
+}
+
+// validateNotifiers checks every notifier of comma-separated list
+func validateNotifiers(value interface{}) error {
+	str, _ := value.(string)
+	for _, notifier := range splitList(str) {
+		if err := validation.In("stdout", "webhook", "email").Validate(notifier); err != nil {
+			return fmt.Errorf("unknown notifier %v", notifier)
+		}
+	}
+	return nil
+}
+
+// samePair checks that every venue watches the same pair
+func samePair(value interface{}) error {
+	venues, _ := value.([]Venue)
+	for _, v := range venues {
+		if !strings.EqualFold(v.Pair, venues[0].Pair) {
+			return fmt.Errorf("every venue must watch the same pair, got %v and %v", venues[0].Pair, v.Pair)
+		}
+	}
+	return nil
 }
 
+// executableIn rejects execution outside oneshot mode, except
+// paper trading which can also be used in service mode
+func executableIn(mode, paperState string) validation.RuleFunc {
+	return func(value interface{}) error {
+		enabled, _ := value.(bool)
+		if !enabled || mode == "oneshot" || mode == "schedule" || (mode == "service" && paperState != "") {
+			return nil
+		}
+		return fmt.Errorf("can only be used in oneshot mode, or service mode with --paper-state")
+	}
+}
+
+// validateBalances checks paper trading balances notation, empty value is valid
+func validateBalances(value interface{}) error {
+	str, _ := value.(string)
+	_, err := execution.ParseBalances(str)
+	return err
+}
+
+// validateFeeModel checks paper trading fee model notation
+func validateFeeModel(value interface{}) error {
+	str, _ := value.(string)
+	_, err := execution.ParseFeeModel(str)
+	return err
+}
+
+// MustParseConfig parses configuration from flags, environment variables and config file
+// exit when failed to parse.
 func MustParseConfig() Config {
-	cfg := Config{}
+	cfg, err := ParseConfig(os.Args[1:])
+	if err != nil {
+		flagsErr, ok := err.(*flags.Error)
+		if ok && flagsErr.Type == flags.ErrHelp {
+			os.Exit(0)
+		}
+		// flags error is already printed by parser
+		if !ok {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(1)
+	}
+	return cfg
+}
 
+// ParseConfig parses configuration from supplied args, environment variables and config file
+func ParseConfig(args []string) (Config, error) {
+	cfg := Config{}
 	parser := flags.NewParser(&cfg, flags.Default)
-	_, err := parser.Parse()
+
+	file, err := loadFile(findConfigFile(args))
 	if err != nil {
-		if flagsErr, ok := err.(*flags.Error); ok && flagsErr.Type == flags.ErrHelp {
-			os.Exit(0)
-		} else {
+		return cfg, err
+	}
+	// values from file are used as option defaults, go-flags will then
+	// let environment variables and flags take precedence over them
+	if err := file.applyDefaults(parser); err != nil {
+		return cfg, err
+	}
+
+	if _, err := parser.ParseArgs(args); err != nil {
+		if flagsErr, ok := err.(*flags.Error); !ok || flagsErr.Type != flags.ErrHelp {
 			parser.WriteHelp(os.Stderr)
-			os.Exit(1)
 		}
+		return cfg, err
 	}
-	return cfg
+
+	engineConfig := map[string]string{}
+	for k, v := range file.engines[cfg.Engine] {
+		engineConfig[k] = v
+	}
+	for k, v := range engineConfigFromEnv(os.Environ()) {
+		engineConfig[k] = v
+	}
+	for k, v := range cfg.EngineConfig {
+		engineConfig[k] = v
+	}
+	cfg.EngineConfig = engineConfig
+	cfg.Engines = file.engines
+	cfg.Jobs = file.jobs
+	cfg.Venues = file.venues
+	cfg.Triangles = file.triangles
+	cfg.Alerts = file.alerts
+
+	if err := cfg.Validate(); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// findConfigFile looks up config file path from args, then environment variable
+// this has to be done before parsing the rest of flags since file values become defaults
+func findConfigFile(args []string) string {
+	pre := struct {
+		ConfigFile string `short:"c" long:"config" env:"SUCCOTASH_CONFIG"`
+	}{}
+	parser := flags.NewParser(&pre, flags.IgnoreUnknown)
+	// errors are reported by main parser
+	parser.ParseArgs(args)
+	return pre.ConfigFile
+}
+
+// engineConfigFromEnv collects engine configuration from environment variables
+func engineConfigFromEnv(environ []string) map[string]string {
+	engineConfig := map[string]string{}
+	for _, kv := range environ {
+		if !strings.HasPrefix(kv, engineEnvPrefix) {
+			continue
+		}
+		kv = strings.TrimPrefix(kv, engineEnvPrefix)
+		splitted := strings.SplitN(kv, "=", 2)
+		if len(splitted) != 2 || splitted[0] == "" {
+			continue
+		}
+		engineConfig[strings.ToLower(splitted[0])] = splitted[1]
+	}
+	return engineConfig
 }
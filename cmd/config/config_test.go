@@ -0,0 +1,438 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestParseConfigPrecedence(t *testing.T) {
+	r := require.New(t)
+	dir, err := ioutil.TempDir("", "succotash")
+	r.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := writeFile(t, dir, "config.yaml", `
+amount: "100"
+input_asset: btc
+mode: oneshot
+engine: coinbase_pro
+storage_depth: 5
+engines:
+  coinbase_pro:
+    api_url: https://api.pro.coinbase.com
+    api_level: 2
+    pair: BTC-USD
+    poll_interval: 5s
+`)
+
+	os.Setenv("SUCCOTASH_MODE", "service")
+	os.Setenv("SUCCOTASH_AMOUNT", "200")
+	os.Setenv("SUCCOTASH_ENGINE_CONFIG_POLL_INTERVAL", "10s")
+	os.Setenv("SUCCOTASH_ENGINE_CONFIG_PAIR", "ETH-USD")
+	defer os.Unsetenv("SUCCOTASH_MODE")
+	defer os.Unsetenv("SUCCOTASH_AMOUNT")
+	defer os.Unsetenv("SUCCOTASH_ENGINE_CONFIG_POLL_INTERVAL")
+	defer os.Unsetenv("SUCCOTASH_ENGINE_CONFIG_PAIR")
+
+	cfg, err := ParseConfig([]string{"-c", path, "-a", "300", "-e", "pair:BTC-EUR"})
+	r.NoError(err)
+	// flag > env > file > default
+	r.Equal("300", cfg.Amount)
+	r.Equal("service", cfg.Mode)
+	r.Equal("btc", cfg.InputAsset)
+	r.Equal(5, cfg.StorageDepth)
+	r.Equal(100, cfg.StorageBatch)
+	r.Equal(30*time.Second, cfg.StorageFlush)
+	r.Equal(time.Minute, cfg.StatsInterval)
+	r.Equal(map[string]string{
+		"api_url":       "https://api.pro.coinbase.com",
+		"api_level":     "2",
+		"pair":          "BTC-EUR",
+		"poll_interval": "10s",
+	}, cfg.EngineConfig)
+}
+
+func TestParseConfigTOML(t *testing.T) {
+	r := require.New(t)
+	dir, err := ioutil.TempDir("", "succotash")
+	r.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := writeFile(t, dir, "config.toml", `
+amount = "1"
+input_asset = "eth"
+mode = "oneshot"
+engine = "coinbase_pro"
+
+[engines.coinbase_pro]
+api_url = "https://api.pro.coinbase.com"
+api_level = 1
+pair = "ETH-USD"
+`)
+	cfg, err := ParseConfig([]string{"--config", path})
+	r.NoError(err)
+	r.Equal("1", cfg.Amount)
+	r.Equal("1", cfg.EngineConfig["api_level"])
+	r.Equal("ETH-USD", cfg.EngineConfig["pair"])
+}
+
+func TestParseConfigInvalid(t *testing.T) {
+	r := require.New(t)
+	dir, err := ioutil.TempDir("", "succotash")
+	r.NoError(err)
+	defer os.RemoveAll(dir)
+
+	unknownKey := writeFile(t, dir, "config.yaml", `amout: "1"`)
+	_, err = ParseConfig([]string{"-c", unknownKey})
+	r.Error(err)
+
+	invalidChoice := writeFile(t, dir, "config.yml", `
+amount: "1"
+input_asset: eth
+mode: forever
+engine: coinbase_pro
+engines:
+  coinbase_pro:
+    pair: ETH-USD
+`)
+	_, err = ParseConfig([]string{"-c", invalidChoice})
+	r.Error(err)
+
+	_, err = ParseConfig([]string{"-c", writeFile(t, dir, "config.json", `{}`)})
+	r.Error(err)
+
+	for _, intervals := range []string{"1m,five", "1m,-5m", "0s"} {
+		_, err = ParseConfig([]string{"-m", "service", "-E", "coinbase_pro", "-a", "1", "-i", "eth", "-e", "pair:ETH-USD", "--candle-intervals", intervals})
+		r.Error(err, intervals)
+	}
+	_, err = ParseConfig([]string{"-m", "service", "-E", "coinbase_pro", "-a", "1", "-i", "eth", "-e", "pair:ETH-USD", "--candle-intervals", "1s, 1m"})
+	r.NoError(err)
+
+	for name, section := range map[string]string{
+		"policy typo":        "invalid_book: resyncc",
+		"unknown key":        "pol_interval: 5s",
+		"malformed value":    "api_level: two",
+		"negative rate":      "rate_limit: -1",
+		"unsupported engine": "",
+	} {
+		engines := "  coinbase_pro:\n    pair: ETH-USD\n    " + section
+		if section == "" {
+			engines = "  kraken:\n    pair: ETH-USD"
+		}
+		path := writeFile(t, dir, "engines.yaml", "mode: oneshot\nengine: coinbase_pro\namount: \"1\"\ninput_asset: eth\nengines:\n"+engines+"\n")
+		_, err = ParseConfig([]string{"-c", path})
+		r.Error(err, name)
+	}
+
+	_, err = ParseConfig([]string{"-m", "oneshot", "-E", "coinbase_pro", "-a", "1", "-i", "eth", "-e", "pair:ETH-USD", "-e", "invalid_book:resyncc"})
+	r.Error(err, "engine config flag is validated")
+	_, err = ParseConfig([]string{"-m", "oneshot", "-E", "coinbase_pro", "-a", "1", "-i", "eth", "-e", "pair:ETH-USD", "-e", "invalid_book:drop"})
+	r.NoError(err)
+}
+
+func TestParseConfigJobs(t *testing.T) {
+	r := require.New(t)
+	dir, err := ioutil.TempDir("", "succotash")
+	r.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := writeFile(t, dir, "config.yaml", `
+mode: service
+engine: coinbase_pro
+engines:
+  coinbase_pro:
+    api_url: https://api.pro.coinbase.com
+    api_level: 2
+    poll_interval: 5s
+jobs:
+  - engine: coinbase_pro
+    pair: BTC-USD
+    input_asset: BTC
+    amounts: [1, "10.5"]
+  - name: usd-to-btc
+    engine: coinbase_pro
+    pair: BTC-USD
+    input_asset: usd
+    amounts: ["1000"]
+`)
+	cfg, err := ParseConfig([]string{"-c", path})
+	r.NoError(err)
+
+	jobs := cfg.GetJobs()
+	r.Len(jobs, 2)
+	r.Equal("coinbase_pro/BTC-USD/btc", jobs[0].Name)
+	r.Equal([]string{"1", "10.5"}, jobs[0].Amounts)
+	r.Equal("usd-to-btc", jobs[1].Name)
+
+	engineConfig := cfg.EngineConfigFor("coinbase_pro", "BTC-USD")
+	r.Equal("BTC-USD", engineConfig["pair"])
+	r.Equal("5s", engineConfig["poll_interval"])
+
+	ladder := writeFile(t, dir, "ladder.yaml", `
+mode: service
+engine: coinbase_pro
+jobs:
+  - engine: coinbase_pro
+    pair: BTC-USD
+    input_asset: btc
+    ladder: "1:10:1"
+`)
+	cfg, err = ParseConfig([]string{"-c", ladder})
+	r.NoError(err)
+	r.Equal("1:10:1", cfg.GetJobs()[0].Ladder)
+
+	_, err = ParseConfig([]string{"-c", ladder, "-l", "10:1:1"})
+	r.Error(err)
+
+	missingAmounts := writeFile(t, dir, "missing.yaml", `
+mode: service
+engine: coinbase_pro
+jobs:
+  - engine: coinbase_pro
+    pair: BTC-USD
+    input_asset: btc
+`)
+	_, err = ParseConfig([]string{"-c", missingAmounts})
+	r.Error(err)
+}
+
+func TestParseConfigCandlesMode(t *testing.T) {
+	r := require.New(t)
+
+	cfg, err := ParseConfig([]string{"-m", "candles", "-E", "coinbase_pro", "-e", "pair:BTC-USD", "--from", "2019-10-17T00:00:00Z", "--output", "btc.parquet"})
+	r.NoError(err)
+	r.Equal(time.Minute, cfg.Granularity)
+	r.Equal("btc.parquet", cfg.Output)
+
+	_, err = ParseConfig([]string{"-m", "candles", "-E", "coinbase_pro", "-e", "pair:BTC-USD"})
+	r.Error(err, "--from is required")
+
+	_, err = ParseConfig([]string{"-m", "candles", "-E", "coinbase_pro", "-e", "pair:BTC-USD", "--from", "yesterday"})
+	r.Error(err)
+}
+
+func TestParseConfigExecute(t *testing.T) {
+	r := require.New(t)
+
+	os.Setenv("SUCCOTASH_DRY_RUN", "true")
+	defer os.Unsetenv("SUCCOTASH_DRY_RUN")
+	cfg, err := ParseConfig([]string{"-m", "oneshot", "-E", "coinbase_pro", "-e", "pair:BTC-USD", "-a", "1", "-i", "btc", "--execute"})
+	r.NoError(err)
+	r.True(cfg.Execute)
+	r.True(cfg.DryRun)
+
+	_, err = ParseConfig([]string{"-m", "service", "-E", "coinbase_pro", "-e", "pair:BTC-USD", "-a", "1", "-i", "btc", "--execute"})
+	r.Error(err, "execution is only allowed in oneshot mode")
+}
+
+func TestParseConfigPaper(t *testing.T) {
+	r := require.New(t)
+	base := []string{"-E", "coinbase_pro", "-e", "pair:BTC-USD", "-a", "1", "-i", "btc", "--execute"}
+
+	cfg, err := ParseConfig(append([]string{"-m", "service", "--paper-state", "paper.json", "--paper-balances", "usd:100"}, base...))
+	r.NoError(err)
+	r.Equal("bps:50", cfg.PaperFee)
+
+	_, err = ParseConfig(append([]string{"-m", "oneshot", "--paper-state", "paper.json", "--paper-fee", "percent:1"}, base...))
+	r.Error(err)
+
+	_, err = ParseConfig(append([]string{"-m", "oneshot", "--paper-state", "paper.json", "--paper-balances", "usd"}, base...))
+	r.Error(err)
+}
+
+func TestParseConfigSchedule(t *testing.T) {
+	r := require.New(t)
+	base := []string{"-m", "schedule", "-E", "coinbase_pro", "-e", "pair:BTC-USD", "-i", "usd"}
+
+	cfg, err := ParseConfig(append([]string{"-a", "1000", "--schedule", "vwap", "--participation-rate", "0.1"}, base...))
+	r.NoError(err)
+	r.Equal(time.Hour, cfg.ScheduleWindow)
+	r.Equal(12, cfg.ScheduleSlices)
+
+	_, err = ParseConfig(base)
+	r.Error(err, "amount is required")
+
+	_, err = ParseConfig(append([]string{"-a", "1000", "--max-slippage-bps", "10"}, base...))
+	r.Error(err, "max slippage is not supported by schedule mode")
+
+	_, err = ParseConfig(append([]string{"-a", "1000", "--schedule-slices", "0"}, base...))
+	r.Error(err)
+}
+
+func TestParseConfigArbitrage(t *testing.T) {
+	r := require.New(t)
+	dir, err := ioutil.TempDir("", "succotash")
+	r.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := writeFile(t, dir, "config.yaml", `
+mode: arbitrage
+engine: coinbase_pro
+engines:
+  coinbase_pro:
+    api_url: https://api.pro.coinbase.com
+    api_level: 2
+venues:
+  - name: coinbase
+    engine: coinbase_pro
+    pair: BTC-USD
+  - name: sandbox
+    engine: coinbase_pro
+    pair: btc-usd
+    fee_bps: 10
+    engine_config:
+      api_url: https://api-public.sandbox.pro.coinbase.com
+`)
+	cfg, err := ParseConfig([]string{"-c", path, "--webhook-url", "https://example.com/hook"})
+	r.NoError(err)
+	r.Len(cfg.Venues, 2)
+	r.Equal("10", cfg.Venues[1].FeeBps)
+	r.Equal("50", cfg.ArbFeeBps)
+	r.Equal(10*time.Second, cfg.ArbMaxBookAge)
+
+	engineConfig := cfg.EngineConfigForVenue(cfg.Venues[1])
+	r.Equal("https://api-public.sandbox.pro.coinbase.com", engineConfig["api_url"])
+	r.Equal("2", engineConfig["api_level"])
+	r.Equal("btc-usd", engineConfig["pair"])
+
+	single := writeFile(t, dir, "single.yaml", `
+mode: arbitrage
+engine: coinbase_pro
+venues:
+  - name: coinbase
+    engine: coinbase_pro
+    pair: BTC-USD
+`)
+	_, err = ParseConfig([]string{"-c", single})
+	r.Error(err, "at least two venues are required")
+
+	mismatched := writeFile(t, dir, "mismatched.yaml", `
+mode: arbitrage
+engine: coinbase_pro
+venues:
+  - name: coinbase
+    engine: coinbase_pro
+    pair: BTC-USD
+  - name: sandbox
+    engine: coinbase_pro
+    pair: ETH-USD
+`)
+	_, err = ParseConfig([]string{"-c", mismatched})
+	r.Error(err)
+
+	_, err = ParseConfig([]string{"-c", path, "--webhook-url", "not a url"})
+	r.Error(err)
+}
+
+func TestParseConfigTriangle(t *testing.T) {
+	r := require.New(t)
+	dir, err := ioutil.TempDir("", "succotash")
+	r.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := writeFile(t, dir, "config.yaml", `
+mode: triangle
+engine: coinbase_pro
+engines:
+  coinbase_pro:
+    api_url: https://api.pro.coinbase.com
+    api_level: 2
+triangles:
+  - name: usd-btc-eth
+    start_asset: usd
+    amount: 1000
+    pairs: [BTC-USD, ETH-BTC, ETH-USD]
+`)
+	cfg, err := ParseConfig([]string{"-c", path})
+	r.NoError(err)
+	r.Len(cfg.Triangles, 1)
+	triangle, err := cfg.Triangles[0].Resolve()
+	r.NoError(err)
+	r.Len(triangle.Legs, 3)
+	r.Equal("1000", triangle.Amount.String())
+
+	_, err = ParseConfig([]string{"-m", "triangle", "-E", "coinbase_pro"})
+	r.Error(err, "triangles are required")
+
+	open := writeFile(t, dir, "open.yaml", `
+mode: triangle
+engine: coinbase_pro
+triangles:
+  - name: open
+    start_asset: usd
+    amount: 1000
+    pairs: [BTC-USD, ETH-BTC, ETH-BTC]
+`)
+	_, err = ParseConfig([]string{"-c", open})
+	r.Error(err)
+}
+
+func TestParseConfigAlerts(t *testing.T) {
+	r := require.New(t)
+	dir, err := ioutil.TempDir("", "succotash")
+	r.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := writeFile(t, dir, "config.yaml", `
+mode: service
+engine: coinbase_pro
+amount: 1
+input_asset: btc
+alert_notifiers: stdout,email
+smtp_addr: smtp.example.com:587
+email_from: bot@example.com
+email_to: a@example.com, b@example.com
+engines:
+  coinbase_pro:
+    pair: BTC-USD
+alerts:
+  - name: wide-spread
+    rule: spread > 20 bps for 30s clear 15 bps
+    pair: BTC-USD
+    cooldown: 1m
+  - name: thin-book
+    rule: depth within 50 bps < 10 btc
+`)
+	cfg, err := ParseConfig([]string{"-c", path})
+	r.NoError(err)
+	r.Len(cfg.Alerts, 2)
+	r.Equal(time.Minute, cfg.Alerts[0].Cooldown)
+	r.Equal(5*time.Minute, cfg.AlertCooldown)
+	r.True(cfg.Alerts[0].Matches("coinbase_pro", "btc-usd"))
+	r.False(cfg.Alerts[0].Matches("coinbase_pro", "ETH-USD"))
+	r.True(cfg.Alerts[1].Matches("coinbase_pro", "ETH-USD"))
+	r.Equal([]string{"stdout", "email"}, cfg.GetAlertNotifiers())
+	r.Equal([]string{"a@example.com", "b@example.com"}, cfg.GetEmailTo())
+
+	_, err = ParseConfig([]string{"-c", path, "--alert-notifiers", "webhook"})
+	r.Error(err, "webhook notifier requires --webhook-url")
+
+	_, err = ParseConfig([]string{"-c", path, "--alert-notifiers", "pager"})
+	r.Error(err)
+
+	invalid := writeFile(t, dir, "invalid.yaml", `
+mode: service
+engine: coinbase_pro
+amount: 1
+input_asset: btc
+engines:
+  coinbase_pro:
+    pair: BTC-USD
+alerts:
+  - name: wide-spread
+    rule: spread wider than 20 bps
+`)
+	_, err = ParseConfig([]string{"-c", invalid})
+	r.Error(err)
+}
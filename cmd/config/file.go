@@ -0,0 +1,171 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/BurntSushi/toml"
+	"github.com/jessevdk/go-flags"
+	"github.com/mitchellh/mapstructure"
+	"gopkg.in/yaml.v2"
+)
+
+// engineSection is key in config file holding nested engine configurations
+// keyed by engine name, e.g.
+//
+//	engines:
+//	  coinbase_pro:
+//	    pair: BTC-USD
+const engineSection = "engines"
+
+// jobSection is key in config file holding list of jobs
+const jobSection = "jobs"
+
+// venueSection is key in config file holding list of venues watched by arbitrage mode
+const venueSection = "venues"
+
+// triangleSection is key in config file holding list of triangles scanned by triangle mode
+const triangleSection = "triangles"
+
+// alertSection is key in config file holding list of alert rules of service mode
+const alertSection = "alerts"
+
+// fileConfig holds values read from config file
+// options are keyed by flag long name with underscore instead of dash
+type fileConfig struct {
+	options   map[string]string
+	engines   map[string]map[string]string
+	jobs      []Job
+	venues    []Venue
+	triangles []Triangle
+	alerts    []AlertRule
+}
+
+// loadFile reads YAML or TOML config file according to its extension
+// empty path returns empty config
+func loadFile(path string) (fileConfig, error) {
+	fc := fileConfig{options: map[string]string{}, engines: map[string]map[string]string{}}
+	if path == "" {
+		return fc, nil
+	}
+
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fc, errors.Wrapf(err, "failed to read config file [%v]", path)
+	}
+
+	content := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(raw, &content)
+	case ".toml":
+		err = toml.Unmarshal(raw, &content)
+	default:
+		err = fmt.Errorf("unsupported extension, need [.yaml|.yml|.toml]")
+	}
+	if err != nil {
+		return fc, errors.Wrapf(err, "failed to parse config file [%v]", path)
+	}
+
+	for key, value := range content {
+		switch key {
+		case engineSection:
+			if err := decodeEngines(value, fc.engines); err != nil {
+				return fc, err
+			}
+		case jobSection:
+			if err := decodeList(value, &fc.jobs); err != nil {
+				return fc, errors.Wrapf(err, "malformed [%v] section", jobSection)
+			}
+		case venueSection:
+			if err := decodeList(value, &fc.venues); err != nil {
+				return fc, errors.Wrapf(err, "malformed [%v] section", venueSection)
+			}
+		case triangleSection:
+			if err := decodeList(value, &fc.triangles); err != nil {
+				return fc, errors.Wrapf(err, "malformed [%v] section", triangleSection)
+			}
+		case alertSection:
+			if err := decodeList(value, &fc.alerts); err != nil {
+				return fc, errors.Wrapf(err, "malformed [%v] section", alertSection)
+			}
+		default:
+			fc.options[key] = fmt.Sprint(value)
+		}
+	}
+	return fc, nil
+}
+
+// applyDefaults sets file values as default of matching options
+func (fc fileConfig) applyDefaults(parser *flags.Parser) error {
+	keys := []string{}
+	for key := range fc.options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		longName := strings.Replace(key, "_", "-", -1)
+		option := parser.FindOptionByLongName(longName)
+		if option == nil || longName == "config" || longName == "engine-config" {
+			return fmt.Errorf("unrecognized config file key [%v]", key)
+		}
+		option.Default = []string{fc.options[key]}
+	}
+	return nil
+}
+
+// decodeEngines decodes nested engine configurations into map of string map
+func decodeEngines(i interface{}, engines map[string]map[string]string) error {
+	sections, err := toStringMap(i)
+	if err != nil {
+		return errors.Wrapf(err, "malformed [%v] section", engineSection)
+	}
+	for name, section := range sections {
+		engineConfig, err := toStringMap(section)
+		if err != nil {
+			return errors.Wrapf(err, "malformed [%v.%v] section", engineSection, name)
+		}
+		engines[name] = map[string]string{}
+		for k, v := range engineConfig {
+			engines[name][k] = fmt.Sprint(v)
+		}
+	}
+	return nil
+}
+
+// decodeList decodes list of maps into jobs, venues, triangles or alert rules,
+// numbers are decoded into string fields and durations are parsed from strings
+func decodeList(i interface{}, result interface{}) error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		WeaklyTypedInput: true,
+		ErrorUnused:      true,
+		DecodeHook:       mapstructure.StringToTimeDurationHookFunc(),
+		Result:           result,
+	})
+	if err != nil {
+		return err
+	}
+	return decoder.Decode(i)
+}
+
+// toStringMap converts decoded nested map into map keyed by string,
+// yaml decodes nested map as map[interface{}]interface{}
+func toStringMap(i interface{}) (map[string]interface{}, error) {
+	switch m := i.(type) {
+	case map[string]interface{}:
+		return m, nil
+	case map[interface{}]interface{}:
+		converted := map[string]interface{}{}
+		for k, v := range m {
+			converted[fmt.Sprint(k)] = v
+		}
+		return converted, nil
+	default:
+		return nil, errors.Wrap(fmt.Errorf("type assertion failed"), "interface->map[string]interface")
+	}
+}
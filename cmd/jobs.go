@@ -0,0 +1,360 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/choestelus/super-duper-succotash/cmd/config"
+	"github.com/choestelus/super-duper-succotash/pkg/alert"
+	"github.com/choestelus/super-duper-succotash/pkg/candle"
+	"github.com/choestelus/super-duper-succotash/pkg/engine/coinbase"
+	"github.com/choestelus/super-duper-succotash/pkg/execution"
+	"github.com/choestelus/super-duper-succotash/pkg/order"
+	"github.com/choestelus/super-duper-succotash/pkg/storage"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+// subscription groups jobs sharing same engine and pair
+// so order book is fetched only once for all of them
+type subscription struct {
+	engineName string
+	engine     order.BookStreamer
+	config     map[string]string
+	jobs       []config.Job
+	// executor places order for each quoted amount when set
+	executor execution.Executor
+	dryRun   bool
+	// watchers evaluate alert rules on each book
+	watchers []*alert.Watcher
+	// fixedPoint matches amounts on fixed-point orders instead of decimal
+	fixedPoint bool
+}
+
+// bookUpdate is order book received from subscription
+type bookUpdate struct {
+	sub  *subscription
+	book order.Book
+}
+
+// groupSubscriptions groups jobs by engine and pair, in order of first appearance
+func groupSubscriptions(cfg config.Config) []*subscription {
+	subs := []*subscription{}
+	byKey := map[string]*subscription{}
+	for _, job := range cfg.GetJobs() {
+		key := job.Engine + "/" + strings.ToUpper(job.Pair)
+		sub, ok := byKey[key]
+		if !ok {
+			engineConfig := cfg.EngineConfigFor(job.Engine, job.Pair)
+			sub = &subscription{
+				engineName: job.Engine,
+				engine:     AvailableEngines[job.Engine].Configure(engineConfig),
+				config:     engineConfig,
+				fixedPoint: cfg.FixedPoint,
+			}
+			byKey[key] = sub
+			subs = append(subs, sub)
+		}
+		sub.jobs = append(sub.jobs, job)
+	}
+	return subs
+}
+
+// attachExecutors sets executor of every subscription, either paper account
+// or engine itself when paper is nil
+func attachExecutors(subs []*subscription, paper *execution.PaperAccount, dryRun bool) {
+	for _, sub := range subs {
+		sub.executor = mustExecutor(sub.engineName, sub.engine, paper, dryRun)
+		sub.dryRun = dryRun
+	}
+}
+
+// mustExecutor returns paper account, or executor of engine when paper is nil,
+// which needs no credentials on dry run when engine supports it.
+// panic when engine does not support execution
+func mustExecutor(engineName string, engine order.BookStreamer, paper *execution.PaperAccount, dryRun bool) execution.Executor {
+	if paper != nil {
+		return paper
+	}
+	if provider, ok := engine.(execution.DryRunExecutorProvider); ok && dryRun {
+		return provider.DryRunExecutor()
+	}
+	provider, ok := engine.(execution.ExecutorProvider)
+	if !ok {
+		logrus.Panicf("engine %v does not support execution", engineName)
+	}
+	executor, err := provider.Executor()
+	if err != nil {
+		logrus.Panic(err)
+	}
+	return executor
+}
+
+// mergeStreams opens stream of every subscription and merges them into single channel
+func mergeStreams(subs []*subscription) <-chan bookUpdate {
+	updates := make(chan bookUpdate)
+	for _, sub := range subs {
+		go func(sub *subscription) {
+			for book := range sub.engine.OpenStream(sub.config) {
+				updates <- bookUpdate{sub: sub, book: book}
+			}
+		}(sub)
+	}
+	return updates
+}
+
+// httpStatser is implemented by engines counting requests of their API client
+type httpStatser interface {
+	HTTPStats() coinbase.Stats
+}
+
+// reportHTTPStats reports request counters of every engine supporting it on every interval,
+// once per API URL since engines of the same API URL share client
+func reportHTTPStats(interval time.Duration, subs []*subscription) {
+	if interval <= 0 {
+		return
+	}
+	for range time.Tick(interval) {
+		reported := map[string]bool{}
+		for _, sub := range subs {
+			statser, ok := sub.engine.(httpStatser)
+			key := sub.engineName + " " + sub.config["api_url"]
+			if !ok || reported[key] {
+				continue
+			}
+			reported[key] = true
+			ReportHTTPStats(sub.engineName, sub.config["api_url"], statser.HTTPStats())
+		}
+	}
+}
+
+// streamTrades reports trades of every subscription whose engine can stream trades
+// and has websocket feed configured, candles are built from trades when intervals are supplied
+func streamTrades(cfg config.Config, subs []*subscription) {
+	intervals, err := cfg.GetCandleIntervals()
+	if err != nil {
+		logrus.Panic(err)
+	}
+
+	for _, sub := range subs {
+		streamer, ok := sub.engine.(order.TradeStreamer)
+		if !ok || sub.config["ws_url"] == "" {
+			continue
+		}
+
+		aggregators := []*candle.Aggregator{}
+		for _, interval := range intervals {
+			aggregator := candle.NewAggregator(interval, cfg.CandleLateness)
+			for _, c := range backfill(sub, interval, cfg.CandleBackfill, aggregator) {
+				ReportCandle(sub.engineName, c)
+			}
+			aggregators = append(aggregators, aggregator)
+		}
+
+		go func(sub *subscription) {
+			trades := make(chan order.Trade)
+			go func() {
+				defer close(trades)
+				for trade := range streamer.OpenTradeStream(sub.config) {
+					ReportTrade(sub.engineName, trade)
+					trades <- trade
+				}
+			}()
+			for c := range candle.Stream(trades, aggregators...) {
+				ReportCandle(sub.engineName, c)
+			}
+		}(sub)
+	}
+}
+
+// backfill seeds aggregator with historical candles when engine supports it,
+// failure is only logged since candles can still be built from trades
+func backfill(sub *subscription, interval, window time.Duration, aggregator *candle.Aggregator) []candle.Candle {
+	backfiller, ok := sub.engine.(candle.Backfiller)
+	if !ok || window <= 0 {
+		return nil
+	}
+	candles, err := backfiller.Backfill(interval, time.Now().Add(-window))
+	if err != nil {
+		logrus.Warnf("[%v] unable to backfill %v candles: %v", sub.engineName, interval, err)
+		return nil
+	}
+	return aggregator.Backfill(candles)
+}
+
+// quoteJobs matches every amount of every job in subscription against book,
+// reports and stores results when writer is supplied
+func quoteJobs(sub *subscription, book order.Book, writer *storage.BatchWriter) {
+	pair := pairName(sub.engine)
+	base, quote := sub.engine.AssetPair()
+	for _, job := range sub.jobs {
+		inputAsset := strings.ToLower(job.InputAsset)
+		outputAsset := sub.engine.PairOf(inputAsset)
+
+		side := sub.engine.PlaceSideToRetrieve(inputAsset)
+		orders, err := book.GetOrdersBySide(side)
+		if err != nil {
+			logrus.Panic(err)
+		}
+
+		limit := limitPrice(job, side, book, orders)
+		if limit != nil {
+			orders = order.WithinLimit(side, orders, *limit)
+		}
+
+		var fixed *fixedOrders
+		if sub.fixedPoint {
+			fixed = toFixedOrders(sub.engineName, book, orders)
+		}
+
+		for _, rawAmount := range job.Amounts {
+			amount := decimal.RequireFromString(rawAmount)
+			consumed, matched := fixed.match(side, orders, amount)
+
+			Report(job.Name, book, amount, consumed, matched, inputAsset, outputAsset, limit)
+
+			if sub.executor != nil {
+				execute(sub, job, book, pair, base, quote, amount, consumed, matched, limit)
+			}
+
+			if writer == nil {
+				continue
+			}
+			err := writer.WriteQuote(storage.Quote{
+				Job:         job.Name,
+				Engine:      sub.engineName,
+				Pair:        pair,
+				Sequence:    book.Sequence,
+				InputAsset:  inputAsset,
+				OutputAsset: outputAsset,
+				Amount:      amount,
+				Consumed:    consumed,
+				Matched:     matched,
+				RecordedAt:  book.UpdatedAt,
+			})
+			if err != nil {
+				logrus.Panic(err)
+			}
+		}
+
+		if job.Ladder != "" {
+			amounts, err := order.ParseLadder(job.Ladder)
+			if err != nil {
+				logrus.Panic(err)
+			}
+			rungs := order.MatchLadder(side, orders, amounts)
+			ReportLadder(job.Name, book, rungs, inputAsset, outputAsset)
+		}
+	}
+
+	if writer == nil {
+		return
+	}
+	if err := writer.WriteBook(sub.engineName, pair, book); err != nil {
+		logrus.Panic(err)
+	}
+}
+
+// execute places order spending amount of job input asset, quoted result
+// is supplied so realized price can be compared against it
+func execute(sub *subscription, job config.Job, book order.Book, pair, base, quote string, amount, consumed, matched decimal.Decimal, limit *decimal.Decimal) {
+	side, err := execution.SideOf(strings.ToLower(job.InputAsset), base, quote)
+	if err != nil {
+		logrus.Panic(err)
+	}
+	paper, isPaper := sub.executor.(*execution.PaperAccount)
+	if isPaper {
+		paper.Observe(pair, book)
+	}
+	req := execution.Request{
+		Pair:        pair,
+		Side:        side,
+		Amount:      amount,
+		QuotedPrice: execution.QuotedPrice(side, consumed, matched),
+		DryRun:      sub.dryRun,
+	}
+	if limit != nil {
+		req.LimitPrice = *limit
+	}
+	result, err := sub.executor.Execute(req)
+	if errors.Is(err, execution.ErrInsufficientBalance) {
+		// paper account rejects fill as exchange would, later amounts may still fit
+		logrus.WithField("job", job.Name).Warnf("skipped [%v] %v: %v", amount.StringFixed(8), job.InputAsset, err)
+		return
+	}
+	if err != nil {
+		logrus.Panic(err)
+	}
+	ReportExecution(job.Name, result)
+	if isPaper {
+		ReportBalances(job.Name, paper.Balances())
+	}
+}
+
+// limitPrice returns limit price of job, either supplied directly or
+// derived from max slippage, returns nil when job is not limited
+func limitPrice(job config.Job, side string, book order.Book, orders []order.Order) *decimal.Decimal {
+	if job.LimitPrice != "" {
+		limit := decimal.RequireFromString(job.LimitPrice)
+		return &limit
+	}
+	if job.MaxSlippageBps == "" {
+		return nil
+	}
+
+	reference := decimal.Zero
+	switch job.SlippageFrom {
+	case "mid":
+		mid, err := book.MidPrice()
+		if err != nil {
+			logrus.Panic(err)
+		}
+		reference = mid
+	default:
+		if len(orders) == 0 {
+			logrus.Panicf("[%v] no %v orders to take best price from", job.Name, side)
+		}
+		reference = orders[0].Price
+	}
+	limit := order.LimitFromSlippage(side, reference, decimal.RequireFromString(job.MaxSlippageBps))
+	return &limit
+}
+
+// fixedOrders is fixed-point copy of orders matched against every amount of job
+type fixedOrders struct {
+	engineName string
+	scale      order.Scale
+	orders     []order.FixedOrder
+}
+
+// minFixedScale keeps base bought with quote as precise as base increment of coinbase
+// even when every size of book happens to be whole number
+var minFixedScale = order.Scale{Size: 8}
+
+// toFixedOrders converts orders with scale detected from book,
+// returns nil to match on decimal when orders can not be converted
+func toFixedOrders(engineName string, book order.Book, orders []order.Order) *fixedOrders {
+	scale, err := order.DetectScale(book, minFixedScale)
+	if err == nil {
+		var fixed []order.FixedOrder
+		if fixed, err = order.ToFixedOrders(orders, scale); err == nil {
+			return &fixedOrders{engineName: engineName, scale: scale, orders: fixed}
+		}
+	}
+	logrus.Warnf("[%v] unable to match on fixed-point, fallback to decimal: %v", engineName, err)
+	return nil
+}
+
+// match quotes amount on fixed-point orders, or on decimal orders when f is nil
+// or amount can not be matched on fixed-point
+func (f *fixedOrders) match(side string, orders []order.Order, amount decimal.Decimal) (decimal.Decimal, decimal.Decimal) {
+	if f != nil {
+		consumed, matched, err := order.QuoteFixed(side, f.orders, f.scale, amount)
+		if err == nil {
+			return consumed, matched
+		}
+		logrus.Warnf("[%v] unable to match %v on fixed-point, fallback to decimal: %v", f.engineName, amount, err)
+	}
+	return order.MatchUntilSatisfied(side, orders, amount)
+}
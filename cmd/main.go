@@ -1,9 +1,21 @@
 package main
 
 import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
 	"github.com/choestelus/super-duper-succotash/cmd/config"
+	"github.com/choestelus/super-duper-succotash/pkg/candle"
 	"github.com/choestelus/super-duper-succotash/pkg/engine/coinbase"
+	"github.com/choestelus/super-duper-succotash/pkg/execution"
 	"github.com/choestelus/super-duper-succotash/pkg/order"
+	"github.com/choestelus/super-duper-succotash/pkg/storage"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
 	"github.com/shopspring/decimal"
 	"github.com/sirupsen/logrus"
 )
@@ -15,66 +27,315 @@ var AvailableEngines = map[string]order.BookStreamer{
 
 func main() {
 	cfg := config.MustParseConfig()
-	engine := AvailableEngines[cfg.Engine].Configure(cfg.EngineConfig)
 
 	switch cfg.Mode {
 	case "oneshot":
-		ExchangeOneShot(cfg, engine)
+		ExchangeOneShot(cfg)
 	case "service":
-		ExchangeStream(cfg, engine)
+		ExchangeStream(cfg)
+	case "query":
+		engine := AvailableEngines[cfg.Engine].Configure(cfg.EngineConfig)
+		QueryQuote(cfg, engine)
+	case "candles":
+		engine := AvailableEngines[cfg.Engine].Configure(cfg.EngineConfig)
+		ExportCandles(cfg, engine)
+	case "schedule":
+		ScheduleExecution(cfg)
+	case "arbitrage":
+		WatchArbitrage(cfg)
+	case "triangle":
+		WatchTriangles(cfg)
+	case "tui":
+		WatchLadder(cfg)
 	default:
 		logrus.Warnf("unrecognized mode: %v", cfg.Mode)
 	}
 }
 
 // ExchangeOneShot groups exchanging operations for oneshot mode together
-func ExchangeOneShot(cfg config.Config, engine order.BookStreamer) {
-	inputAsset := cfg.InputAsset
-	outputAsset := engine.PairOf(inputAsset)
+// order book of each engine and pair is fetched once and shared among jobs
+func ExchangeOneShot(cfg config.Config) {
+	subs := groupSubscriptions(cfg)
+	if cfg.Execute {
+		attachExecutors(subs, mustOpenPaper(cfg), cfg.DryRun)
+	}
+	for _, sub := range subs {
+		book := sub.engine.OneShot(sub.config)
+		quoteJobs(sub, book, nil)
+	}
+}
+
+// ExchangeStream groups exchanging operations for service mode together
+// jobs with same engine and pair share one order book subscription,
+// buffered records are written to storage on interrupt or termination
+func ExchangeStream(cfg config.Config) {
+	writer := mustOpenWriter(cfg)
+	defer closeWriter(writer)
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	subs := groupSubscriptions(cfg)
+	if cfg.Execute {
+		attachExecutors(subs, mustOpenPaper(cfg), cfg.DryRun)
+	}
+	attachWatchers(cfg, subs)
+	notifier := mustAlertNotifier(cfg)
+	defer notifier.Close()
+	streamTrades(cfg, subs)
+	go reportHTTPStats(cfg.StatsInterval, subs)
+	updates := mergeStreams(subs)
+	for {
+		select {
+		case update := <-updates:
+			quoteJobs(update.sub, update.book, writer)
+			evaluateAlerts(update.sub, update.book, notifier)
+		case sig := <-stop:
+			logrus.Infof("received %v, stopping", sig)
+			return
+		}
+	}
+}
 
-	book := engine.OneShot(cfg.EngineConfig)
-	side := engine.PlaceSideToRetrieve(cfg.InputAsset)
-	orders, err := book.GetOrdersBySide(side)
+// QueryQuote prints latest stored quote of --amount as of timestamp supplied by --as-of flag,
+// of job supplied by --query-job or of any job when omitted
+func QueryQuote(cfg config.Config, engine order.BookStreamer) {
+	if cfg.StorageDSN == "" {
+		logrus.Panic("query mode requires --storage-dsn")
+	}
+	if cfg.Amount == "" {
+		logrus.Panic("query mode requires --amount")
+	}
+	asOf := time.Now()
+	if cfg.AsOf != "" {
+		t, err := time.Parse(time.RFC3339, cfg.AsOf)
+		if err != nil {
+			logrus.Panicf("malformed --as-of timestamp: %v", err)
+		}
+		asOf = t
+	}
+
+	store, err := storage.Open(cfg.StorageDriver, cfg.StorageDSN)
 	if err != nil {
 		logrus.Panic(err)
 	}
+	defer store.Close()
 
 	amount := decimal.RequireFromString(cfg.Amount)
-	consumed, matched := order.MatchUntilSatisfied(side, orders, amount)
-
-	Report(book, amount, consumed, matched, inputAsset, outputAsset)
+	q, err := store.QuoteAsOf(cfg.Engine, pairName(engine), strings.ToLower(cfg.InputAsset), amount, cfg.QueryJob, asOf)
+	if err != nil {
+		logrus.Panic(err)
+	}
+	book := order.Book{Sequence: q.Sequence, UpdatedAt: q.RecordedAt}
+	name := q.Job
+	if name == "" {
+		name = q.InputAsset
+	}
+	Report(name, book, q.Amount, q.Consumed, q.Matched, q.InputAsset, q.OutputAsset, nil)
 }
 
-// ExchangeStream groups exchanging operations for service mode together
-func ExchangeStream(cfg config.Config, engine order.BookStreamer) {
-	stream := engine.OpenStream(cfg.EngineConfig)
-	for book := range stream {
-		inputAsset := cfg.InputAsset
-		outputAsset := engine.PairOf(inputAsset)
-
-		side := engine.PlaceSideToRetrieve(cfg.InputAsset)
-		orders, err := book.GetOrdersBySide(side)
-		if err != nil {
-			logrus.Panic(err)
+// ExportCandles fetches historical candles within --from and --to
+// and writes them into --output file, or stdout as CSV when output is omitted
+func ExportCandles(cfg config.Config, engine order.BookStreamer) {
+	fetcher, ok := engine.(candle.HistoryFetcher)
+	if !ok {
+		logrus.Panicf("engine %v does not support fetching historical candles", cfg.Engine)
+	}
+	from, err := time.Parse(time.RFC3339, cfg.From)
+	if err != nil {
+		logrus.Panicf("malformed --from timestamp: %v", err)
+	}
+	to := time.Now()
+	if cfg.To != "" {
+		if to, err = time.Parse(time.RFC3339, cfg.To); err != nil {
+			logrus.Panicf("malformed --to timestamp: %v", err)
 		}
+	}
 
-		amount := decimal.RequireFromString(cfg.Amount)
-		consumed, matched := order.MatchUntilSatisfied(side, orders, amount)
+	path, out := "stdout.csv", os.Stdout
+	if cfg.Output != "" {
+		path = cfg.Output
+		if out, err = os.Create(path); err != nil {
+			logrus.Panicf("failed to create output file: %v", err)
+		}
+		defer out.Close()
+	}
+	sink, err := candle.NewSink(path, out)
+	if err != nil {
+		logrus.Panic(err)
+	}
 
-		Report(book, amount, consumed, matched, inputAsset, outputAsset)
+	count := 0
+	err = fetcher.FetchHistory(cfg.Granularity, from, to, func(candles []candle.Candle) error {
+		count += len(candles)
+		return sink.Write(candles)
+	})
+	if err != nil {
+		logrus.Panic(err)
+	}
+	if err := sink.Close(); err != nil {
+		logrus.Panic(err)
 	}
+	logrus.Infof("exported %v candles of %v to %v", count, pairName(engine), path)
+}
+
+// mustOpenWriter opens storage and returns batch writer when storage is configured
+// returns nil writer when storage is disabled
+func mustOpenWriter(cfg config.Config) *storage.BatchWriter {
+	if cfg.StorageDSN == "" {
+		return nil
+	}
+	store, err := storage.Open(cfg.StorageDriver, cfg.StorageDSN)
+	if err != nil {
+		logrus.Panic(err)
+	}
+	if err := store.Migrate(); err != nil {
+		logrus.Panic(err)
+	}
+	return storage.NewBatchWriter(store, cfg.StorageDepth, cfg.StorageBatch, cfg.StorageFlush, func(err error) {
+		logrus.Warnf("failed to write buffered records, retrying on next flush: %v", err)
+	})
+}
+
+// closeWriter writes buffered records and closes storage, nil writer is ignored
+func closeWriter(writer *storage.BatchWriter) {
+	if writer == nil {
+		return
+	}
+	if err := writer.Close(); err != nil {
+		logrus.Warnf("failed to write buffered records on close: %v", err)
+	}
+}
+
+// mustOpenPaper opens paper trading account when configured
+// returns nil account when orders should be placed on exchange
+func mustOpenPaper(cfg config.Config) *execution.PaperAccount {
+	if cfg.PaperState == "" {
+		return nil
+	}
+	balances, err := execution.ParseBalances(cfg.PaperBalances)
+	if err != nil {
+		logrus.Panic(err)
+	}
+	fee, err := execution.ParseFeeModel(cfg.PaperFee)
+	if err != nil {
+		logrus.Panic(err)
+	}
+	paper, err := execution.OpenPaperAccount(cfg.PaperState, balances, fee)
+	if err != nil {
+		logrus.Panic(err)
+	}
+	ReportBalances("paper", paper.Balances())
+	return paper
+}
+
+// pairName returns pair in exchange notation, e.g. BTC-USD
+func pairName(engine order.BookStreamer) string {
+	main, exchanging := engine.AssetPair()
+	return strings.ToUpper(main + "-" + exchanging)
 }
 
 // Report pretty prints summary of exchange conversion rate and transaction
-func Report(book order.Book, inputAmount, consumed, matched decimal.Decimal, inputAsset, outputAsset string) {
-	logrus.Infof("---------------------%v---------------------------------------------", book.UpdatedAt.UTC())
-	logrus.Infof("attempt to trading with\t[%v] %v", inputAmount.StringFixed(8), inputAsset)
-	logrus.Infof("consumed               \t[%v] %v", consumed.StringFixed(8), inputAsset)
-	logrus.Infof("got                    \t[%v] %v", matched.StringFixed(8), outputAsset)
-
-	priceRate, numeratorAsset, denominatorAsset := reportPriceRateByAsset(consumed, matched, "usd", inputAsset, outputAsset)
-	logrus.Infof("avg price              \t[%v] %v/%v", priceRate.StringFixed(8), numeratorAsset, denominatorAsset)
-	logrus.Infof("---------------------------------------------------------------------------------------------------------")
+// tagged with job name, amount that would rest is printed when limit price is supplied,
+// average price is omitted when nothing is matched
+func Report(job string, book order.Book, inputAmount, consumed, matched decimal.Decimal, inputAsset, outputAsset string, limit *decimal.Decimal) {
+	log := logrus.WithField("job", job)
+	log.Infof("---------------------%v---------------------------------------------", book.UpdatedAt.UTC())
+	log.Infof("attempt to trading with\t[%v] %v", inputAmount.StringFixed(8), inputAsset)
+	log.Infof("consumed               \t[%v] %v", consumed.StringFixed(8), inputAsset)
+	log.Infof("got                    \t[%v] %v", matched.StringFixed(8), outputAsset)
+
+	if consumed.IsZero() || matched.IsZero() {
+		// limit is worse than best price or side is empty, nothing to average
+		log.Infof("avg price              \t[n/a] nothing matched")
+	} else {
+		priceRate, numeratorAsset, denominatorAsset := reportPriceRateByAsset(consumed, matched, "usd", inputAsset, outputAsset)
+		log.Infof("avg price              \t[%v] %v/%v", priceRate.StringFixed(8), numeratorAsset, denominatorAsset)
+	}
+	if limit != nil {
+		log.Infof("limit price            \t[%v]", limit.StringFixed(8))
+		log.Infof("would rest             \t[%v] %v", inputAmount.Sub(consumed).StringFixed(8), inputAsset)
+	} else if consumed.IsZero() {
+		log.Infof("unfilled               \t[%v] %v", inputAmount.StringFixed(8), inputAsset)
+	}
+	log.Infof("---------------------------------------------------------------------------------------------------------")
+}
+
+// ReportExecution pretty prints placed order and its realized price against quoted price
+func ReportExecution(job string, result execution.Result) {
+	log := logrus.WithField("job", job)
+	req := result.Request
+	orderType := "market"
+	if req.IsLimit() {
+		orderType = fmt.Sprintf("limit IOC at [%v]", req.LimitPrice.StringFixed(8))
+	}
+	log.Infof("executed               \t%v %v %v order [%v] status [%v]", req.Side, req.Pair, orderType, result.OrderID, result.Status)
+	if req.DryRun {
+		return
+	}
+	size, value, fees := result.Filled()
+	log.Infof("filled                 \t[%v] base for [%v] quote in %v fills", size.StringFixed(8), value.StringFixed(8), len(result.Fills))
+	log.Infof("fees                   \t[%v]", fees.StringFixed(8))
+	log.Infof("quoted price           \t[%v]", req.QuotedPrice.StringFixed(8))
+	log.Infof("realized price         \t[%v]", result.AveragePrice().StringFixed(8))
+	log.Infof("slippage               \t[%v] bps", result.SlippageBps().StringFixed(2))
+}
+
+// ReportBalances prints balance of every asset in alphabetical order
+func ReportBalances(job string, balances map[string]decimal.Decimal) {
+	log := logrus.WithField("job", job)
+	for _, asset := range execution.SortedAssets(balances) {
+		log.Infof("balance                \t[%v] %v", balances[asset].StringFixed(8), asset)
+	}
+}
+
+// ReportTrade prints executed trade in single line, tagged with engine and pair
+func ReportTrade(engine string, trade order.Trade) {
+	logrus.WithFields(logrus.Fields{"engine": engine, "pair": trade.Pair}).Infof(
+		"trade #%v %v\t[%v] @ [%v] at %v",
+		trade.TradeID, trade.Side, trade.Size.StringFixed(8), trade.Price.StringFixed(8), trade.Time.UTC(),
+	)
+}
+
+// ReportHTTPStats prints request counters of API client in single line, tagged with engine and API URL
+func ReportHTTPStats(engine, apiURL string, stats coinbase.Stats) {
+	logrus.WithFields(logrus.Fields{"engine": engine, "api_url": apiURL}).Infof(
+		"http requests [%v] throttled [%v] for %v, rate limited [%v] retried [%v]",
+		stats.Requests, stats.Throttled, stats.ThrottledFor, stats.RateLimited, stats.Retries,
+	)
+}
+
+// ReportCandle prints OHLCV candle in single line, tagged with engine and pair
+func ReportCandle(engine string, c candle.Candle) {
+	logrus.WithFields(logrus.Fields{"engine": engine, "pair": c.Pair, "interval": c.Interval}).Infof(
+		"candle %v\tO[%v] H[%v] L[%v] C[%v] V[%v] VWAP[%v] trades[%v]",
+		c.Start.UTC(),
+		c.Open.StringFixed(8), c.High.StringFixed(8), c.Low.StringFixed(8), c.Close.StringFixed(8),
+		c.Volume.StringFixed(8), c.VWAP.StringFixed(8), c.TradeCount,
+	)
+}
+
+// ReportLadder pretty prints price impact of every rung in amount ladder
+// tagged with job name
+func ReportLadder(job string, book order.Book, rungs []order.Rung, inputAsset, outputAsset string) {
+	log := logrus.WithField("job", job)
+	log.Infof("---------------------%v---------------------------------------------", book.UpdatedAt.UTC())
+	log.Infof("%20v\t%20v\t%20v\t%20v\t%20v\t%12v", "amount ["+inputAsset+"]", "consumed", "got ["+outputAsset+"]", "avg price", "worst price", "slippage bps")
+	for _, rung := range rungs {
+		filled := ""
+		if !rung.Satisfied {
+			filled = "(insufficient depth)"
+		}
+		log.Infof("%20v\t%20v\t%20v\t%20v\t%20v\t%12v %v",
+			rung.Amount.StringFixed(8),
+			rung.Consumed.StringFixed(8),
+			rung.Matched.StringFixed(8),
+			rung.AvgPrice.StringFixed(8),
+			rung.WorstPrice.StringFixed(8),
+			rung.SlippageBps.StringFixed(2),
+			filled,
+		)
+	}
+	log.Infof("---------------------------------------------------------------------------------------------------------")
 }
 
 // we define byAsset parameter as string type, but if type system is expressive enough, it should be sum type of {inputAsset|outputAsset} variances
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/choestelus/super-duper-succotash/pkg/order"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportLimitBelowBestAsk(t *testing.T) {
+	r := require.New(t)
+	hook := test.NewGlobal()
+	defer logrus.StandardLogger().ReplaceHooks(make(logrus.LevelHooks))
+
+	book := order.Book{
+		Asks:      []order.Order{{Price: decimal.NewFromFloat(4000), Size: decimal.NewFromFloat(1)}},
+		UpdatedAt: time.Unix(1571299200, 0),
+	}
+	limit := decimal.NewFromFloat(3999)
+	amount := decimal.NewFromFloat(3000)
+	orders := order.WithinLimit("bid", book.Asks, limit)
+	r.Empty(orders)
+	consumed, matched := order.MatchUntilSatisfied("bid", orders, amount)
+
+	r.NotPanics(func() { Report("thin", book, amount, consumed, matched, "usd", "btc", &limit) })
+
+	messages := []string{}
+	for _, entry := range hook.AllEntries() {
+		messages = append(messages, entry.Message)
+	}
+	r.Contains(messages, "avg price              \t[n/a] nothing matched")
+	r.Contains(messages, "would rest             \t[3000.00000000] usd")
+}
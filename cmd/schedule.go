@@ -0,0 +1,131 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/choestelus/super-duper-succotash/cmd/config"
+	"github.com/choestelus/super-duper-succotash/pkg/candle"
+	"github.com/choestelus/super-duper-succotash/pkg/engine/coinbase"
+	"github.com/choestelus/super-duper-succotash/pkg/execution"
+	"github.com/choestelus/super-duper-succotash/pkg/order"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+// ScheduleExecution executes amount as child orders over --schedule-window,
+// see controlSchedule for pausing, resuming and stopping the schedule
+func ScheduleExecution(cfg config.Config) {
+	engine := AvailableEngines[cfg.Engine].Configure(cfg.EngineConfig)
+	base, quote := engine.AssetPair()
+	side, err := execution.SideOf(strings.ToLower(cfg.InputAsset), base, quote)
+	if err != nil {
+		logrus.Panic(err)
+	}
+
+	amount := decimal.RequireFromString(cfg.Amount)
+	start := time.Now()
+	slices := execution.TWAP(amount, start, cfg.ScheduleWindow, cfg.ScheduleSlices)
+	if cfg.Schedule == "vwap" {
+		step := cfg.ScheduleWindow / time.Duration(cfg.ScheduleSlices)
+		profile := mustVolumeProfile(cfg, engine, start, step)
+		slices = execution.VWAP(amount, start, cfg.ScheduleWindow, cfg.ScheduleSlices, profile)
+	}
+
+	fetcher, ok := engine.(order.BookFetcher)
+	if !ok {
+		logrus.Panicf("engine %v does not support fetching order book for schedule mode", cfg.Engine)
+	}
+	paper := mustOpenPaper(cfg)
+	scheduler := &execution.Scheduler{
+		Pair:     pairName(engine),
+		Side:     side,
+		DryRun:   cfg.DryRun,
+		Slices:   slices,
+		Executor: mustExecutor(cfg.Engine, engine, paper, cfg.DryRun),
+		Book: func() (order.Book, error) {
+			return fetcher.FetchBook(cfg.EngineConfig)
+		},
+		OnRetry: func(err error) {
+			logrus.WithField("job", cfg.Schedule).Warnf("retrying child order on next tick: %v", err)
+		},
+	}
+	if cfg.LimitPrice != "" {
+		scheduler.LimitPrice = decimal.RequireFromString(cfg.LimitPrice)
+	}
+	if cfg.ParticipationRate != "" {
+		scheduler.ParticipationRate = decimal.RequireFromString(cfg.ParticipationRate)
+		streamer, ok := engine.(order.TradeStreamer)
+		if !ok {
+			logrus.Panicf("engine %v does not support streaming trades for --participation-rate", cfg.Engine)
+		}
+		go func() {
+			for trade := range streamer.OpenTradeStream(cfg.EngineConfig) {
+				scheduler.AddTrade(trade)
+			}
+		}()
+	}
+
+	for _, slice := range slices {
+		logrus.Infof("[%v] scheduled child order at %v for [%v] %v", cfg.Schedule, slice.At.UTC(), slice.Amount.StringFixed(8), cfg.InputAsset)
+	}
+
+	stop := make(chan struct{})
+	controlSchedule(scheduler, stop)
+
+	err = scheduler.Run(stop, func(p execution.Progress) {
+		ReportProgress(cfg.Schedule, p, cfg.InputAsset, engine.PairOf(strings.ToLower(cfg.InputAsset)))
+	})
+	if paper != nil {
+		ReportBalances("paper", paper.Balances())
+	}
+	if err != nil {
+		// child orders already placed are not undone, report what is left to execute manually
+		p := scheduler.Progress()
+		logrus.WithField("job", cfg.Schedule).Errorf(
+			"aborted at [%v/%v] slices, spent [%v] received [%v] remaining [%v] %v",
+			p.Slice, p.Slices, p.Spent.StringFixed(8), p.Received.StringFixed(8), p.Remaining.StringFixed(8), cfg.InputAsset,
+		)
+		logrus.Panic(err)
+	}
+}
+
+// mustVolumeProfile builds volume profile by time of day from candles of --vwap-lookback
+// with the largest candle interval supported by engine that fits in step
+func mustVolumeProfile(cfg config.Config, engine order.BookStreamer, now time.Time, step time.Duration) map[time.Duration]decimal.Decimal {
+	fetcher, ok := engine.(candle.HistoryFetcher)
+	if !ok {
+		logrus.Panicf("engine %v does not support fetching historical candles for vwap schedule", cfg.Engine)
+	}
+	granularity := time.Minute
+	for _, g := range coinbase.Granularities {
+		if g := g.(time.Duration); g <= step && g > granularity {
+			granularity = g
+		}
+	}
+
+	candles := []candle.Candle{}
+	err := fetcher.FetchHistory(granularity, now.Add(-cfg.VWAPLookback), now, func(page []candle.Candle) error {
+		candles = append(candles, page...)
+		return nil
+	})
+	if err != nil {
+		logrus.Panic(err)
+	}
+	return execution.VolumeProfile(candles, step)
+}
+
+// ReportProgress prints progress of scheduled execution, and its latest child order
+func ReportProgress(schedule string, p execution.Progress, inputAsset, outputAsset string) {
+	if p.LastChild != nil {
+		ReportExecution(schedule, *p.LastChild)
+	}
+	log := logrus.WithField("job", schedule)
+	log.Infof("progress               \t[%v/%v] slices at %v", p.Slice, p.Slices, p.At.UTC())
+	log.Infof("spent                  \t[%v] of [%v] %v", p.Spent.StringFixed(8), p.Target.StringFixed(8), inputAsset)
+	log.Infof("received               \t[%v] %v", p.Received.StringFixed(8), outputAsset)
+	log.Infof("avg price              \t[%v]", p.AvgPrice.StringFixed(8))
+	if p.Done {
+		log.Infof("done, remaining        \t[%v] %v", p.Remaining.StringFixed(8), inputAsset)
+	}
+}
@@ -0,0 +1,35 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/choestelus/super-duper-succotash/pkg/execution"
+	"github.com/sirupsen/logrus"
+)
+
+// controlSchedule pauses scheduler on SIGUSR1 and resumes it on SIGUSR2,
+// interrupt closes stop
+func controlSchedule(scheduler *execution.Scheduler, stop chan struct{}) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2, os.Interrupt)
+	go func() {
+		for sig := range signals {
+			switch sig {
+			case syscall.SIGUSR1:
+				logrus.Info("schedule paused")
+				scheduler.Pause()
+			case syscall.SIGUSR2:
+				logrus.Info("schedule resumed")
+				scheduler.Resume()
+			default:
+				close(stop)
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,38 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"bufio"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/choestelus/super-duper-succotash/pkg/execution"
+	"github.com/sirupsen/logrus"
+)
+
+// controlSchedule pauses scheduler on "pause" and resumes it on "resume" read from stdin,
+// since there are no SIGUSR1 and SIGUSR2 on windows, interrupt closes stop
+func controlSchedule(scheduler *execution.Scheduler, stop chan struct{}) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	go func() {
+		<-signals
+		close(stop)
+	}()
+	go func() {
+		lines := bufio.NewScanner(os.Stdin)
+		for lines.Scan() {
+			switch strings.TrimSpace(lines.Text()) {
+			case "pause":
+				logrus.Info("schedule paused")
+				scheduler.Pause()
+			case "resume":
+				logrus.Info("schedule resumed")
+				scheduler.Resume()
+			}
+		}
+	}()
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+
+	"github.com/choestelus/super-duper-succotash/cmd/config"
+	"github.com/choestelus/super-duper-succotash/pkg/order"
+	"github.com/choestelus/super-duper-succotash/pkg/tui"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+// WatchLadder renders live depth ladder of every subscription from its order book stream,
+// keys switch between pairs and between amounts of their jobs
+func WatchLadder(cfg config.Config) {
+	subs := groupSubscriptions(cfg)
+	pairs := []*tui.Pair{}
+	for _, sub := range subs {
+		base, quote := sub.engine.AssetPair()
+		pair := &tui.Pair{Name: pairName(sub.engine), Base: base, Quote: quote}
+		for _, job := range sub.jobs {
+			for _, amount := range jobAmounts(job) {
+				pair.Targets = append(pair.Targets, tui.Target{InputAsset: strings.ToLower(job.InputAsset), Amount: amount})
+			}
+		}
+		pairs = append(pairs, pair)
+	}
+	model := tui.NewModel(pairs, cfg.TUIDepth)
+
+	term := &terminal{}
+	restore, err := tui.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		logrus.Warnf("%v, keys have to be followed by enter", err)
+	}
+	term.restore = restore
+	defer term.Restore()
+	// panic of book stream goroutines can not be recovered here,
+	// they are logged before panicking so terminal is restored by hook
+	logrus.AddHook(term)
+	// log lines would be drawn over ladder
+	logrus.SetOutput(ioutil.Discard)
+	fmt.Print(tui.HideCursor)
+
+	render := func() {
+		if err := model.Render(os.Stdout); err != nil {
+			logrus.Panic(err)
+		}
+	}
+	render()
+	// interrupt is only delivered as signal in line mode
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	keys := tui.ReadKeys(os.Stdin)
+	updates := mergeStreams(subs)
+	for {
+		select {
+		case <-stop:
+			return
+		case update := <-updates:
+			if model.Update(pairName(update.sub.engine), update.book) {
+				render()
+			}
+		case key, ok := <-keys:
+			if !ok || model.Key(key) {
+				return
+			}
+			render()
+		}
+	}
+}
+
+// terminal restores terminal mode and cursor once, either when WatchLadder returns or panics,
+// or when any goroutine logs at panic or fatal level
+type terminal struct {
+	once    sync.Once
+	restore func() error
+}
+
+// Restore restores terminal, restore function is nil in line mode
+func (t *terminal) Restore() {
+	t.once.Do(func() {
+		if t.restore != nil {
+			t.restore()
+		}
+		fmt.Print(tui.ShowCursor)
+	})
+}
+
+// Levels implements logrus.Hook
+func (t *terminal) Levels() []logrus.Level {
+	return []logrus.Level{logrus.PanicLevel, logrus.FatalLevel}
+}
+
+// Fire implements logrus.Hook, message is written to stderr since logs are discarded while ladder is shown
+func (t *terminal) Fire(entry *logrus.Entry) error {
+	t.Restore()
+	fmt.Fprintln(os.Stderr, entry.Message)
+	return nil
+}
+
+// jobAmounts returns amounts of job followed by amounts of its ladder
+func jobAmounts(job config.Job) []decimal.Decimal {
+	amounts := []decimal.Decimal{}
+	for _, amount := range job.Amounts {
+		amounts = append(amounts, decimal.RequireFromString(amount))
+	}
+	if job.Ladder != "" {
+		ladder, err := order.ParseLadder(job.Ladder)
+		if err != nil {
+			logrus.Panic(err)
+		}
+		amounts = append(amounts, ladder...)
+	}
+	return amounts
+}
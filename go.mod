@@ -4,14 +4,22 @@ go 1.13
 
 require (
 	emperror.dev/errors v0.4.3
+	github.com/BurntSushi/toml v0.3.1
 	github.com/asaskevich/govalidator v0.0.0-20190424111038-f61b66f89f4a // indirect
-	github.com/davecgh/go-spew v1.1.1
+	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/go-ozzo/ozzo-validation v3.6.0+incompatible
 	github.com/go-resty/resty/v2 v2.0.0
+	github.com/gorilla/websocket v1.4.1
 	github.com/jessevdk/go-flags v1.4.0
+	github.com/lib/pq v1.3.0
+	github.com/mattn/go-sqlite3 v1.14.6
 	github.com/mitchellh/mapstructure v1.1.2
 	github.com/shopspring/decimal v0.0.0-20190905144223-a36b5d85f337
 	github.com/sirupsen/logrus v1.4.2
-	github.com/stretchr/testify v1.4.0
+	github.com/stretchr/testify v1.5.1
+	github.com/xitongsys/parquet-go v1.5.5-0.20201110004701-b09c49d6d457
+	github.com/xitongsys/parquet-go-source v0.0.0-20200817004010-026bad9b25d0 // indirect
 	go.uber.org/multierr v1.2.0 // indirect
+	golang.org/x/sys v0.0.0-20200223170610-d5e6a3e2c0ae
+	gopkg.in/yaml.v2 v2.2.2
 )
@@ -0,0 +1,290 @@
+package alert
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/shopspring/decimal"
+)
+
+// supported metrics of rule
+const (
+	Spread    = "spread"
+	Depth     = "depth"
+	BidDepth  = "bid_depth"
+	AskDepth  = "ask_depth"
+	QuoteMove = "quote_move"
+)
+
+var percentMultiplier = decimal.New(100, 0)
+
+// Rule is condition on metric of order book parsed from expression in one of forms
+//
+//	spread > 20 bps [for 30s] [clear 15 bps]
+//	[bid|ask] depth within 50 bps < 10 btc [for 30s] [clear 12 btc]
+//	quote for 100 btc moved > 1% in 1m [for 0s] [clear 0.5%]
+//
+// Spread and moved thresholds are normalized into basis points, depth threshold is in base asset.
+// Rule fires once condition holds for For, and resolves only when value crosses Clear,
+// which defaults to Threshold.
+type Rule struct {
+	Name       string
+	Expression string
+	Metric     string
+	Op         string
+	Threshold  decimal.Decimal
+	Clear      decimal.Decimal
+	// Unit is asset of depth threshold
+	Unit string
+	// Within is distance from mid price of depth, in basis points
+	Within decimal.Decimal
+	// Amount and Asset are input of quote, Window is how far back quote is compared against
+	Amount decimal.Decimal
+	Asset  string
+	Window time.Duration
+	For    time.Duration
+}
+
+// tokens consumes whitespace separated words of expression
+type tokens struct {
+	words []string
+	pos   int
+}
+
+func (t *tokens) done() bool {
+	return t.pos >= len(t.words)
+}
+
+func (t *tokens) next() (string, error) {
+	if t.done() {
+		return "", fmt.Errorf("unexpected end of rule")
+	}
+	t.pos++
+	return t.words[t.pos-1], nil
+}
+
+func (t *tokens) peek() string {
+	if t.done() {
+		return ""
+	}
+	return t.words[t.pos]
+}
+
+func (t *tokens) expect(word string) error {
+	got, err := t.next()
+	if err != nil {
+		return err
+	}
+	if got != word {
+		return fmt.Errorf("expected %v, got %v", word, got)
+	}
+	return nil
+}
+
+func (t *tokens) number() (decimal.Decimal, error) {
+	word, err := t.next()
+	if err != nil {
+		return decimal.Zero, err
+	}
+	return decimal.NewFromString(word)
+}
+
+func (t *tokens) duration() (time.Duration, error) {
+	word, err := t.next()
+	if err != nil {
+		return 0, err
+	}
+	return time.ParseDuration(word)
+}
+
+func (t *tokens) op() (string, error) {
+	word, err := t.next()
+	if err != nil {
+		return "", err
+	}
+	switch word {
+	case ">", ">=", "<", "<=":
+		return word, nil
+	default:
+		return "", fmt.Errorf("expected comparison operator, got %v", word)
+	}
+}
+
+// bps reads number followed by either bps or % unit, and returns it in basis points
+func (t *tokens) bps() (decimal.Decimal, error) {
+	value, err := t.number()
+	if err != nil {
+		return value, err
+	}
+	unit, err := t.next()
+	if err != nil {
+		return value, err
+	}
+	switch unit {
+	case "bps":
+		return value, nil
+	case "%":
+		return value.Mul(percentMultiplier), nil
+	default:
+		return value, fmt.Errorf("expected bps or %%, got %v", unit)
+	}
+}
+
+// ParseRule parses rule expression, keywords and assets are case insensitive
+func ParseRule(name, expression string) (Rule, error) {
+	rule := Rule{Name: name, Expression: expression}
+	normalized := strings.ToLower(strings.Replace(expression, "%", " %", -1))
+	t := &tokens{words: strings.Fields(normalized)}
+	if err := rule.parse(t); err != nil {
+		return rule, errors.Wrapf(err, "[alert] malformed rule %v: %v", name, expression)
+	}
+	return rule, nil
+}
+
+func (r *Rule) parse(t *tokens) error {
+	word, err := t.next()
+	if err != nil {
+		return err
+	}
+	switch word {
+	case "spread":
+		r.Metric = Spread
+		err = r.parseSpread(t)
+	case "bid", "ask":
+		r.Metric = word + "_" + Depth
+		if err := t.expect("depth"); err != nil {
+			return err
+		}
+		err = r.parseDepth(t)
+	case "depth":
+		r.Metric = Depth
+		err = r.parseDepth(t)
+	case "quote":
+		r.Metric = QuoteMove
+		err = r.parseQuoteMove(t)
+	default:
+		return fmt.Errorf("unknown metric %v", word)
+	}
+	if err != nil {
+		return err
+	}
+
+	r.Clear = r.Threshold
+	for !t.done() {
+		word, _ := t.next()
+		switch word {
+		case "for":
+			if r.For, err = t.duration(); err != nil {
+				return err
+			}
+		case "clear":
+			if r.Clear, err = r.parseThreshold(t); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unexpected %v", word)
+		}
+	}
+	if r.Breached(r.Clear) && !r.Clear.Equal(r.Threshold) {
+		return fmt.Errorf("clear %v must not breach threshold %v", r.Clear, r.Threshold)
+	}
+	return nil
+}
+
+func (r *Rule) parseSpread(t *tokens) (err error) {
+	if r.Op, err = t.op(); err != nil {
+		return err
+	}
+	r.Threshold, err = r.parseThreshold(t)
+	return err
+}
+
+func (r *Rule) parseDepth(t *tokens) (err error) {
+	if err := t.expect("within"); err != nil {
+		return err
+	}
+	if r.Within, err = t.bps(); err != nil {
+		return err
+	}
+	if r.Op, err = t.op(); err != nil {
+		return err
+	}
+	if r.Threshold, err = t.number(); err != nil {
+		return err
+	}
+	r.Unit, err = t.next()
+	return err
+}
+
+func (r *Rule) parseQuoteMove(t *tokens) (err error) {
+	if err := t.expect("for"); err != nil {
+		return err
+	}
+	if r.Amount, err = t.number(); err != nil {
+		return err
+	}
+	if r.Asset, err = t.next(); err != nil {
+		return err
+	}
+	if err := t.expect("moved"); err != nil {
+		return err
+	}
+	if r.Op, err = t.op(); err != nil {
+		return err
+	}
+	if r.Threshold, err = t.bps(); err != nil {
+		return err
+	}
+	if err := t.expect("in"); err != nil {
+		return err
+	}
+	if r.Window, err = t.duration(); err != nil {
+		return err
+	}
+	if r.Window <= 0 {
+		return fmt.Errorf("window must be positive")
+	}
+	return nil
+}
+
+// parseThreshold reads threshold in unit of metric
+func (r *Rule) parseThreshold(t *tokens) (decimal.Decimal, error) {
+	if r.Metric == Spread || r.Metric == QuoteMove {
+		return t.bps()
+	}
+	value, err := t.number()
+	if err != nil {
+		return value, err
+	}
+	if unit, err := t.next(); err != nil || unit != r.Unit {
+		return value, fmt.Errorf("expected clear in %v", r.Unit)
+	}
+	return value, nil
+}
+
+// Breached reports whether value breaches rule threshold
+func (r Rule) Breached(value decimal.Decimal) bool {
+	return compare(r.Op, value, r.Threshold)
+}
+
+// Cleared reports whether value crosses back clear threshold of firing rule
+func (r Rule) Cleared(value decimal.Decimal) bool {
+	return !compare(r.Op, value, r.Clear)
+}
+
+func compare(op string, a, b decimal.Decimal) bool {
+	switch op {
+	case ">":
+		return a.GreaterThan(b)
+	case ">=":
+		return a.GreaterThanOrEqual(b)
+	case "<":
+		return a.LessThan(b)
+	case "<=":
+		return a.LessThanOrEqual(b)
+	default:
+		return false
+	}
+}
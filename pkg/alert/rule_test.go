@@ -0,0 +1,79 @@
+package alert
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+func d(s string) decimal.Decimal {
+	return decimal.RequireFromString(s)
+}
+
+func TestParseRule(t *testing.T) {
+	r := require.New(t)
+
+	rule, err := ParseRule("wide", "spread > 20 bps for 30s clear 15 bps")
+	r.NoError(err)
+	r.Equal(Spread, rule.Metric)
+	r.Equal(">", rule.Op)
+	r.Equal("20", rule.Threshold.String())
+	r.Equal("15", rule.Clear.String())
+	r.Equal(30*time.Second, rule.For)
+
+	rule, err = ParseRule("thin", "Depth within 50 bps < 10 BTC")
+	r.NoError(err)
+	r.Equal(Depth, rule.Metric)
+	r.Equal("50", rule.Within.String())
+	r.Equal("10", rule.Clear.String(), "clear defaults to threshold")
+	r.Equal("btc", rule.Unit)
+
+	rule, err = ParseRule("thin-bids", "bid depth within 0.5% <= 3 btc clear 4 btc")
+	r.NoError(err)
+	r.Equal(BidDepth, rule.Metric)
+	r.Equal("50", rule.Within.String())
+
+	rule, err = ParseRule("moved", "quote for 100 BTC moved > 1% in 1m")
+	r.NoError(err)
+	r.Equal(QuoteMove, rule.Metric)
+	r.Equal("100", rule.Amount.String())
+	r.Equal("btc", rule.Asset)
+	r.Equal("100", rule.Threshold.String())
+	r.Equal(time.Minute, rule.Window)
+
+	for _, expression := range []string{
+		"",
+		"volume > 1 btc",
+		"spread 20 bps",
+		"spread > 20",
+		"spread > 20 pips",
+		"spread > 20 bps for ever",
+		"spread > 20 bps clear 25 bps",
+		"depth within 50 bps < 10 btc clear 5 eth",
+		"depth < 10 btc",
+		"quote for 100 btc moved > 1%",
+		"quote for 100 btc moved > 1% in 0s",
+		"spread > 20 bps until 1m",
+	} {
+		_, err := ParseRule("bad", expression)
+		r.Error(err, expression)
+	}
+}
+
+func TestRuleBreachedAndCleared(t *testing.T) {
+	r := require.New(t)
+	rule, err := ParseRule("wide", "spread > 20 bps clear 15 bps")
+	r.NoError(err)
+	r.True(rule.Breached(d("21")))
+	r.False(rule.Breached(d("20")))
+	r.False(rule.Cleared(d("16")))
+	r.True(rule.Cleared(d("15")))
+
+	rule, err = ParseRule("thin", "depth within 50 bps < 10 btc clear 12 btc")
+	r.NoError(err)
+	r.True(rule.Breached(d("9")))
+	r.False(rule.Cleared(d("11")))
+	r.True(rule.Cleared(d("12")))
+}
@@ -0,0 +1,197 @@
+package alert
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/choestelus/super-duper-succotash/pkg/order"
+	"github.com/shopspring/decimal"
+)
+
+var bpsMultiplier = decimal.New(10000, 0)
+
+// alert states
+const (
+	Firing   = "firing"
+	Resolved = "resolved"
+)
+
+// Alert is state change of rule on pair
+type Alert struct {
+	Rule       string          `json:"rule"`
+	Expression string          `json:"expression"`
+	Pair       string          `json:"pair"`
+	State      string          `json:"state"`
+	Value      decimal.Decimal `json:"value"`
+	Threshold  decimal.Decimal `json:"threshold"`
+	At         time.Time       `json:"at"`
+}
+
+// Subject returns one line summary of alert
+func (a Alert) Subject() string {
+	return fmt.Sprintf("%v %v on %v: %v (value %v)", a.Rule, a.State, a.Pair, a.Expression, a.Value.StringFixed(8))
+}
+
+// sample is quote value at time
+type sample struct {
+	at    time.Time
+	value decimal.Decimal
+}
+
+// Watcher evaluates rule on every book of pair, with hysteresis and deduplication:
+// alert fires once when condition holds for rule duration, and is not repeated until
+// value crosses clear threshold and resolves. Fired alert is suppressed when previous
+// one was fired within Cooldown, its resolution is suppressed as well.
+type Watcher struct {
+	Rule     Rule
+	Pair     string
+	Cooldown time.Duration
+
+	base, quote  string
+	pendingSince time.Time
+	firing       bool
+	notified     bool
+	lastFired    time.Time
+	history      []sample
+}
+
+// NewWatcher returns watcher of rule on BASE-QUOTE pair,
+// depth unit and quote asset of rule must be assets of pair
+func NewWatcher(rule Rule, pair string, cooldown time.Duration) (*Watcher, error) {
+	parts := strings.Split(strings.ToLower(pair), "-")
+	if len(parts) != 2 {
+		return nil, errors.Wrapf(fmt.Errorf("pair must be in BASE-QUOTE format, got %v", pair), "[alert] unable to watch rule %v", rule.Name)
+	}
+	w := &Watcher{Rule: rule, Pair: strings.ToUpper(pair), Cooldown: cooldown, base: parts[0], quote: parts[1]}
+	switch rule.Metric {
+	case Depth, BidDepth, AskDepth:
+		if rule.Unit != w.base {
+			return nil, errors.Wrapf(fmt.Errorf("depth must be in %v, got %v", w.base, rule.Unit), "[alert] unable to watch rule %v", rule.Name)
+		}
+	case QuoteMove:
+		if rule.Asset != w.base && rule.Asset != w.quote {
+			return nil, errors.Wrapf(fmt.Errorf("quote asset %v is not in %v", rule.Asset, pair), "[alert] unable to watch rule %v", rule.Name)
+		}
+	}
+	return w, nil
+}
+
+// Evaluate updates state of rule with book, and returns alert when state changes
+// and is not deduplicated. Book without value of metric, e.g. with empty side, is skipped.
+func (w *Watcher) Evaluate(book order.Book) (Alert, bool) {
+	now := book.UpdatedAt
+	value, ok := w.value(book)
+	if !ok {
+		return Alert{}, false
+	}
+	alert := Alert{
+		Rule:       w.Rule.Name,
+		Expression: w.Rule.Expression,
+		Pair:       w.Pair,
+		Value:      value,
+		Threshold:  w.Rule.Threshold,
+		At:         now,
+	}
+
+	if w.firing {
+		if !w.Rule.Cleared(value) {
+			return alert, false
+		}
+		w.firing = false
+		w.pendingSince = time.Time{}
+		alert.State = Resolved
+		return alert, w.notified
+	}
+
+	if !w.Rule.Breached(value) {
+		w.pendingSince = time.Time{}
+		return alert, false
+	}
+	if w.pendingSince.IsZero() {
+		w.pendingSince = now
+	}
+	if now.Sub(w.pendingSince) < w.Rule.For {
+		return alert, false
+	}
+	w.firing = true
+	w.notified = w.lastFired.IsZero() || now.Sub(w.lastFired) >= w.Cooldown
+	if w.notified {
+		w.lastFired = now
+	}
+	alert.State = Firing
+	return alert, w.notified
+}
+
+// value returns current value of rule metric
+func (w *Watcher) value(book order.Book) (decimal.Decimal, bool) {
+	mid, err := book.MidPrice()
+	if err != nil {
+		return decimal.Zero, false
+	}
+	switch w.Rule.Metric {
+	case Spread:
+		return book.Asks[0].Price.Sub(book.Bids[0].Price).Div(mid).Mul(bpsMultiplier), true
+	case Depth:
+		return depthWithin(book, "bid", mid, w.Rule.Within).Add(depthWithin(book, "ask", mid, w.Rule.Within)), true
+	case BidDepth:
+		return depthWithin(book, "bid", mid, w.Rule.Within), true
+	case AskDepth:
+		return depthWithin(book, "ask", mid, w.Rule.Within), true
+	case QuoteMove:
+		return w.quoteMove(book)
+	default:
+		return decimal.Zero, false
+	}
+}
+
+// quoteMove returns absolute change of quote against quote of window ago, in basis points.
+// Until history covers window, change is taken against the oldest quote.
+func (w *Watcher) quoteMove(book order.Book) (decimal.Decimal, bool) {
+	current := w.quoteOf(book)
+	now := book.UpdatedAt
+	w.history = append(w.history, sample{at: now, value: current})
+	// keep the latest sample at or before window start as reference
+	cutoff := now.Add(-w.Rule.Window)
+	for len(w.history) > 1 && !w.history[1].at.After(cutoff) {
+		w.history = w.history[1:]
+	}
+	reference := w.history[0].value
+	if reference.IsZero() {
+		return decimal.Zero, false
+	}
+	return current.Sub(reference).Abs().Div(reference).Mul(bpsMultiplier), true
+}
+
+// quoteOf returns output of converting rule amount of asset against book
+func (w *Watcher) quoteOf(book order.Book) decimal.Decimal {
+	if w.Rule.Asset == w.base {
+		_, matched := order.MatchUntilSatisfied("ask", book.Bids, w.Rule.Amount)
+		return matched
+	}
+	_, matched := order.MatchUntilSatisfied("bid", book.Asks, w.Rule.Amount)
+	return matched
+}
+
+// depthWithin returns total size of side orders priced within bps of mid price
+func depthWithin(book order.Book, side string, mid, bps decimal.Decimal) decimal.Decimal {
+	distance := mid.Mul(bps).Div(bpsMultiplier)
+	depth := decimal.Zero
+	if side == "bid" {
+		for _, o := range book.Bids {
+			if o.Price.LessThan(mid.Sub(distance)) {
+				break
+			}
+			depth = depth.Add(o.Size)
+		}
+		return depth
+	}
+	for _, o := range book.Asks {
+		if o.Price.GreaterThan(mid.Add(distance)) {
+			break
+		}
+		depth = depth.Add(o.Size)
+	}
+	return depth
+}
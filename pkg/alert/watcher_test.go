@@ -0,0 +1,124 @@
+package alert
+
+import (
+	"testing"
+	"time"
+
+	"github.com/choestelus/super-duper-succotash/pkg/order"
+	"github.com/stretchr/testify/require"
+)
+
+var now = time.Date(2019, 10, 17, 0, 0, 0, 0, time.UTC)
+
+// book returns book with single bid and ask of size 1 at secs after now
+func book(bid, ask string, secs int) order.Book {
+	return order.Book{
+		Bids:      []order.Order{{Price: d(bid), Size: d("1")}},
+		Asks:      []order.Order{{Price: d(ask), Size: d("1")}},
+		UpdatedAt: now.Add(time.Duration(secs) * time.Second),
+	}
+}
+
+func newTestWatcher(t *testing.T, expression string, cooldown time.Duration) *Watcher {
+	rule, err := ParseRule("test", expression)
+	require.NoError(t, err)
+	w, err := NewWatcher(rule, "BTC-USD", cooldown)
+	require.NoError(t, err)
+	return w
+}
+
+func TestWatcherHysteresis(t *testing.T) {
+	r := require.New(t)
+	w := newTestWatcher(t, "spread > 20 bps for 30s clear 15 bps", 0)
+
+	// 99.9/100.1 is 20 bps spread, 99.85/100.15 is 30 bps
+	_, ok := w.Evaluate(book("99.85", "100.15", 0))
+	r.False(ok, "condition has to hold for 30s")
+	_, ok = w.Evaluate(book("99.9", "100.1", 10))
+	r.False(ok)
+	_, ok = w.Evaluate(book("99.85", "100.15", 20))
+	r.False(ok, "pending duration restarts after recovering")
+	_, ok = w.Evaluate(book("99.85", "100.15", 49))
+	r.False(ok)
+
+	alert, ok := w.Evaluate(book("99.85", "100.15", 50))
+	r.True(ok)
+	r.Equal(Firing, alert.State)
+	r.Equal("30", alert.Value.String())
+	r.Equal("BTC-USD", alert.Pair)
+
+	_, ok = w.Evaluate(book("99.85", "100.15", 60))
+	r.False(ok, "firing alert is not repeated")
+	_, ok = w.Evaluate(book("99.91", "100.09", 70))
+	r.False(ok, "18 bps is below threshold but not below clear")
+
+	alert, ok = w.Evaluate(book("99.925", "100.075", 80))
+	r.True(ok)
+	r.Equal(Resolved, alert.State)
+	r.Equal("15", alert.Value.String())
+}
+
+func TestWatcherCooldown(t *testing.T) {
+	r := require.New(t)
+	w := newTestWatcher(t, "spread > 20 bps", time.Minute)
+
+	alert, ok := w.Evaluate(book("99.85", "100.15", 0))
+	r.True(ok)
+	r.Equal(Firing, alert.State)
+	_, ok = w.Evaluate(book("99.95", "100.05", 10))
+	r.True(ok)
+
+	// flapping within cooldown is deduplicated, both firing and resolution
+	_, ok = w.Evaluate(book("99.85", "100.15", 20))
+	r.False(ok)
+	_, ok = w.Evaluate(book("99.95", "100.05", 30))
+	r.False(ok)
+
+	alert, ok = w.Evaluate(book("99.85", "100.15", 60))
+	r.True(ok)
+	r.Equal(Firing, alert.State)
+}
+
+func TestWatcherDepth(t *testing.T) {
+	r := require.New(t)
+	w := newTestWatcher(t, "depth within 50 bps < 3 btc", 0)
+
+	b := order.Book{
+		Bids:      []order.Order{{Price: d("99.9"), Size: d("1")}, {Price: d("99.6"), Size: d("1")}, {Price: d("99"), Size: d("5")}},
+		Asks:      []order.Order{{Price: d("100.1"), Size: d("0.5")}, {Price: d("101"), Size: d("5")}},
+		UpdatedAt: now,
+	}
+	// mid 100, within 99.5 and 100.5
+	alert, ok := w.Evaluate(b)
+	r.True(ok)
+	r.Equal("2.5", alert.Value.String())
+
+	_, err := NewWatcher(w.Rule, "ETH-USD", 0)
+	r.Error(err, "depth in btc of eth pair")
+
+	_, ok = w.Evaluate(order.Book{Bids: b.Bids, UpdatedAt: now})
+	r.False(ok, "book with empty side is skipped")
+}
+
+func TestWatcherQuoteMove(t *testing.T) {
+	r := require.New(t)
+	w := newTestWatcher(t, "quote for 1 btc moved > 1% in 1m", 0)
+
+	_, ok := w.Evaluate(book("100", "100.1", 0))
+	r.False(ok)
+	_, ok = w.Evaluate(book("100.5", "100.6", 30))
+	r.False(ok)
+
+	alert, ok := w.Evaluate(book("101.5", "101.6", 60))
+	r.True(ok)
+	r.Equal("150", alert.Value.String())
+
+	// reference moves along with window, 101.5 is compared against 100.5 at 30s
+	alert, ok = w.Evaluate(book("101.5", "101.6", 90))
+	r.True(ok)
+	r.Equal(Resolved, alert.State)
+	r.Equal("99.50", alert.Value.StringFixed(2))
+
+	_, err := NewWatcher(w.Rule, "ETH-USD", 0)
+	r.Error(err)
+}
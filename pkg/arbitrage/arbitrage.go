@@ -0,0 +1,157 @@
+package arbitrage
+
+import (
+	"time"
+
+	"github.com/choestelus/super-duper-succotash/pkg/order"
+	"github.com/shopspring/decimal"
+)
+
+var bpsMultiplier = decimal.New(10000, 0)
+
+// Opportunity is buying Size of base on BuyVenue and selling it on SellVenue at the same time.
+// Cost and Proceeds are in quote asset before fees, Profit is after taker fees of both venues.
+// EdgeBps is edge of top of books after fees, in basis points of best ask.
+type Opportunity struct {
+	Pair       string          `json:"pair"`
+	BuyVenue   string          `json:"buy_venue"`
+	SellVenue  string          `json:"sell_venue"`
+	BestAsk    decimal.Decimal `json:"best_ask"`
+	BestBid    decimal.Decimal `json:"best_bid"`
+	EdgeBps    decimal.Decimal `json:"edge_bps"`
+	Size       decimal.Decimal `json:"size"`
+	Cost       decimal.Decimal `json:"cost"`
+	Proceeds   decimal.Decimal `json:"proceeds"`
+	Profit     decimal.Decimal `json:"profit"`
+	DetectedAt time.Time       `json:"detected_at"`
+}
+
+// Detector watches books of the same pair on several venues, and detects when
+// best bid of one venue exceeds best ask of another by more than taker fees plus ThresholdBps
+type Detector struct {
+	Pair         string
+	ThresholdBps decimal.Decimal
+	// FeeBps is taker fee of each venue, DefaultFeeBps is used for venues not in map
+	FeeBps        map[string]decimal.Decimal
+	DefaultFeeBps decimal.Decimal
+	// MaxBookAge ignores books older than newest book by more than this, zero disables
+	MaxBookAge time.Duration
+
+	books map[string]order.Book
+}
+
+// NewDetector returns detector of pair
+func NewDetector(pair string, thresholdBps, defaultFeeBps decimal.Decimal) *Detector {
+	return &Detector{
+		Pair:          pair,
+		ThresholdBps:  thresholdBps,
+		FeeBps:        map[string]decimal.Decimal{},
+		DefaultFeeBps: defaultFeeBps,
+		books:         map[string]order.Book{},
+	}
+}
+
+// Update sets the latest book of venue and returns opportunities
+// between this venue and every other venue, in either direction
+func (d *Detector) Update(venue string, book order.Book) []Opportunity {
+	d.books[venue] = book
+	opportunities := []Opportunity{}
+	for other, otherBook := range d.books {
+		if other == venue || d.stale(book, otherBook) {
+			continue
+		}
+		if op, ok := d.detect(venue, book, other, otherBook); ok {
+			opportunities = append(opportunities, op)
+		}
+		if op, ok := d.detect(other, otherBook, venue, book); ok {
+			opportunities = append(opportunities, op)
+		}
+	}
+	return opportunities
+}
+
+func (d *Detector) stale(a, b order.Book) bool {
+	if d.MaxBookAge == 0 {
+		return false
+	}
+	age := a.UpdatedAt.Sub(b.UpdatedAt)
+	if age < 0 {
+		age = -age
+	}
+	return age > d.MaxBookAge
+}
+
+func (d *Detector) fee(venue string) decimal.Decimal {
+	if fee, ok := d.FeeBps[venue]; ok {
+		return fee
+	}
+	return d.DefaultFeeBps
+}
+
+// edgeBps returns edge of buying at ask with buy fee and selling at bid
+// with sell fee, in basis points of ask
+func edgeBps(ask, bid, buyFeeBps, sellFeeBps decimal.Decimal) decimal.Decimal {
+	one := decimal.New(1, 0)
+	proceeds := bid.Mul(one.Sub(sellFeeBps.Div(bpsMultiplier)))
+	cost := ask.Mul(one.Add(buyFeeBps.Div(bpsMultiplier)))
+	return proceeds.Sub(cost).Div(ask).Mul(bpsMultiplier)
+}
+
+// detect sizes opportunity of buying on buy venue asks and selling on sell venue bids.
+// Levels are walked while edge of marginal levels is above threshold, then total cost
+// and proceeds of the size are calculated by matching it against both books.
+func (d *Detector) detect(buyVenue string, buyBook order.Book, sellVenue string, sellBook order.Book) (Opportunity, bool) {
+	asks, bids := buyBook.Asks, sellBook.Bids
+	if len(asks) == 0 || len(bids) == 0 {
+		return Opportunity{}, false
+	}
+	buyFee, sellFee := d.fee(buyVenue), d.fee(sellVenue)
+
+	size := decimal.Zero
+	i, j := 0, 0
+	askLeft, bidLeft := asks[0].Size, bids[0].Size
+	for i < len(asks) && j < len(bids) {
+		if !edgeBps(asks[i].Price, bids[j].Price, buyFee, sellFee).GreaterThan(d.ThresholdBps) {
+			break
+		}
+		take := decimal.Min(askLeft, bidLeft)
+		size = size.Add(take)
+		askLeft, bidLeft = askLeft.Sub(take), bidLeft.Sub(take)
+		if !askLeft.IsPositive() {
+			if i++; i < len(asks) {
+				askLeft = asks[i].Size
+			}
+		}
+		if !bidLeft.IsPositive() {
+			if j++; j < len(bids) {
+				bidLeft = bids[j].Size
+			}
+		}
+	}
+	if !size.IsPositive() {
+		return Opportunity{}, false
+	}
+
+	// "ask" input is base amount, matched is quote amount of walked levels
+	_, cost := order.MatchUntilSatisfied("ask", asks, size)
+	_, proceeds := order.MatchUntilSatisfied("ask", bids, size)
+	fees := cost.Mul(buyFee).Add(proceeds.Mul(sellFee)).Div(bpsMultiplier)
+
+	detectedAt := buyBook.UpdatedAt
+	if sellBook.UpdatedAt.After(detectedAt) {
+		detectedAt = sellBook.UpdatedAt
+	}
+	return Opportunity{
+		Pair:       d.Pair,
+		BuyVenue:   buyVenue,
+		SellVenue:  sellVenue,
+		BestAsk:    asks[0].Price,
+		BestBid:    bids[0].Price,
+		EdgeBps:    edgeBps(asks[0].Price, bids[0].Price, buyFee, sellFee),
+		Size:       size,
+		Cost:       cost,
+		Proceeds:   proceeds,
+		Profit:     proceeds.Sub(cost).Sub(fees),
+		DetectedAt: detectedAt,
+	}, true
+}
@@ -0,0 +1,74 @@
+package arbitrage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/choestelus/super-duper-succotash/pkg/order"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+func d(s string) decimal.Decimal {
+	return decimal.RequireFromString(s)
+}
+
+var now = time.Date(2019, 10, 17, 0, 0, 0, 0, time.UTC)
+
+func book(bids, asks [][2]string, at time.Time) order.Book {
+	b := order.Book{UpdatedAt: at}
+	for _, o := range bids {
+		b.Bids = append(b.Bids, order.Order{Price: d(o[0]), Size: d(o[1])})
+	}
+	for _, o := range asks {
+		b.Asks = append(b.Asks, order.Order{Price: d(o[0]), Size: d(o[1])})
+	}
+	return b
+}
+
+func TestDetectorUpdate(t *testing.T) {
+	r := require.New(t)
+	detector := NewDetector("BTC-USD", d("10"), d("0"))
+
+	cheap := book([][2]string{{"99", "1"}}, [][2]string{{"100", "1"}, {"100.5", "1"}, {"103", "5"}}, now)
+	rich := book([][2]string{{"102", "1.5"}, {"101", "1"}, {"90", "5"}}, [][2]string{{"103", "1"}}, now)
+
+	r.Empty(detector.Update("cheap", cheap), "single venue has nothing to compare")
+	opportunities := detector.Update("rich", rich)
+	r.Len(opportunities, 1)
+
+	op := opportunities[0]
+	r.Equal("cheap", op.BuyVenue)
+	r.Equal("rich", op.SellVenue)
+	r.Equal("200", op.EdgeBps.String())
+	// 100x1 + 100.5x1 against 102x1.5 + 101x0.5, 103 ask and 90 bid are not profitable
+	r.Equal("2", op.Size.String())
+	r.Equal("200.5", op.Cost.String())
+	r.Equal("203.5", op.Proceeds.String())
+	r.Equal("3", op.Profit.String())
+}
+
+func TestDetectorFees(t *testing.T) {
+	r := require.New(t)
+	detector := NewDetector("BTC-USD", d("0"), d("50"))
+	cheap := book(nil, [][2]string{{"100", "1"}}, now)
+	rich := book([][2]string{{"100.9", "1"}}, nil, now)
+
+	detector.Update("cheap", cheap)
+	r.Empty(detector.Update("rich", rich), "90 bps spread does not cover 100 bps fees")
+
+	detector.FeeBps["rich"] = d("0")
+	opportunities := detector.Update("rich", rich)
+	r.Len(opportunities, 1)
+	r.Equal("0.4", opportunities[0].Profit.String())
+}
+
+func TestDetectorStaleBook(t *testing.T) {
+	r := require.New(t)
+	detector := NewDetector("BTC-USD", d("0"), d("0"))
+	detector.MaxBookAge = time.Second
+
+	detector.Update("cheap", book(nil, [][2]string{{"100", "1"}}, now))
+	r.Empty(detector.Update("rich", book([][2]string{{"110", "1"}}, nil, now.Add(time.Minute))))
+	r.Len(detector.Update("cheap", book(nil, [][2]string{{"100", "1"}}, now.Add(time.Minute))), 1)
+}
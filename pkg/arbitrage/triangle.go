@@ -0,0 +1,247 @@
+package arbitrage
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/choestelus/super-duper-succotash/pkg/order"
+	"github.com/shopspring/decimal"
+)
+
+// dust is the largest unfilled input of a leg still considered fully filled,
+// it absorbs rounding of division in matching functions
+var dust = decimal.New(1, -8)
+
+// searchSteps is number of bisection steps when searching for executable size
+const searchSteps = 32
+
+// Leg converts From asset into To asset on Pair, buying base of pair when From is its quote
+type Leg struct {
+	Pair string `json:"pair"`
+	From string `json:"from"`
+	To   string `json:"to"`
+	Buy  bool   `json:"buy"`
+}
+
+// Triangle is round trip from Start asset through legs back to Start asset within single exchange
+type Triangle struct {
+	Name   string
+	Start  string
+	Amount decimal.Decimal
+	Legs   []Leg
+}
+
+// NewTriangle resolves legs of round trip starting from start asset through pairs in order,
+// pairs are in BASE-QUOTE format and each pair must contain asset received from previous leg
+func NewTriangle(name, start string, amount decimal.Decimal, pairs []string) (Triangle, error) {
+	t := Triangle{Name: name, Start: strings.ToLower(start), Amount: amount}
+	if len(pairs) != 3 {
+		return t, errors.Wrapf(fmt.Errorf("need 3 pairs, got %v", len(pairs)), "[arbitrage] malformed triangle %v", name)
+	}
+	asset := t.Start
+	for _, pair := range pairs {
+		parts := strings.Split(strings.ToLower(pair), "-")
+		if len(parts) != 2 {
+			return t, errors.Wrapf(fmt.Errorf("pair must be in BASE-QUOTE format, got %v", pair), "[arbitrage] malformed triangle %v", name)
+		}
+		base, quote := parts[0], parts[1]
+		leg := Leg{Pair: strings.ToUpper(pair), From: asset}
+		switch asset {
+		case quote:
+			leg.To, leg.Buy = base, true
+		case base:
+			leg.To = quote
+		default:
+			return t, errors.Wrapf(fmt.Errorf("pair %v does not contain %v", pair, asset), "[arbitrage] malformed triangle %v", name)
+		}
+		t.Legs = append(t.Legs, leg)
+		asset = leg.To
+	}
+	if asset != t.Start {
+		return t, errors.Wrapf(fmt.Errorf("round trip ends at %v instead of %v", asset, t.Start), "[arbitrage] malformed triangle %v", name)
+	}
+	return t, nil
+}
+
+// Pairs returns pair of every leg
+func (t Triangle) Pairs() []string {
+	pairs := make([]string, len(t.Legs))
+	for i, leg := range t.Legs {
+		pairs[i] = leg.Pair
+	}
+	return pairs
+}
+
+// LegFill is result of matching input of leg against its book, Output is after fee
+type LegFill struct {
+	Leg
+	Input    decimal.Decimal `json:"input"`
+	Output   decimal.Decimal `json:"output"`
+	AvgPrice decimal.Decimal `json:"avg_price"`
+}
+
+// RoundTrip is opportunity of converting Size of start asset through every leg back into Output
+type RoundTrip struct {
+	Triangle   string          `json:"triangle"`
+	Start      string          `json:"start"`
+	Size       decimal.Decimal `json:"size"`
+	Output     decimal.Decimal `json:"output"`
+	ReturnBps  decimal.Decimal `json:"return_bps"`
+	Legs       []LegFill       `json:"legs"`
+	DetectedAt time.Time       `json:"detected_at"`
+}
+
+// Match converts amount of start asset through books of every leg in sequence,
+// taker fee in basis points is deducted from output of each leg.
+// Returns false when any book is missing or too shallow to fill the leg.
+func (t Triangle) Match(books map[string]order.Book, feeBps, amount decimal.Decimal) (RoundTrip, bool) {
+	trip := RoundTrip{Triangle: t.Name, Start: t.Start, Size: amount}
+	keep := decimal.New(1, 0).Sub(feeBps.Div(bpsMultiplier))
+	input := amount
+	for _, leg := range t.Legs {
+		book, ok := books[leg.Pair]
+		if !ok {
+			return trip, false
+		}
+		// buying spends quote against asks, selling spends base against bids
+		consumed, matched := order.MatchUntilSatisfied("ask", book.Bids, input)
+		size, value := consumed, matched
+		if leg.Buy {
+			consumed, matched = order.MatchUntilSatisfied("bid", book.Asks, input)
+			size, value = matched, consumed
+		}
+		if !input.Sub(consumed).LessThanOrEqual(dust) || !size.IsPositive() {
+			return trip, false
+		}
+		output := matched.Mul(keep)
+		trip.Legs = append(trip.Legs, LegFill{Leg: leg, Input: input, Output: output, AvgPrice: value.Div(size)})
+		input = output
+	}
+	trip.Output = input
+	trip.ReturnBps = input.Sub(amount).Div(amount).Mul(bpsMultiplier)
+	return trip, true
+}
+
+// TriangleScanner watches books of every leg of triangles on single exchange, and detects
+// round trips of which return after fees exceeds ThresholdBps
+type TriangleScanner struct {
+	Triangles    []Triangle
+	ThresholdBps decimal.Decimal
+	FeeBps       decimal.Decimal
+	// MaxBookAge ignores triangles whose leg books differ in age by more than this, zero disables
+	MaxBookAge time.Duration
+
+	books map[string]order.Book
+}
+
+// NewTriangleScanner returns scanner of triangles
+func NewTriangleScanner(triangles []Triangle, thresholdBps, feeBps decimal.Decimal) *TriangleScanner {
+	return &TriangleScanner{
+		Triangles:    triangles,
+		ThresholdBps: thresholdBps,
+		FeeBps:       feeBps,
+		books:        map[string]order.Book{},
+	}
+}
+
+// Pairs returns every distinct pair of triangles, in order of first appearance
+func (s *TriangleScanner) Pairs() []string {
+	pairs := []string{}
+	seen := map[string]bool{}
+	for _, t := range s.Triangles {
+		for _, pair := range t.Pairs() {
+			if !seen[pair] {
+				seen[pair] = true
+				pairs = append(pairs, pair)
+			}
+		}
+	}
+	return pairs
+}
+
+// Update sets the latest book of pair and returns opportunities of
+// every triangle with a leg on this pair
+func (s *TriangleScanner) Update(pair string, book order.Book) []RoundTrip {
+	pair = strings.ToUpper(pair)
+	s.books[pair] = book
+	trips := []RoundTrip{}
+	for _, t := range s.Triangles {
+		if !s.involves(t, pair) || s.stale(t) {
+			continue
+		}
+		if trip, ok := s.scan(t); ok {
+			trips = append(trips, trip)
+		}
+	}
+	return trips
+}
+
+func (s *TriangleScanner) involves(t Triangle, pair string) bool {
+	for _, p := range t.Pairs() {
+		if p == pair {
+			return true
+		}
+	}
+	return false
+}
+
+// stale reports whether books of legs are missing or too far apart in time
+func (s *TriangleScanner) stale(t Triangle) bool {
+	var oldest, newest time.Time
+	for i, pair := range t.Pairs() {
+		book, ok := s.books[pair]
+		if !ok {
+			return true
+		}
+		if i == 0 || book.UpdatedAt.Before(oldest) {
+			oldest = book.UpdatedAt
+		}
+		if i == 0 || book.UpdatedAt.After(newest) {
+			newest = book.UpdatedAt
+		}
+	}
+	return s.MaxBookAge != 0 && newest.Sub(oldest) > s.MaxBookAge
+}
+
+// scan returns round trip of triangle amount when its return exceeds threshold,
+// otherwise the largest smaller executable size of which return still exceeds threshold.
+// Return does not increase with size since deeper levels have worse prices.
+func (s *TriangleScanner) scan(t Triangle) (RoundTrip, bool) {
+	profitable := func(amount decimal.Decimal) (RoundTrip, bool) {
+		trip, ok := t.Match(s.books, s.FeeBps, amount)
+		return trip, ok && trip.ReturnBps.GreaterThan(s.ThresholdBps)
+	}
+	if trip, ok := profitable(t.Amount); ok {
+		trip.DetectedAt = s.detectedAt(t)
+		return trip, true
+	}
+
+	var best RoundTrip
+	found := false
+	low, high := decimal.Zero, t.Amount
+	for i := 0; i < searchSteps; i++ {
+		mid := low.Add(high).Div(decimal.New(2, 0)).Truncate(8)
+		if !mid.GreaterThan(low) {
+			break
+		}
+		if trip, ok := profitable(mid); ok {
+			best, found, low = trip, true, mid
+			continue
+		}
+		high = mid
+	}
+	best.DetectedAt = s.detectedAt(t)
+	return best, found
+}
+
+func (s *TriangleScanner) detectedAt(t Triangle) time.Time {
+	var newest time.Time
+	for _, pair := range t.Pairs() {
+		if at := s.books[pair].UpdatedAt; at.After(newest) {
+			newest = at
+		}
+	}
+	return newest
+}
@@ -0,0 +1,104 @@
+package arbitrage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTriangle(t *testing.T) {
+	r := require.New(t)
+	triangle, err := NewTriangle("usd-btc-eth", "USD", d("1000"), []string{"BTC-USD", "eth-btc", "ETH-USD"})
+	r.NoError(err)
+	r.Equal([]Leg{
+		{Pair: "BTC-USD", From: "usd", To: "btc", Buy: true},
+		{Pair: "ETH-BTC", From: "btc", To: "eth", Buy: true},
+		{Pair: "ETH-USD", From: "eth", To: "usd", Buy: false},
+	}, triangle.Legs)
+
+	_, err = NewTriangle("short", "usd", d("1"), []string{"BTC-USD", "ETH-BTC"})
+	r.Error(err)
+	_, err = NewTriangle("disconnected", "usd", d("1"), []string{"BTC-USD", "ETH-USD", "ETH-BTC"})
+	r.Error(err, "ETH-USD does not contain btc")
+	_, err = NewTriangle("open", "usd", d("1"), []string{"BTC-USD", "ETH-BTC", "ETH-BTC"})
+	r.Error(err, "round trip ends at btc")
+	_, err = NewTriangle("malformed", "usd", d("1"), []string{"BTCUSD", "ETH-BTC", "ETH-USD"})
+	r.Error(err)
+}
+
+func newTestScanner(t *testing.T, amount, thresholdBps, feeBps string) *TriangleScanner {
+	triangle, err := NewTriangle("usd-btc-eth", "usd", d(amount), []string{"BTC-USD", "ETH-BTC", "ETH-USD"})
+	require.NoError(t, err)
+	return NewTriangleScanner([]Triangle{triangle}, d(thresholdBps), d(feeBps))
+}
+
+// feed updates scanner with books where 1000 usd buys 10 btc, which buys 100 eth,
+// and first 50 eth sell at 10.5 usd, the rest at 10 usd
+func feed(s *TriangleScanner) []RoundTrip {
+	s.Update("BTC-USD", book(nil, [][2]string{{"100", "10"}}, now))
+	s.Update("ETH-BTC", book(nil, [][2]string{{"0.1", "200"}}, now))
+	return s.Update("ETH-USD", book([][2]string{{"10.5", "50"}, {"10", "100"}}, nil, now))
+}
+
+func TestTriangleScannerUpdate(t *testing.T) {
+	r := require.New(t)
+	s := newTestScanner(t, "1000", "100", "0")
+	r.Equal([]string{"BTC-USD", "ETH-BTC", "ETH-USD"}, s.Pairs())
+
+	r.Empty(s.Update("BTC-USD", book(nil, [][2]string{{"100", "10"}}, now)), "other legs have no book yet")
+	trips := feed(s)
+	r.Len(trips, 1)
+
+	trip := trips[0]
+	r.Equal("1000", trip.Size.String())
+	r.Equal("1025", trip.Output.String())
+	r.Equal("250", trip.ReturnBps.String())
+	r.Equal(now, trip.DetectedAt)
+	r.Len(trip.Legs, 3)
+	r.Equal("10", trip.Legs[0].Output.String())
+	r.Equal("100", trip.Legs[1].Output.String())
+	r.Equal("10.25", trip.Legs[2].AvgPrice.String())
+}
+
+func TestTriangleScannerFees(t *testing.T) {
+	r := require.New(t)
+	trips := feed(newTestScanner(t, "1000", "100", "10"))
+	r.Len(trips, 1)
+	r.Equal("9.99", trips[0].Legs[0].Output.String())
+	r.Equal("99.8001", trips[0].Legs[1].Output.String())
+	r.Equal("1021.977999", trips[0].Output.String())
+	r.Equal("219.77999", trips[0].ReturnBps.String())
+
+	r.Empty(feed(newTestScanner(t, "1000", "0", "200")), "fees eat the edge")
+}
+
+func TestTriangleScannerExecutableSize(t *testing.T) {
+	r := require.New(t)
+
+	// return of x usd above 500 is 25/x, which is above 300 bps below 833.33 usd
+	trips := feed(newTestScanner(t, "1000", "300", "0"))
+	r.Len(trips, 1)
+	r.True(trips[0].Size.LessThan(d("833.33333334")), trips[0].Size.String())
+	r.True(trips[0].Size.GreaterThan(d("833.33")), trips[0].Size.String())
+	r.True(trips[0].ReturnBps.GreaterThan(d("300")))
+
+	// BTC-USD asks only fill 1000 usd
+	trips = feed(newTestScanner(t, "2000", "0", "0"))
+	r.Len(trips, 1)
+	r.True(trips[0].Size.LessThanOrEqual(d("1000")), trips[0].Size.String())
+	r.True(trips[0].Size.GreaterThan(d("999.99")), trips[0].Size.String())
+
+	r.Empty(feed(newTestScanner(t, "1000", "600", "0")), "top of books is below threshold")
+}
+
+func TestTriangleScannerStale(t *testing.T) {
+	r := require.New(t)
+	s := newTestScanner(t, "1000", "0", "0")
+	s.MaxBookAge = time.Second
+	feed(s)
+
+	r.Empty(s.Update("ETH-USD", book([][2]string{{"10.5", "50"}, {"10", "100"}}, nil, now.Add(time.Minute))))
+	s.Update("BTC-USD", book(nil, [][2]string{{"100", "10"}}, now.Add(time.Minute)))
+	r.Len(s.Update("ETH-BTC", book(nil, [][2]string{{"0.1", "200"}}, now.Add(time.Minute))), 1)
+}
@@ -0,0 +1,255 @@
+package candle
+
+import (
+	"sort"
+	"time"
+
+	"github.com/choestelus/super-duper-succotash/pkg/order"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+// Candle holds OHLCV bar of trades within [Start, Start+Interval)
+// VWAP and TradeCount are zero for candles backfilled from exchange
+// which does not provide them
+type Candle struct {
+	Pair        string          `json:"pair"`
+	Start       time.Time       `json:"start"`
+	Interval    time.Duration   `json:"interval"`
+	Open        decimal.Decimal `json:"open"`
+	High        decimal.Decimal `json:"high"`
+	Low         decimal.Decimal `json:"low"`
+	Close       decimal.Decimal `json:"close"`
+	Volume      decimal.Decimal `json:"volume"`
+	QuoteVolume decimal.Decimal `json:"quote_volume"`
+	VWAP        decimal.Decimal `json:"vwap"`
+	TradeCount  int64           `json:"trade_count"`
+}
+
+// Backfiller is implemented by engines that can fetch historical candles
+// of configured pair, so charts are not blank right after started
+type Backfiller interface {
+	Backfill(interval time.Duration, since time.Time) ([]Candle, error)
+}
+
+// bucket is candle being built, open and close are decided by trade time
+// since trades can arrive out of order
+// and bucket seeded from backfilled candle keeps its open
+type bucket struct {
+	Candle
+	first  time.Time
+	last   time.Time
+	seeded bool
+}
+
+func (b *bucket) add(trade order.Trade) {
+	empty := b.TradeCount == 0 && !b.seeded
+	if empty || trade.Time.Before(b.first) {
+		b.Open = trade.Price
+		b.first = trade.Time
+	}
+	if empty || !trade.Time.Before(b.last) {
+		b.Close = trade.Price
+		b.last = trade.Time
+	}
+	if empty || trade.Price.GreaterThan(b.High) {
+		b.High = trade.Price
+	}
+	if empty || trade.Price.LessThan(b.Low) {
+		b.Low = trade.Price
+	}
+	b.Volume = b.Volume.Add(trade.Size)
+	b.QuoteVolume = b.QuoteVolume.Add(trade.Volume())
+	b.TradeCount++
+}
+
+// Aggregator builds candles of single interval from trades.
+// Candle is emitted once trade time, or wall clock passed to FlushUntil, passes its end by Lateness,
+// trades arriving within Lateness are still counted, later ones are dropped and counted in Dropped.
+// Intervals without trade are emitted as flat candle at previous close.
+type Aggregator struct {
+	Interval time.Duration
+	Lateness time.Duration
+	Dropped  int64
+
+	pair      string
+	buckets   map[int64]*bucket
+	next      time.Time
+	latest    time.Time
+	lastClose decimal.Decimal
+}
+
+// NewAggregator returns aggregator of supplied interval and allowed lateness
+func NewAggregator(interval, lateness time.Duration) *Aggregator {
+	return &Aggregator{
+		Interval: interval,
+		Lateness: lateness,
+		buckets:  map[int64]*bucket{},
+	}
+}
+
+// Backfill seeds aggregator with historical candles, returns candles
+// that are accepted in order of start time. The last backfilled candle is
+// still open, so it is not returned but continued by trades of its interval
+// and emitted once complete. Trades before its start are dropped afterward.
+func (a *Aggregator) Backfill(candles []Candle) []Candle {
+	sorted := make([]Candle, len(candles))
+	copy(sorted, candles)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start.Before(sorted[j].Start) })
+
+	accepted := []Candle{}
+	for _, c := range sorted {
+		if !a.next.IsZero() && c.Start.Before(a.next) {
+			continue
+		}
+		c.Interval = a.Interval
+		accepted = append(accepted, c)
+		a.next = c.Start.Add(a.Interval)
+		a.lastClose = c.Close
+		a.pair = c.Pair
+	}
+	if len(accepted) == 0 {
+		return accepted
+	}
+
+	open := accepted[len(accepted)-1]
+	a.next = open.Start
+	a.seed(open)
+	return accepted[:len(accepted)-1]
+}
+
+// seed continues building c from trades, quote volume is approximated
+// by typical price when exchange does not provide it
+func (a *Aggregator) seed(c Candle) {
+	if c.QuoteVolume.IsZero() && !c.Volume.IsZero() {
+		typical := c.High.Add(c.Low).Add(c.Close).Div(decimal.New(3, 0))
+		c.QuoteVolume = c.Volume.Mul(typical)
+	}
+	a.buckets[c.Start.UnixNano()] = &bucket{Candle: c, first: c.Start, last: c.Start, seeded: true}
+}
+
+// Add adds trade to its candle and returns candles finalized by this trade
+func (a *Aggregator) Add(trade order.Trade) []Candle {
+	start := trade.Time.UTC().Truncate(a.Interval)
+	if a.next.IsZero() {
+		a.next = start
+	}
+	if start.Before(a.next) {
+		a.Dropped++
+		logrus.Warnf("[candle] dropped late trade #%v at %v, candle %v is already emitted", trade.TradeID, trade.Time.UTC(), start)
+		return nil
+	}
+	if a.pair == "" {
+		a.pair = trade.Pair
+	}
+
+	b, ok := a.buckets[start.UnixNano()]
+	if !ok {
+		b = &bucket{Candle: Candle{Pair: trade.Pair, Start: start, Interval: a.Interval}}
+		a.buckets[start.UnixNano()] = b
+	}
+	b.add(trade)
+
+	if trade.Time.After(a.latest) {
+		a.latest = trade.Time
+	}
+	return a.emitUntil(a.latest.Add(-a.Lateness))
+}
+
+// FlushUntil emits candles which ended by Lateness before now, so candles are emitted
+// while market is quiet instead of waiting for the next trade
+func (a *Aggregator) FlushUntil(now time.Time) []Candle {
+	return a.emitUntil(now.Add(-a.Lateness))
+}
+
+// Flush emits every pending candle regardless of lateness
+func (a *Aggregator) Flush() []Candle {
+	end := a.next
+	for key := range a.buckets {
+		start := time.Unix(0, key).UTC().Add(a.Interval)
+		if start.After(end) {
+			end = start
+		}
+	}
+	return a.emitUntil(end)
+}
+
+// emitUntil emits candles which end at or before watermark, in order
+func (a *Aggregator) emitUntil(watermark time.Time) []Candle {
+	emitted := []Candle{}
+	for !a.next.IsZero() && !a.next.Add(a.Interval).After(watermark) {
+		emitted = append(emitted, a.pop(a.next))
+		a.next = a.next.Add(a.Interval)
+	}
+	return emitted
+}
+
+// pop removes candle starting at start, or returns flat candle
+// at previous close when there is no trade in interval
+func (a *Aggregator) pop(start time.Time) Candle {
+	b, ok := a.buckets[start.UnixNano()]
+	if !ok {
+		return Candle{
+			Pair:     a.pair,
+			Start:    start,
+			Interval: a.Interval,
+			Open:     a.lastClose,
+			High:     a.lastClose,
+			Low:      a.lastClose,
+			Close:    a.lastClose,
+			VWAP:     a.lastClose,
+		}
+	}
+	delete(a.buckets, start.UnixNano())
+	c := b.Candle
+	c.VWAP = c.Close
+	if !c.Volume.IsZero() {
+		c.VWAP = c.QuoteVolume.Div(c.Volume)
+	}
+	a.lastClose = c.Close
+	return c
+}
+
+// Stream feeds every trade to all aggregators and emits finalized candles on returned channel
+// backfilled candles should be passed to Aggregator.Backfill before streaming.
+// Aggregators are also flushed by wall clock at the smallest interval, at most every second.
+// Pending candles are flushed when trades channel is closed.
+func Stream(trades <-chan order.Trade, aggregators ...*Aggregator) <-chan Candle {
+	period := time.Second
+	for _, a := range aggregators {
+		if a.Interval < period {
+			period = a.Interval
+		}
+	}
+
+	candles := make(chan Candle)
+	emit := func(emitted []Candle) {
+		for _, c := range emitted {
+			candles <- c
+		}
+	}
+	go func() {
+		defer close(candles)
+		ticker := time.NewTicker(period)
+		defer ticker.Stop()
+		for {
+			select {
+			case trade, ok := <-trades:
+				if !ok {
+					for _, a := range aggregators {
+						emit(a.Flush())
+					}
+					return
+				}
+				for _, a := range aggregators {
+					emit(a.Add(trade))
+				}
+			case now := <-ticker.C:
+				for _, a := range aggregators {
+					emit(a.FlushUntil(now))
+				}
+			}
+		}
+	}()
+	return candles
+}
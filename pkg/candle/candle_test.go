@@ -0,0 +1,190 @@
+package candle
+
+import (
+	"testing"
+	"time"
+
+	"github.com/choestelus/super-duper-succotash/pkg/order"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+var t0 = time.Date(2019, 10, 17, 0, 0, 0, 0, time.UTC)
+
+func trade(id int64, offset time.Duration, price, size string) order.Trade {
+	return order.Trade{
+		TradeID: id,
+		Pair:    "BTC-USD",
+		Price:   decimal.RequireFromString(price),
+		Size:    decimal.RequireFromString(size),
+		Time:    t0.Add(offset),
+	}
+}
+
+func TestAggregator(t *testing.T) {
+	r := require.New(t)
+	a := NewAggregator(time.Minute, 10*time.Second)
+
+	r.Empty(a.Add(trade(1, 5*time.Second, "100", "1")))
+	r.Empty(a.Add(trade(2, 30*time.Second, "110", "1")))
+	// still within lateness of first minute
+	r.Empty(a.Add(trade(4, 65*time.Second, "120", "2")))
+	// late trade arrives out of order, earlier than trade #1
+	r.Empty(a.Add(trade(0, 1*time.Second, "90", "2")))
+
+	emitted := a.Add(trade(5, 3*time.Minute+15*time.Second, "130", "1"))
+	r.Len(emitted, 3)
+
+	first := emitted[0]
+	r.Equal(t0, first.Start)
+	r.True(decimal.RequireFromString("90").Equals(first.Open))
+	r.True(decimal.RequireFromString("110").Equals(first.High))
+	r.True(decimal.RequireFromString("90").Equals(first.Low))
+	r.True(decimal.RequireFromString("110").Equals(first.Close))
+	r.True(decimal.RequireFromString("4").Equals(first.Volume))
+	// (90*2 + 100 + 110) / 4
+	r.True(decimal.RequireFromString("97.5").Equals(first.VWAP))
+	r.Equal(int64(3), first.TradeCount)
+
+	r.Equal(int64(1), emitted[1].TradeCount)
+
+	// empty interval is flat at previous close
+	empty := emitted[2]
+	r.Equal(t0.Add(2*time.Minute), empty.Start)
+	r.Equal(int64(0), empty.TradeCount)
+	r.True(decimal.RequireFromString("120").Equals(empty.Open))
+	r.True(decimal.RequireFromString("120").Equals(empty.Close))
+	r.True(empty.Volume.IsZero())
+
+	// trade of already emitted candle is dropped
+	r.Empty(a.Add(trade(3, 50*time.Second, "1", "1")))
+	r.Equal(int64(1), a.Dropped)
+
+	flushed := a.Flush()
+	r.Len(flushed, 1)
+	r.Equal(t0.Add(3*time.Minute), flushed[0].Start)
+}
+
+func TestAggregatorBackfill(t *testing.T) {
+	r := require.New(t)
+	a := NewAggregator(time.Minute, 0)
+	accepted := a.Backfill([]Candle{
+		{Pair: "BTC-USD", Start: t0.Add(time.Minute), Close: decimal.RequireFromString("101")},
+		{Pair: "BTC-USD", Start: t0, Close: decimal.RequireFromString("100")},
+	})
+	r.Len(accepted, 1, "last candle is still open")
+	r.Equal(t0, accepted[0].Start)
+
+	// trade within emitted backfilled candle is dropped
+	r.Empty(a.Add(trade(1, 30*time.Second, "100", "1")))
+	r.Equal(int64(1), a.Dropped)
+
+	emitted := a.Add(trade(2, 3*time.Minute, "105", "1"))
+	r.Len(emitted, 2)
+	r.Equal(t0.Add(time.Minute), emitted[0].Start)
+	r.Equal(t0.Add(2*time.Minute), emitted[1].Start)
+	r.True(decimal.RequireFromString("101").Equals(emitted[1].Close))
+}
+
+func TestAggregatorBackfillOpenCandle(t *testing.T) {
+	r := require.New(t)
+	a := NewAggregator(time.Minute, 0)
+	accepted := a.Backfill([]Candle{{
+		Pair:   "BTC-USD",
+		Start:  t0,
+		Open:   decimal.RequireFromString("100"),
+		High:   decimal.RequireFromString("102"),
+		Low:    decimal.RequireFromString("99"),
+		Close:  decimal.RequireFromString("101"),
+		Volume: decimal.RequireFromString("3"),
+	}})
+	r.Empty(accepted)
+
+	// live trade shares interval of the last backfilled candle
+	r.Empty(a.Add(trade(1, 40*time.Second, "98", "1")))
+	r.Empty(a.Add(trade(2, 50*time.Second, "100.5", "1")))
+	r.Zero(a.Dropped)
+
+	emitted := a.Add(trade(3, 70*time.Second, "103", "1"))
+	r.Len(emitted, 1)
+	c := emitted[0]
+	r.Equal(t0, c.Start)
+	r.True(decimal.RequireFromString("100").Equals(c.Open), "open is kept from backfill")
+	r.True(decimal.RequireFromString("102").Equals(c.High))
+	r.True(decimal.RequireFromString("98").Equals(c.Low))
+	r.True(decimal.RequireFromString("100.5").Equals(c.Close))
+	r.True(decimal.RequireFromString("5").Equals(c.Volume))
+	r.Equal(int64(2), c.TradeCount)
+	// (3 * (102+99+101)/3 + 98 + 100.5) / 5
+	r.True(decimal.RequireFromString("100.1").Equals(c.VWAP), c.VWAP.String())
+}
+
+func TestAggregatorFlushUntil(t *testing.T) {
+	r := require.New(t)
+	a := NewAggregator(time.Minute, 10*time.Second)
+	r.Empty(a.Add(trade(1, 0, "100", "1")))
+	r.Empty(a.FlushUntil(t0.Add(65*time.Second)), "candle waits for lateness")
+	candles := a.FlushUntil(t0.Add(70 * time.Second))
+	r.Len(candles, 1)
+	r.Equal(int64(1), candles[0].TradeCount)
+
+	// no trade during gap, flat candles are emitted by wall clock
+	candles = a.FlushUntil(t0.Add(3*time.Minute + 10*time.Second))
+	r.Len(candles, 2)
+	for _, c := range candles {
+		r.Zero(c.TradeCount)
+		r.True(decimal.RequireFromString("100").Equals(c.Close), "flat candle at previous close")
+	}
+
+	// no later trade, the last candle is emitted by wall clock
+	r.Empty(a.Add(trade(2, 3*time.Minute+30*time.Second, "101", "1")))
+	candles = a.FlushUntil(t0.Add(4*time.Minute + 10*time.Second))
+	r.Len(candles, 1)
+	r.True(decimal.RequireFromString("101").Equals(candles[0].Close))
+
+	r.Empty(a.Add(trade(3, 3*time.Minute+59*time.Second, "102", "1")))
+	r.Equal(int64(1), a.Dropped, "trade of candle flushed by wall clock is late")
+}
+
+func TestStreamQuietMarket(t *testing.T) {
+	r := require.New(t)
+	now := time.Now().UTC()
+	trades := make(chan order.Trade)
+	defer close(trades)
+	candles := Stream(trades, NewAggregator(50*time.Millisecond, 0))
+	trades <- order.Trade{TradeID: 1, Pair: "BTC-USD", Price: decimal.New(100, 0), Size: decimal.New(1, 0), Time: now}
+
+	// no later trade, candle is still emitted by wall clock and followed by flat candle
+	select {
+	case c := <-candles:
+		r.Equal(int64(1), c.TradeCount)
+	case <-time.After(time.Second):
+		r.FailNow("candle of quiet market is not emitted")
+	}
+	select {
+	case c := <-candles:
+		r.Zero(c.TradeCount)
+		r.True(decimal.New(100, 0).Equals(c.Close))
+	case <-time.After(time.Second):
+		r.FailNow("flat candle of quiet market is not emitted")
+	}
+}
+
+func TestStream(t *testing.T) {
+	r := require.New(t)
+	trades := make(chan order.Trade)
+	go func() {
+		defer close(trades)
+		trades <- trade(1, 0, "100", "1")
+		trades <- trade(2, 2*time.Minute, "100", "1")
+	}()
+
+	minutes := NewAggregator(time.Minute, 0)
+	hours := NewAggregator(time.Hour, 0)
+	candles := []Candle{}
+	for c := range Stream(trades, minutes, hours) {
+		candles = append(candles, c)
+	}
+	// 3 minute candles and 1 hour candle
+	r.Len(candles, 4)
+}
@@ -0,0 +1,147 @@
+package candle
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// HistoryFetcher is implemented by engines that can page through
+// historical candles of configured pair, pages are passed to handle in chronological order
+type HistoryFetcher interface {
+	FetchHistory(interval time.Duration, start, end time.Time, handle func([]Candle) error) error
+}
+
+// Sink receives pages of candles to be exported
+type Sink interface {
+	Write(candles []Candle) error
+	Close() error
+}
+
+var csvHeader = []string{"pair", "start", "interval", "open", "high", "low", "close", "volume", "quote_volume", "vwap", "trade_count"}
+
+// CSVSink writes candles as CSV rows with header
+type CSVSink struct {
+	w *csv.Writer
+}
+
+// NewCSVSink returns sink writing CSV into w, header is written immediately
+func NewCSVSink(w io.Writer) (*CSVSink, error) {
+	sink := &CSVSink{w: csv.NewWriter(w)}
+	if err := sink.w.Write(csvHeader); err != nil {
+		return nil, errors.Wrap(err, "[candle] failed to write csv header")
+	}
+	return sink, nil
+}
+
+// Write writes candles as CSV rows
+func (s *CSVSink) Write(candles []Candle) error {
+	for _, c := range candles {
+		row := []string{
+			c.Pair,
+			c.Start.UTC().Format(time.RFC3339),
+			c.Interval.String(),
+			c.Open.String(),
+			c.High.String(),
+			c.Low.String(),
+			c.Close.String(),
+			c.Volume.String(),
+			c.QuoteVolume.String(),
+			c.VWAP.String(),
+			strconv.FormatInt(c.TradeCount, 10),
+		}
+		if err := s.w.Write(row); err != nil {
+			return errors.Wrap(err, "[candle] failed to write csv row")
+		}
+	}
+	s.w.Flush()
+	return s.w.Error()
+}
+
+// Close flushes buffered rows, underlying writer is not closed
+func (s *CSVSink) Close() error {
+	s.w.Flush()
+	return s.w.Error()
+}
+
+// parquetCandle is parquet row of candle, prices and volumes are stored
+// as double for analytics tools, CSV should be used when exact decimal is needed
+type parquetCandle struct {
+	Pair            string  `parquet:"name=pair, type=UTF8"`
+	StartMillis     int64   `parquet:"name=start, type=TIMESTAMP_MILLIS"`
+	IntervalSeconds int64   `parquet:"name=interval_seconds, type=INT64"`
+	Open            float64 `parquet:"name=open, type=DOUBLE"`
+	High            float64 `parquet:"name=high, type=DOUBLE"`
+	Low             float64 `parquet:"name=low, type=DOUBLE"`
+	Close           float64 `parquet:"name=close, type=DOUBLE"`
+	Volume          float64 `parquet:"name=volume, type=DOUBLE"`
+	QuoteVolume     float64 `parquet:"name=quote_volume, type=DOUBLE"`
+	VWAP            float64 `parquet:"name=vwap, type=DOUBLE"`
+	TradeCount      int64   `parquet:"name=trade_count, type=INT64"`
+}
+
+// ParquetSink writes candles into parquet file
+type ParquetSink struct {
+	pw *writer.ParquetWriter
+}
+
+// NewParquetSink returns sink writing parquet into w
+func NewParquetSink(w io.Writer) (*ParquetSink, error) {
+	pw, err := writer.NewParquetWriterFromWriter(w, new(parquetCandle), 1)
+	if err != nil {
+		return nil, errors.Wrap(err, "[candle] failed to create parquet writer")
+	}
+	pw.CompressionType = parquet.CompressionCodec_SNAPPY
+	return &ParquetSink{pw: pw}, nil
+}
+
+// Write writes candles as parquet rows
+func (s *ParquetSink) Write(candles []Candle) error {
+	for _, c := range candles {
+		row := parquetCandle{
+			Pair:            c.Pair,
+			StartMillis:     c.Start.UnixNano() / int64(time.Millisecond),
+			IntervalSeconds: int64(c.Interval / time.Second),
+			TradeCount:      c.TradeCount,
+		}
+		row.Open, _ = c.Open.Float64()
+		row.High, _ = c.High.Float64()
+		row.Low, _ = c.Low.Float64()
+		row.Close, _ = c.Close.Float64()
+		row.Volume, _ = c.Volume.Float64()
+		row.QuoteVolume, _ = c.QuoteVolume.Float64()
+		row.VWAP, _ = c.VWAP.Float64()
+		if err := s.pw.Write(row); err != nil {
+			return errors.Wrap(err, "[candle] failed to write parquet row")
+		}
+	}
+	return nil
+}
+
+// Close writes parquet footer, underlying writer is not closed
+func (s *ParquetSink) Close() error {
+	if err := s.pw.WriteStop(); err != nil {
+		return errors.Wrap(err, "[candle] failed to finalize parquet file")
+	}
+	return nil
+}
+
+// NewSink returns sink according to extension of path, either .csv or .parquet
+func NewSink(path string, w io.Writer) (Sink, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return NewCSVSink(w)
+	case ".parquet":
+		return NewParquetSink(w)
+	default:
+		return nil, errors.Wrapf(fmt.Errorf("unsupported extension of [%v]", path), "[candle] need [.csv|.parquet]")
+	}
+}
@@ -0,0 +1,46 @@
+package candle
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSinks(t *testing.T) {
+	r := require.New(t)
+	candles := []Candle{{
+		Pair:     "BTC-USD",
+		Start:    t0,
+		Interval: time.Minute,
+		Open:     decimal.RequireFromString("1.5"),
+		High:     decimal.RequireFromString("2"),
+		Low:      decimal.RequireFromString("1"),
+		Close:    decimal.RequireFromString("1.7"),
+		Volume:   decimal.RequireFromString("10"),
+	}}
+
+	csvBuf := bytes.Buffer{}
+	sink, err := NewSink("out.csv", &csvBuf)
+	r.NoError(err)
+	r.NoError(sink.Write(candles))
+	r.NoError(sink.Close())
+	lines := strings.Split(strings.TrimSpace(csvBuf.String()), "\n")
+	r.Len(lines, 2)
+	r.Equal("pair,start,interval,open,high,low,close,volume,quote_volume,vwap,trade_count", lines[0])
+	r.Equal("BTC-USD,2019-10-17T00:00:00Z,1m0s,1.5,2,1,1.7,10,0,0,0", lines[1])
+
+	parquetBuf := bytes.Buffer{}
+	sink, err = NewSink("out.parquet", &parquetBuf)
+	r.NoError(err)
+	r.NoError(sink.Write(candles))
+	r.NoError(sink.Close())
+	r.True(bytes.HasPrefix(parquetBuf.Bytes(), []byte("PAR1")))
+	r.True(bytes.HasSuffix(parquetBuf.Bytes(), []byte("PAR1")))
+
+	_, err = NewSink("out.json", &bytes.Buffer{})
+	r.Error(err)
+}
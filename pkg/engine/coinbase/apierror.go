@@ -0,0 +1,78 @@
+package coinbase
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/go-resty/resty/v2"
+)
+
+// kinds of APIError, use errors.Is to tell kind of error returned by this package
+var (
+	ErrNotFound     = errors.NewPlain("not found")
+	ErrRateLimited  = errors.NewPlain("rate limited")
+	ErrServerError  = errors.NewPlain("server error")
+	ErrUnauthorized = errors.NewPlain("unauthorized")
+)
+
+// APIError is non-2xx response of API, Message is message of error payload,
+// or response body as-is when it is not JSON
+type APIError struct {
+	Method  string
+	URL     string
+	Status  int
+	Message string
+	// RetryAfter is Retry-After header of rate limited response, zero when absent
+	RetryAfter time.Duration
+}
+
+// newAPIError returns *APIError when response is not successful, otherwise nil
+func newAPIError(method, url string, resp *resty.Response) error {
+	if !resp.IsError() {
+		return nil
+	}
+	e := &APIError{
+		Method:  method,
+		URL:     url,
+		Status:  resp.StatusCode(),
+		Message: strings.TrimSpace(string(resp.Body())),
+	}
+	payload := struct {
+		Message string `json:"message"`
+	}{}
+	if err := json.Unmarshal(resp.Body(), &payload); err == nil && payload.Message != "" {
+		e.Message = payload.Message
+	}
+	if e.Status == http.StatusTooManyRequests {
+		e.RetryAfter = retryAfter(resp, 0)
+	}
+	return e
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("[coinbase] %v %v failed with %v %v: %v", e.Method, e.URL, e.Status, http.StatusText(e.Status), e.Message)
+}
+
+// Unwrap returns kind of error by status, or nil for other client errors e.g. bad request
+func (e *APIError) Unwrap() error {
+	switch {
+	case e.Status == http.StatusNotFound:
+		return ErrNotFound
+	case e.Status == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case e.Status == http.StatusUnauthorized || e.Status == http.StatusForbidden:
+		return ErrUnauthorized
+	case e.Status >= 500:
+		return ErrServerError
+	}
+	return nil
+}
+
+// Temporary reports whether the same request may succeed later
+func (e *APIError) Temporary() bool {
+	return e.Status == http.StatusTooManyRequests || e.Status >= 500
+}
@@ -0,0 +1,61 @@
+package coinbase
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/choestelus/super-duper-succotash/pkg/engine/coinbase/coinbasetest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchOrderBookAPIError(t *testing.T) {
+	r := require.New(t)
+	s := coinbasetest.NewServer()
+	defer s.Close()
+	SharedHTTPClient(s.URL).MaxRetries = 0
+
+	testcases := []struct {
+		pair      string
+		resp      coinbasetest.Response
+		kind      error
+		message   string
+		temporary bool
+	}{
+		{pair: "XXX-USD", resp: coinbasetest.NotFound(), kind: ErrNotFound, message: "NotFound"},
+		{pair: "ETH-USD", resp: coinbasetest.TooManyRequests(2 * time.Second), kind: ErrRateLimited, message: "Public rate limit exceeded", temporary: true},
+		{pair: "BTC-USD", resp: coinbasetest.ServerError(http.StatusBadGateway), kind: ErrServerError, message: "Bad Gateway", temporary: true},
+		{pair: "LTC-USD", resp: coinbasetest.Response{Status: http.StatusForbidden, Body: `{"message":"Forbidden"}`}, kind: ErrUnauthorized, message: "Forbidden"},
+		{pair: "BCH-USD", resp: coinbasetest.Response{Status: http.StatusServiceUnavailable, Body: "upstream unavailable\n"}, kind: ErrServerError, message: "upstream unavailable", temporary: true},
+	}
+	for _, tc := range testcases {
+		s.ScriptBook(tc.pair, tc.resp)
+		_, _, err := FetchOrderBook(s.URL, 2, tc.pair)
+		r.Error(err, tc.pair)
+		r.True(errors.Is(err, tc.kind), "%v: %v", tc.pair, err)
+
+		apiErr := &APIError{}
+		r.True(errors.As(err, &apiErr), tc.pair)
+		r.Equal(tc.resp.Status, apiErr.Status)
+		r.Equal(tc.message, apiErr.Message, "venue message is kept")
+		r.Equal(tc.temporary, apiErr.Temporary())
+		r.Contains(err.Error(), tc.message)
+		r.Contains(err.Error(), "/products/"+tc.pair+"/book")
+	}
+
+	s.ScriptBook("ETH-USD", coinbasetest.TooManyRequests(2*time.Second))
+	_, _, err := FetchOrderBook(s.URL, 2, "ETH-USD")
+	apiErr := &APIError{}
+	r.True(errors.As(err, &apiErr))
+	r.Equal(2*time.Second, apiErr.RetryAfter)
+
+	// other client errors have no kind
+	s.ScriptBook("SOL-USD", coinbasetest.Response{Status: http.StatusBadRequest, Body: `{"message":"Invalid level"}`})
+	_, _, err = FetchOrderBook(s.URL, 2, "SOL-USD")
+	r.True(errors.As(err, &apiErr))
+	for _, kind := range []error{ErrNotFound, ErrRateLimited, ErrServerError, ErrUnauthorized} {
+		r.False(errors.Is(err, kind))
+	}
+	r.False(apiErr.Temporary())
+}
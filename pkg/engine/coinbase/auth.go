@@ -0,0 +1,313 @@
+package coinbase
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"emperror.dev/errors"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/go-ozzo/ozzo-validation/is"
+	"github.com/go-resty/resty/v2"
+	"github.com/shopspring/decimal"
+	"gopkg.in/yaml.v2"
+)
+
+// environment variables which credentials are loaded from
+const (
+	EnvAPIKey        = "COINBASE_API_KEY"
+	EnvAPISecret     = "COINBASE_API_SECRET"
+	EnvAPIPassphrase = "COINBASE_API_PASSPHRASE"
+)
+
+// Credentials holds API key of authenticated endpoints
+// Secret is base64 encoded as issued by exchange.
+// Credentials are masked when formatted or encoded as JSON, so they are safe to be logged by accident.
+type Credentials struct {
+	Key        string `yaml:"key"`
+	Secret     string `yaml:"secret"`
+	Passphrase string `yaml:"passphrase"`
+}
+
+// String masks every field except last 4 characters of key
+func (c Credentials) String() string {
+	return fmt.Sprintf("{Key:%v Secret:**** Passphrase:****}", c.maskedKey())
+}
+
+// MarshalJSON masks credentials the same way as String
+func (c Credentials) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{"key": c.maskedKey(), "secret": "****", "passphrase": "****"})
+}
+
+// maskedKey returns last 4 characters of key prefixed by mask
+func (c Credentials) maskedKey() string {
+	key := "****"
+	if len(c.Key) > 4 {
+		key += c.Key[len(c.Key)-4:]
+	}
+	return key
+}
+
+// GoString masks credentials in %#v
+func (c Credentials) GoString() string {
+	return "coinbase.Credentials" + c.String()
+}
+
+// Validate checks that every field is present and secret is base64 encoded
+func (c Credentials) Validate() error {
+	return validation.ValidateStruct(&c,
+		validation.Field(&c.Key, validation.Required),
+		validation.Field(&c.Secret, validation.Required, is.Base64),
+		validation.Field(&c.Passphrase, validation.Required),
+	)
+}
+
+// LoadCredentials loads credentials from YAML or JSON file at path, when supplied,
+// then overrides them with COINBASE_API_* environment variables which are set
+func LoadCredentials(path string) (Credentials, error) {
+	creds := Credentials{}
+	if path != "" {
+		raw, err := ioutil.ReadFile(path)
+		if err != nil {
+			return creds, errors.Wrap(err, "[coinbase] failed to read credentials file")
+		}
+		// error is not wrapped with content to avoid leaking secrets
+		if err := yaml.UnmarshalStrict(raw, &creds); err != nil {
+			return creds, errors.Wrapf(fmt.Errorf("malformed credentials file %v", path), "[coinbase] failed to load credentials")
+		}
+	}
+	for env, field := range map[string]*string{
+		EnvAPIKey:        &creds.Key,
+		EnvAPISecret:     &creds.Secret,
+		EnvAPIPassphrase: &creds.Passphrase,
+	} {
+		if v, ok := os.LookupEnv(env); ok {
+			*field = v
+		}
+	}
+	if err := creds.Validate(); err != nil {
+		return creds, errors.Wrap(err, "[coinbase] invalid credentials")
+	}
+	return creds, nil
+}
+
+// Sign returns CB-ACCESS-SIGN of request, which is base64 encoded HMAC-SHA256
+// of timestamp + method + requestPath + body using decoded secret
+// see https://docs.pro.coinbase.com/#signing-a-message
+func Sign(secret, timestamp, method, requestPath, body string) (string, error) {
+	key, err := base64.StdEncoding.DecodeString(secret)
+	if err != nil {
+		return "", errors.Wrap(fmt.Errorf("secret is not base64 encoded"), "[coinbase] failed to sign request")
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(timestamp + method + requestPath + body))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// Account holds balance of single currency
+type Account struct {
+	ID        string          `json:"id"`
+	Currency  string          `json:"currency"`
+	Balance   decimal.Decimal `json:"balance"`
+	Available decimal.Decimal `json:"available"`
+	Hold      decimal.Decimal `json:"hold"`
+}
+
+// Fill holds partial or complete execution of order
+type Fill struct {
+	TradeID   int64           `json:"trade_id"`
+	ProductID string          `json:"product_id"`
+	OrderID   string          `json:"order_id"`
+	Price     decimal.Decimal `json:"price"`
+	Size      decimal.Decimal `json:"size"`
+	Fee       decimal.Decimal `json:"fee"`
+	Side      string          `json:"side"`
+	Liquidity string          `json:"liquidity"`
+	Settled   bool            `json:"settled"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// PlacedOrder holds status of order placed on exchange
+// Price is empty for market order, Funds is set for market order placed by quote amount
+type PlacedOrder struct {
+	ID            string          `json:"id"`
+	ProductID     string          `json:"product_id"`
+	Side          string          `json:"side"`
+	Type          string          `json:"type"`
+	TimeInForce   string          `json:"time_in_force"`
+	Price         decimal.Decimal `json:"price"`
+	Size          decimal.Decimal `json:"size"`
+	Funds         decimal.Decimal `json:"funds"`
+	FilledSize    decimal.Decimal `json:"filled_size"`
+	ExecutedValue decimal.Decimal `json:"executed_value"`
+	FillFees      decimal.Decimal `json:"fill_fees"`
+	Status        string          `json:"status"`
+	DoneReason    string          `json:"done_reason"`
+	Settled       bool            `json:"settled"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+// Client calls authenticated endpoints with signed requests
+type Client struct {
+	Endpoint string
+
+	creds  Credentials
+	client *HTTPClient
+	now    func() time.Time
+}
+
+// NewClient returns client of API at endpoint signing requests with supplied credentials,
+// clients of the same endpoint and API key share private rate limit
+func NewClient(endpoint string, creds Credentials) (*Client, error) {
+	endpointErr := validation.Validate(endpoint, validation.Required, is.URL)
+	err := errors.Combine(endpointErr, creds.Validate())
+	if err != nil {
+		return nil, errors.Wrap(err, "[coinbase] malformed params")
+	}
+	return &Client{
+		Endpoint: endpoint,
+		creds:    creds,
+		client:   sharedHTTPClient(endpoint+" "+creds.Key, PrivateRateLimit, PrivateBurst),
+		now:      time.Now,
+	}, nil
+}
+
+// do sends signed request and decodes JSON response into result, returns response
+// for pagination headers. body is encoded as JSON when not nil.
+func (c *Client) do(method, path string, query url.Values, body interface{}, result interface{}) (*resty.Response, error) {
+	u, err := url.Parse(c.Endpoint + path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "[coinbase] malformed url %v", path)
+	}
+	u.RawQuery = query.Encode()
+
+	payload := ""
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return nil, errors.Wrapf(err, "[coinbase] failed to encode %v %v body", method, path)
+		}
+		payload = string(raw)
+	}
+	// request is signed on every attempt, since signature expires
+	var signErr error
+	prepare := func(req *resty.Request) {
+		timestamp := strconv.FormatInt(c.now().Unix(), 10)
+		signature, err := Sign(c.creds.Secret, timestamp, method, u.RequestURI(), payload)
+		if err != nil {
+			signErr = err
+		}
+		req.SetHeader("Accept", "application/json").
+			SetHeader("CB-ACCESS-KEY", c.creds.Key).
+			SetHeader("CB-ACCESS-SIGN", signature).
+			SetHeader("CB-ACCESS-TIMESTAMP", timestamp).
+			SetHeader("CB-ACCESS-PASSPHRASE", c.creds.Passphrase)
+		if body != nil {
+			req.SetHeader("Content-Type", "application/json").SetBody(payload)
+		}
+	}
+	resp, err := c.client.Do(method, u.String(), prepare)
+	if signErr != nil {
+		return nil, signErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := newAPIError(method, path, resp); err != nil {
+		return resp, err
+	}
+	if result != nil {
+		if err := json.Unmarshal(resp.Body(), result); err != nil {
+			return resp, errors.Wrapf(err, "[coinbase] malformed %v %v response", method, path)
+		}
+	}
+	return resp, nil
+}
+
+// paginate calls GET path page by page following CB-AFTER cursor,
+// next is called with every page and should return number of items decoded
+func (c *Client) paginate(path string, query url.Values, next func(raw []byte) (int, error)) error {
+	for {
+		raw := json.RawMessage{}
+		resp, err := c.do("GET", path, query, nil, &raw)
+		if err != nil {
+			return err
+		}
+		n, err := next(raw)
+		if err != nil {
+			return errors.Wrapf(err, "[coinbase] malformed GET %v response", path)
+		}
+		after := resp.Header().Get("CB-AFTER")
+		if n == 0 || after == "" {
+			return nil
+		}
+		query.Set("after", after)
+	}
+}
+
+// Accounts returns balances of every currency of API key
+func (c *Client) Accounts() ([]Account, error) {
+	accounts := []Account{}
+	_, err := c.do("GET", "/accounts", url.Values{}, nil, &accounts)
+	return accounts, err
+}
+
+// Fills returns fills of order, or of product when orderID is empty
+func (c *Client) Fills(orderID, productID string) ([]Fill, error) {
+	query := url.Values{}
+	if orderID != "" {
+		query.Set("order_id", orderID)
+	}
+	if productID != "" {
+		query.Set("product_id", productID)
+	}
+	if len(query) == 0 {
+		return nil, errors.Wrap(fmt.Errorf("either order id or product id is required"), "[coinbase] malformed params")
+	}
+	fills := []Fill{}
+	err := c.paginate("/fills", query, func(raw []byte) (int, error) {
+		page := []Fill{}
+		if err := json.Unmarshal(raw, &page); err != nil {
+			return 0, err
+		}
+		fills = append(fills, page...)
+		return len(page), nil
+	})
+	return fills, err
+}
+
+// Orders returns orders of product with supplied statuses, open orders are returned
+// when no status is supplied, as API does. productID can be empty for every product.
+func (c *Client) Orders(productID string, statuses ...string) ([]PlacedOrder, error) {
+	query := url.Values{}
+	if productID != "" {
+		query.Set("product_id", productID)
+	}
+	for _, status := range statuses {
+		query.Add("status", status)
+	}
+	orders := []PlacedOrder{}
+	err := c.paginate("/orders", query, func(raw []byte) (int, error) {
+		page := []PlacedOrder{}
+		if err := json.Unmarshal(raw, &page); err != nil {
+			return 0, err
+		}
+		orders = append(orders, page...)
+		return len(page), nil
+	})
+	return orders, err
+}
+
+// Order returns single order by its id
+func (c *Client) Order(id string) (PlacedOrder, error) {
+	od := PlacedOrder{}
+	_, err := c.do("GET", "/orders/"+url.PathEscape(id), url.Values{}, nil, &od)
+	return od, err
+}
@@ -0,0 +1,197 @@
+package coinbase
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+var testCredentials = Credentials{
+	Key:        "test-key-1234",
+	Secret:     base64.StdEncoding.EncodeToString([]byte("test-secret")),
+	Passphrase: "test-passphrase",
+}
+
+// signedServer verifies signature of every request before passing it to handler
+func signedServer(t *testing.T, creds Credentials, handler http.HandlerFunc) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		expected, err := Sign(creds.Secret, req.Header.Get("CB-ACCESS-TIMESTAMP"), req.Method, req.URL.RequestURI(), string(body))
+		if err != nil ||
+			req.Header.Get("CB-ACCESS-SIGN") != expected ||
+			req.Header.Get("CB-ACCESS-KEY") != creds.Key ||
+			req.Header.Get("CB-ACCESS-PASSPHRASE") != creds.Passphrase {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"message":"invalid signature"}`))
+			return
+		}
+		handler(w, req)
+	}))
+}
+
+func TestSign(t *testing.T) {
+	r := require.New(t)
+	// HMAC-SHA256 of "1571299200GET/accounts" with key "test-secret"
+	signature, err := Sign(testCredentials.Secret, "1571299200", "GET", "/accounts", "")
+	r.NoError(err)
+	r.Equal("zKo90AnOcgfUCaClwcODbzCyZeRtnHths74kNej1dAg=", signature)
+
+	_, err = Sign("not base64!", "1571299200", "GET", "/accounts", "")
+	r.Error(err)
+}
+
+func TestClientAccounts(t *testing.T) {
+	r := require.New(t)
+	server := signedServer(t, testCredentials, func(w http.ResponseWriter, req *http.Request) {
+		r.Equal("/accounts", req.URL.Path)
+		w.Write([]byte(`[{"id":"a1","currency":"BTC","balance":"1.5","available":"1.0","hold":"0.5"}]`))
+	})
+	defer server.Close()
+
+	client, err := NewClient(server.URL, testCredentials)
+	r.NoError(err)
+	accounts, err := client.Accounts()
+	r.NoError(err)
+	r.Len(accounts, 1)
+	r.Equal("BTC", accounts[0].Currency)
+	r.True(decimal.RequireFromString("0.5").Equal(accounts[0].Hold))
+
+	wrong := testCredentials
+	wrong.Secret = base64.StdEncoding.EncodeToString([]byte("wrong-secret"))
+	client, err = NewClient(server.URL, wrong)
+	r.NoError(err)
+	_, err = client.Accounts()
+	r.Error(err)
+	r.True(errors.Is(err, ErrUnauthorized))
+	r.Contains(err.Error(), "invalid signature")
+	r.NotContains(err.Error(), wrong.Secret)
+}
+
+func TestClientFillsPagination(t *testing.T) {
+	r := require.New(t)
+	server := signedServer(t, testCredentials, func(w http.ResponseWriter, req *http.Request) {
+		r.Equal("/fills", req.URL.Path)
+		r.Equal("o1", req.URL.Query().Get("order_id"))
+		switch req.URL.Query().Get("after") {
+		case "":
+			w.Header().Set("CB-AFTER", "2")
+			w.Write([]byte(`[{"trade_id":3,"order_id":"o1","price":"100","size":"1","fee":"0.5","side":"buy"}]`))
+		case "2":
+			w.Header().Set("CB-AFTER", "1")
+			w.Write([]byte(`[{"trade_id":2,"order_id":"o1","price":"101","size":"2","fee":"1","side":"buy"}]`))
+		default:
+			w.Write([]byte(`[]`))
+		}
+	})
+	defer server.Close()
+
+	client, err := NewClient(server.URL, testCredentials)
+	r.NoError(err)
+	fills, err := client.Fills("o1", "")
+	r.NoError(err)
+	r.Len(fills, 2)
+	r.Equal(int64(3), fills[0].TradeID)
+	r.Equal(int64(2), fills[1].TradeID)
+
+	_, err = client.Fills("", "")
+	r.Error(err)
+}
+
+func TestClientOrders(t *testing.T) {
+	r := require.New(t)
+	server := signedServer(t, testCredentials, func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/orders":
+			r.Equal([]string{"open", "pending"}, req.URL.Query()["status"])
+			w.Write([]byte(`[{"id":"o1","product_id":"BTC-USD","side":"buy","type":"limit","price":"100","size":"1","status":"open"}]`))
+		case "/orders/o1":
+			w.Write([]byte(`{"id":"o1","product_id":"BTC-USD","side":"buy","type":"limit","price":"100","size":"1","filled_size":"1","status":"done","done_reason":"filled"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	defer server.Close()
+
+	client, err := NewClient(server.URL, testCredentials)
+	r.NoError(err)
+	orders, err := client.Orders("BTC-USD", "open", "pending")
+	r.NoError(err)
+	r.Len(orders, 1)
+	r.Equal("open", orders[0].Status)
+
+	od, err := client.Order("o1")
+	r.NoError(err)
+	r.Equal("filled", od.DoneReason)
+}
+
+func TestLoadCredentials(t *testing.T) {
+	r := require.New(t)
+	dir, err := ioutil.TempDir("", "succotash")
+	r.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "credentials.yaml")
+	content := fmt.Sprintf("key: %v\nsecret: %v\npassphrase: %v\n", testCredentials.Key, testCredentials.Secret, testCredentials.Passphrase)
+	r.NoError(ioutil.WriteFile(path, []byte(content), 0600))
+
+	creds, err := LoadCredentials(path)
+	r.NoError(err)
+	r.Equal(testCredentials, creds)
+
+	os.Setenv(EnvAPIPassphrase, "from-env")
+	defer os.Unsetenv(EnvAPIPassphrase)
+	creds, err = LoadCredentials(path)
+	r.NoError(err)
+	r.Equal("from-env", creds.Passphrase)
+
+	_, err = LoadCredentials("")
+	r.Error(err, "key and secret are missing")
+}
+
+func TestCredentialsMasked(t *testing.T) {
+	r := require.New(t)
+	for _, format := range []string{"%v", "%+v", "%#v", "%s"} {
+		out := fmt.Sprintf(format, testCredentials)
+		r.NotContains(out, testCredentials.Secret, format)
+		r.NotContains(out, testCredentials.Passphrase, format)
+		r.NotContains(out, testCredentials.Key, format)
+	}
+	r.Contains(testCredentials.String(), "1234")
+
+	for _, v := range []interface{}{testCredentials, &testCredentials, struct{ Creds Credentials }{testCredentials}} {
+		raw, err := json.Marshal(v)
+		r.NoError(err)
+		r.NotContains(string(raw), testCredentials.Secret)
+		r.NotContains(string(raw), testCredentials.Passphrase)
+		r.NotContains(string(raw), testCredentials.Key)
+		r.Contains(string(raw), `"key":"****1234"`)
+	}
+}
+
+func TestClientTimestamp(t *testing.T) {
+	r := require.New(t)
+	server := signedServer(t, testCredentials, func(w http.ResponseWriter, req *http.Request) {
+		r.Equal("1571299200", req.Header.Get("CB-ACCESS-TIMESTAMP"))
+		w.Write([]byte(`[]`))
+	})
+	defer server.Close()
+
+	client, err := NewClient(server.URL, testCredentials)
+	r.NoError(err)
+	client.now = func() time.Time { return time.Unix(1571299200, 0) }
+	_, err = client.Accounts()
+	r.NoError(err)
+}
@@ -0,0 +1,128 @@
+package coinbase
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/choestelus/super-duper-succotash/pkg/candle"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/go-ozzo/ozzo-validation/is"
+	"github.com/go-resty/resty/v2"
+	"github.com/shopspring/decimal"
+)
+
+// MaxCandlesPerRequest is maximum number of candles returned by single candles request
+const MaxCandlesPerRequest = 300
+
+// Granularities are candle intervals supported by candles API
+var Granularities = []interface{}{
+	time.Minute,
+	5 * time.Minute,
+	15 * time.Minute,
+	time.Hour,
+	6 * time.Hour,
+	24 * time.Hour,
+}
+
+// FetchCandles fetches historical candles of pair within [start, end]
+// see https://docs.pro.coinbase.com/#get-historic-rates for detailed information on API,
+// range must not exceed MaxCandlesPerRequest candles.
+//
+// This function return raw JSON response as-is, non-2xx response is returned as *APIError.
+func FetchCandles(endpoint, pair string, granularity time.Duration, start, end time.Time) ([]byte, error) {
+	queryURL, prepare, err := candlesRequest(endpoint, pair, granularity, start, end)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := SharedHTTPClient(endpoint).Do("GET", queryURL, prepare)
+	if err != nil {
+		return nil, err
+	}
+	if err := newAPIError("GET", queryURL, resp); err != nil {
+		return nil, err
+	}
+	return resp.Body(), nil
+}
+
+// candlesRequest validates params and returns url and query of candles API request
+func candlesRequest(endpoint, pair string, granularity time.Duration, start, end time.Time) (string, func(*resty.Request), error) {
+	granularityErr := validation.Validate(granularity, validation.In(Granularities...))
+	endpointErr := validation.Validate(endpoint, is.URL)
+	err := errors.Combine(granularityErr, endpointErr)
+	if end.Before(start) {
+		err = errors.Combine(err, fmt.Errorf("end %v is before start %v", end, start))
+	}
+	if end.Sub(start) > granularity*MaxCandlesPerRequest {
+		err = errors.Combine(err, fmt.Errorf("range exceeds %v candles", MaxCandlesPerRequest))
+	}
+	if err != nil {
+		return "", nil, errors.Wrap(err, "[coinbase] malformed params")
+	}
+
+	queryURL := fmt.Sprintf("%s/products/%s/candles", endpoint, pair)
+	prepare := func(req *resty.Request) {
+		req.SetQueryParam("granularity", fmt.Sprintf("%.0f", granularity.Seconds())).
+			SetQueryParam("start", start.UTC().Format(time.RFC3339)).
+			SetQueryParam("end", end.UTC().Format(time.RFC3339))
+	}
+	return queryURL, prepare, nil
+}
+
+// ToCandles transform raw candles response into candles sorted by start time ascending
+// each bucket is [ time, low, high, open, close, volume ]
+func ToCandles(raw []byte, pair string, granularity time.Duration) ([]candle.Candle, error) {
+	buckets := [][]json.Number{}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&buckets); err != nil {
+		return nil, errors.Wrap(err, "failed to transform coinbase candles response to [][]number")
+	}
+
+	candles := make([]candle.Candle, 0, len(buckets))
+	// response is sorted by time descending
+	for i := len(buckets) - 1; i >= 0; i-- {
+		bucket := buckets[i]
+		if len(bucket) != 6 {
+			return nil, errors.Wrap(fmt.Errorf("need 6 fields, got %v", len(bucket)), "malformed candle bucket")
+		}
+		unix, err := bucket[0].Int64()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to convert candle time to int64")
+		}
+		fields := make([]decimal.Decimal, 5)
+		for j := range fields {
+			fields[j], err = decimal.NewFromString(bucket[j+1].String())
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to convert candle field to decimal")
+			}
+		}
+		candles = append(candles, candle.Candle{
+			Pair:     pair,
+			Start:    time.Unix(unix, 0).UTC(),
+			Interval: granularity,
+			Low:      fields[0],
+			High:     fields[1],
+			Open:     fields[2],
+			Close:    fields[3],
+			Volume:   fields[4],
+		})
+	}
+	return candles, nil
+}
+
+// Backfill fetches candles of configured pair since supplied time until now,
+// limited to the latest MaxCandlesPerRequest candles
+func (e Engine) Backfill(interval time.Duration, since time.Time) ([]candle.Candle, error) {
+	end := time.Now()
+	if earliest := end.Add(-interval * (MaxCandlesPerRequest - 1)); since.Before(earliest) {
+		since = earliest
+	}
+	raw, err := FetchCandles(e.APIURL, e.Pair, interval, since, end)
+	if err != nil {
+		return nil, err
+	}
+	return ToCandles(raw, e.Pair, interval)
+}
@@ -0,0 +1,55 @@
+package coinbase
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToCandles(t *testing.T) {
+	r := require.New(t)
+	raw := []byte(`[[1415398800,0.32,4.2,0.35,4.2,12.3],[1415398740,0.3,0.5,0.4,0.35,1.5]]`)
+
+	candles, err := ToCandles(raw, "BTC-USD", time.Minute)
+	r.NoError(err)
+	r.Len(candles, 2)
+	r.Equal(time.Unix(1415398740, 0).UTC(), candles[0].Start)
+	r.True(decimal.RequireFromString("0.4").Equals(candles[0].Open))
+	r.True(decimal.RequireFromString("0.5").Equals(candles[0].High))
+	r.True(decimal.RequireFromString("0.3").Equals(candles[0].Low))
+	r.True(decimal.RequireFromString("0.35").Equals(candles[0].Close))
+	r.True(decimal.RequireFromString("12.3").Equals(candles[1].Volume))
+
+	_, err = ToCandles([]byte(`[[1415398800,0.32]]`), "BTC-USD", time.Minute)
+	r.Error(err)
+	_, err = ToCandles([]byte(`{"message":"NotFound"}`), "BTC-USD", time.Minute)
+	r.Error(err)
+}
+
+func TestFetchCandles(t *testing.T) {
+	r := require.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/products/BTC-USD/candles" || req.URL.Query().Get("granularity") != "60" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`[[1415398800,0.32,4.2,0.35,4.2,12.3]]`))
+	}))
+	defer server.Close()
+
+	end := time.Now()
+	raw, err := FetchCandles(server.URL, "BTC-USD", time.Minute, end.Add(-time.Hour), end)
+	r.NoError(err)
+	candles, err := ToCandles(raw, "BTC-USD", time.Minute)
+	r.NoError(err)
+	r.Len(candles, 1)
+
+	_, err = FetchCandles(server.URL, "BTC-USD", time.Second, end.Add(-time.Minute), end)
+	r.Error(err)
+	_, err = FetchCandles(server.URL, "BTC-USD", time.Minute, end.Add(-301*time.Minute), end)
+	r.Error(err)
+}
@@ -3,24 +3,25 @@ package coinbase
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"time"
 
 	"emperror.dev/errors"
 	"github.com/choestelus/super-duper-succotash/pkg/cast"
 	"github.com/choestelus/super-duper-succotash/pkg/order"
-	"github.com/davecgh/go-spew/spew"
 	validation "github.com/go-ozzo/ozzo-validation"
 	"github.com/go-ozzo/ozzo-validation/is"
-	"github.com/go-resty/resty/v2"
 	"github.com/sirupsen/logrus"
 )
 
 // FetchOrderBook fetches coinbase pro orderbook according to supplied level
 // see https://docs.pro.coinbase.com/#get-product-order-book for detailed information
 // on API, level 3 API is not supported in this function because
-// ratelimiting issue, to use level 3 API, use websocket-based implementation instead
+// ratelimiting issue, to use level 3 API, use websocket-based implementation instead.
+// Requests to the same endpoint share client and rate limit, see SharedHTTPClient
 //
-// This function return raw JSON response as-is.
+// This function return raw JSON response as-is, non-2xx response is returned as *APIError
+// of ErrNotFound, ErrRateLimited, ErrServerError or ErrUnauthorized kind.
 func FetchOrderBook(endpoint string, level int64, pair string) ([]byte, *time.Time, error) {
 	// TODO: validate available pairs
 	levelErr := validation.Validate(level, validation.Required, validation.Min(1), validation.Max(3))
@@ -34,11 +35,12 @@ func FetchOrderBook(endpoint string, level int64, pair string) ([]byte, *time.Ti
 	}
 
 	queryURL := fmt.Sprintf("%s/products/%s/book?level=%v", endpoint, pair, level)
-	client := resty.New()
-	resp, err := client.R().Get(queryURL)
-
+	resp, err := SharedHTTPClient(endpoint).Do("GET", queryURL, nil)
 	if err != nil {
-		return nil, nil, errors.Wrapf(err, "[coinbase] failed to call GET %v", queryURL)
+		return nil, nil, err
+	}
+	if err := newAPIError("GET", queryURL, resp); err != nil {
+		return nil, nil, err
 	}
 
 	updatedAt := time.Now()
@@ -51,6 +53,9 @@ func ToOrder(rawOrder interface{}) (*order.Order, error) {
 	if !ok {
 		return nil, errors.Wrap(fmt.Errorf("failed to convert order interface to slice of interface"), "ToOrder error")
 	}
+	if len(tuple3) != 3 {
+		return nil, errors.Wrap(fmt.Errorf("expected 3 elements of order, got %v", len(tuple3)), "ToOrder error")
+	}
 	priceField, err := cast.InterfaceStringToDecimal(tuple3[0])
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to convert price field to decimal")
@@ -70,102 +75,185 @@ func ToOrder(rawOrder interface{}) (*order.Order, error) {
 	case float64:
 		od.NumOrders = int64(t3)
 	default:
-		spew.Dump(t3)
-		return nil, errors.Wrap(fmt.Errorf("failed to convert num_order/order_id to appropiate type"), "ToOrder error")
+		return nil, errors.Wrap(fmt.Errorf("failed to convert num_order/order_id of type %T to appropiate type", t3), "ToOrder error")
 	}
 
 	return &od, nil
 }
 
-// ToOrderBook transform raw response bytes into OrderBook struct
+// ToOrderBook transform raw response bytes into OrderBook struct,
+// see DecodeOrderBook to decode from reader instead
 func ToOrderBook(raw []byte, timestamp time.Time) (*order.Book, error) {
-	bookMap := map[string]interface{}{}
-
-	if err := json.Unmarshal(raw, &bookMap); err != nil {
-		return nil, errors.Wrap(err, "failed to transform coinbase API response to map[string]interface{}")
+	payload := bookPayload{}
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return nil, errors.Wrap(err, "[coinbase] failed to decode order book response")
 	}
+	return payload.toBook(timestamp)
+}
 
-	bidSlice, err := cast.InterfaceToSlice(bookMap["bids"])
+// StreamOrderBook streams orderbook from websocket
+// and wrap into channel
+func StreamOrderBook(endpoint string, pair string) <-chan order.Book {
+	logrus.Warn("not implemented")
+	return nil
+}
+
+// Policies of invalid_book engine configuration, applied when fetched book
+// can not be decoded or fails order.Book.Validate
+const (
+	// PolicyDrop discards invalid book and waits for the next poll
+	PolicyDrop = "drop"
+	// PolicyResync fetches book again, up to maxResyncs times before failing
+	PolicyResync = "resync"
+	// PolicyFail fails on invalid book
+	PolicyFail = "fail"
+)
+
+// maxResyncs is number of refetches of resync policy before giving up
+const maxResyncs = 3
+
+// fetchBook fetches orderbook and transform into Book struct without validation,
+// malformed reports whether error is of response that can not be decoded
+func fetchBook(endpoint string, level int64, pair string) (book order.Book, malformed bool, err error) {
+	resp, updatedAt, err := FetchOrderBook(endpoint, level, pair)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to convert raw bids interface to []interface")
+		return order.Book{}, false, errors.Wrapf(err, "failed to fetch %v order book", pair)
 	}
-	askSlice, err := cast.InterfaceToSlice(bookMap["asks"])
+	b, err := ToOrderBook(resp, *updatedAt)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to convert raw asks interface to []interface")
+		return order.Book{}, true, err
 	}
+	return *b, false, nil
+}
 
-	bids := []order.Order{}
-	asks := []order.Order{}
+// invalidBookError is returned when book is still malformed or invalid after applying policy,
+// which is temporary unless policy is fail, since later book may be valid
+type invalidBookError struct {
+	pair   string
+	policy string
+	err    error
+}
 
-	for _, orderTuple := range bidSlice {
-		od, err := ToOrder(orderTuple)
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to convert order field into struct")
-		}
-		bids = append(bids, *od)
-	}
+func (e invalidBookError) Error() string {
+	return fmt.Sprintf("[coinbase] invalid %v order book: %v", e.pair, e.err)
+}
+
+func (e invalidBookError) Unwrap() error {
+	return e.err
+}
+
+// Temporary reports whether later book may be used
+func (e invalidBookError) Temporary() bool {
+	return e.policy != PolicyFail
+}
 
-	for _, orderTuple := range askSlice {
-		od, err := ToOrder(orderTuple)
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to convert order field into struct")
+// fetchValid fetches orderbook and applies policy when it is malformed or invalid,
+// reports false when book is dropped, returns error when failed to fetch
+// or when policy gives up
+func fetchValid(endpoint string, level int64, pair, policy string) (order.Book, bool, error) {
+	for attempt := 0; ; attempt++ {
+		book, malformed, err := fetchBook(endpoint, level, pair)
+		if err != nil && !malformed {
+			return book, false, err
+		}
+		if err == nil {
+			err = book.Validate()
+		}
+		switch {
+		case err == nil:
+			return book, true, nil
+		case policy == PolicyDrop:
+			logrus.Warnf("[coinbase] dropped %v order book: %v", pair, err)
+			return book, false, nil
+		case policy == PolicyResync && attempt < maxResyncs:
+			logrus.Warnf("[coinbase] resync %v order book: %v", pair, err)
+		default:
+			return book, false, errors.WithStack(invalidBookError{pair: pair, policy: policy, err: err})
 		}
-		asks = append(asks, *od)
 	}
+}
 
-	// while API docs example sequence is string
-	// actual response is just number
-	// This issue need to be addressed when use in critical
-	// production system
-	// TODO: try to cast sequence field as string
-	seq, ok := bookMap["sequence"].(float64)
-	if !ok {
-		spew.Dump(bookMap["sequence"])
-		return nil, errors.Wrap(fmt.Errorf("failed assert type on sequence as float64"), "interface->float64")
+// MustFetch fetches orderbook and transform into Book struct
+// panic when failed or when book is invalid after applying policy,
+// since there is no later book to wait for when dropped
+func MustFetch(endpoint string, level int64, pair, policy string) order.Book {
+	book, ok, err := fetchValid(endpoint, level, pair, policy)
+	if err != nil {
+		logrus.Panic(err)
 	}
-
-	book := order.Book{
-		Sequence:  fmt.Sprintf("%.0f", seq),
-		Bids:      bids,
-		Asks:      asks,
-		UpdatedAt: timestamp,
+	if !ok {
+		logrus.Panicf("[coinbase] no valid %v order book to use", pair)
 	}
+	return book
+}
 
-	return &book, nil
+// droppedBookError is returned by Fetch when invalid book is dropped by policy,
+// which is temporary since later book may be valid
+type droppedBookError struct {
+	pair string
+}
 
+func (e droppedBookError) Error() string {
+	return fmt.Sprintf("[coinbase] no valid %v order book to use", e.pair)
 }
 
-// StreamOrderBook streams orderbook from websocket
-// and wrap into channel
-func StreamOrderBook(endpoint string, pair string) <-chan order.Book {
-	logrus.Warn("not implemented")
-	return nil
+// Temporary reports that later fetch may succeed
+func (e droppedBookError) Temporary() bool {
+	return true
 }
 
-// MustFetch fetches orderbook and transform into Book struct
-// panic when failed
-func MustFetch(endpoint string, level int64, pair string) order.Book {
-	resp, updatedAt, err := FetchOrderBook(endpoint, level, pair)
+// Fetch fetches orderbook as MustFetch does, but returns error instead of panic
+// for callers that can retry, e.g. scheduled execution
+func Fetch(endpoint string, level int64, pair, policy string) (order.Book, error) {
+	book, ok, err := fetchValid(endpoint, level, pair, policy)
 	if err != nil {
-		logrus.Panicf("failed to fetch order book: %v", err)
+		return book, err
 	}
-	book, err := ToOrderBook(resp, *updatedAt)
-	if err != nil {
-		logrus.Panicf("failed to transform response to order book: %v", err)
+	if !ok {
+		return book, droppedBookError{pair: pair}
 	}
-	return *book
+	return book, nil
 }
 
-// FetchStream wrap FetchOrderbook and return order book channel
-func FetchStream(interval time.Duration, endpoint string, level int64, pair string) <-chan order.Book {
+// FetchStream wrap FetchOrderbook and return order book channel,
+// invalid books are handled with policy and dropped books are never sent,
+// book is also dropped when resync gives up, since the next poll may be valid.
+// Poll is skipped when rate limited, on server error or on network error,
+// other errors e.g. not found, unauthorized or invalid book of fail policy panic
+// since later polls would fail the same way
+func FetchStream(interval time.Duration, endpoint string, level int64, pair, policy string) <-chan order.Book {
 	bookStream := make(chan order.Book)
-	go func(endpoint string, level int64, pair string) {
+	poll := func() {
+		book, ok, err := fetchValid(endpoint, level, pair, policy)
+		switch {
+		case err != nil && errors.As(err, &invalidBookError{}) && policy != PolicyFail:
+			logrus.Warnf("[coinbase] dropped %v order book after %v resyncs: %v", pair, maxResyncs, err)
+		case err != nil && temporary(err):
+			logrus.Warnf("[coinbase] skipped %v order book poll: %v", pair, err)
+		case err != nil:
+			logrus.Panic(err)
+		case ok:
+			bookStream <- book
+		}
+	}
+	go func() {
 		// Fetch immediately after called, otherwise it will wait for 1 interval
 		// until the first fetch is run
-		bookStream <- MustFetch(endpoint, level, pair)
+		poll()
 		for range time.Tick(interval) {
-			bookStream <- MustFetch(endpoint, level, pair)
+			poll()
 		}
-	}(endpoint, level, pair)
+	}()
 	return bookStream
 }
+
+// temporary reports whether the same request may succeed later,
+// i.e. temporary APIError, or error of connection itself
+func temporary(err error) bool {
+	apiErr := &APIError{}
+	if errors.As(err, &apiErr) {
+		return apiErr.Temporary()
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -1,9 +1,12 @@
 package coinbase
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/choestelus/super-duper-succotash/pkg/order"
 	validation "github.com/go-ozzo/ozzo-validation"
 	"github.com/go-ozzo/ozzo-validation/is"
 	"github.com/shopspring/decimal"
@@ -27,6 +30,11 @@ func TestToOrder(t *testing.T) {
 	r.Equal(decimal.RequireFromString("5.72036512"), odLV3.Size)
 	r.Equal("da863862-25f4-4868-ac41-005d11ab0a5f", odLV3.OrderID)
 	r.Equal(int64(0), odLV3.NumOrders)
+
+	_, err = ToOrder([]interface{}{"1", "2"})
+	r.Error(err, "short order is rejected instead of panicking")
+	_, err = ToOrder([]interface{}{"1", "2", true})
+	r.Error(err)
 }
 
 func TestToOrderBook(t *testing.T) {
@@ -45,7 +53,7 @@ func TestToOrderBook(t *testing.T) {
 	r.NoError(err)
 	r.Len(lv1.Bids, 1)
 	r.Len(lv1.Asks, 1)
-	r.Equal(lv1.Sequence, "7371656227")
+	r.Equal(order.Sequence(7371656227), lv1.Sequence)
 	for _, order := range lv1.Bids {
 		r.Empty(order.OrderID)
 		r.NotEmpty(order.NumOrders)
@@ -59,7 +67,7 @@ func TestToOrderBook(t *testing.T) {
 	r.NoError(err)
 	r.Len(lv2.Bids, 50)
 	r.Len(lv2.Asks, 50)
-	r.Equal(lv2.Sequence, "7371989985")
+	r.Equal(order.Sequence(7371989985), lv2.Sequence)
 	for _, order := range lv1.Bids {
 		r.Empty(order.OrderID)
 		r.NotEmpty(order.NumOrders)
@@ -126,3 +134,47 @@ func SkipTestFetchOrderBook(t *testing.T) {
 		}
 	}
 }
+
+// bookServer serves crossed book for the first invalid requests, then sane book
+func bookServer(invalid int) (*httptest.Server, *int) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		if requests <= invalid {
+			w.Write([]byte(`{"sequence":1,"bids":[["171.5","3",1]],"asks":[["170.97","2",1]]}`))
+			return
+		}
+		w.Write([]byte(`{"sequence":2,"bids":[["170.95","3",1]],"asks":[["170.97","2",1]]}`))
+	}))
+	return server, &requests
+}
+
+func TestInvalidBookPolicy(t *testing.T) {
+	r := require.New(t)
+
+	server, requests := bookServer(2)
+	book := MustFetch(server.URL, 2, "ETH-USD", PolicyResync)
+	r.Equal(order.Sequence(2), book.Sequence, "invalid books are refetched")
+	r.Equal(3, *requests)
+	server.Close()
+
+	server, _ = bookServer(maxResyncs + 1)
+	r.Panics(func() { MustFetch(server.URL, 2, "ETH-USD", PolicyResync) }, "resync gives up")
+	server.Close()
+
+	server, requests = bookServer(2)
+	r.Panics(func() { MustFetch(server.URL, 2, "ETH-USD", PolicyFail) })
+	r.Panics(func() { MustFetch(server.URL, 2, "ETH-USD", PolicyDrop) }, "oneshot has nothing else to use")
+	r.Equal(2, *requests)
+	server.Close()
+
+	// server is left open, since stream keeps polling until process exits
+	server, _ = bookServer(1)
+	books := FetchStream(10*time.Millisecond, server.URL, 2, "ETH-USD", PolicyDrop)
+	book = <-books
+	r.Equal(order.Sequence(2), book.Sequence, "invalid book is never sent")
+
+	r.Equal(PolicyResync, MustParseConfig(map[string]string{}).InvalidBook)
+	r.Equal(PolicyDrop, MustParseConfig(map[string]string{"invalid_book": "drop"}).InvalidBook)
+	r.Panics(func() { MustParseConfig(map[string]string{"invalid_book": "ignore"}) })
+}
@@ -0,0 +1,194 @@
+package coinbasetest
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/choestelus/super-duper-succotash/pkg/order"
+	"github.com/gorilla/websocket"
+)
+
+// ScriptFeed queues messages of channel, which are sent to every connection subscribed to it.
+// feed is closed normally after every scripted message of subscribed channels is sent
+func (s *Server) ScriptFeed(channel string, messages ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.feeds[channel] = append(s.feeds[channel], messages...)
+}
+
+// subscription is subscribe message sent by client after connected
+type subscription struct {
+	Type       string   `json:"type"`
+	ProductIDs []string `json:"product_ids"`
+	Channels   []string `json:"channels"`
+}
+
+type subscribedChannel struct {
+	Name       string   `json:"name"`
+	ProductIDs []string `json:"product_ids"`
+}
+
+func (s *Server) serveFeed(w http.ResponseWriter, req *http.Request) {
+	conn, err := s.upgrader.Upgrade(w, req, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	sub := subscription{}
+	if err := conn.ReadJSON(&sub); err != nil || sub.Type != "subscribe" {
+		conn.WriteJSON(map[string]string{"type": "error", "message": "Failed to subscribe", "reason": "expected subscribe message"})
+		return
+	}
+
+	s.mu.Lock()
+	latency := s.latency
+	channels := make([]subscribedChannel, len(sub.Channels))
+	messages := []string{}
+	for i, channel := range sub.Channels {
+		channels[i] = subscribedChannel{Name: channel, ProductIDs: sub.ProductIDs}
+		messages = append(messages, s.feeds[channel]...)
+	}
+	s.mu.Unlock()
+
+	if err := conn.WriteJSON(map[string]interface{}{"type": "subscriptions", "channels": channels}); err != nil {
+		return
+	}
+	for _, msg := range messages {
+		time.Sleep(latency)
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+			return
+		}
+	}
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	// wait for client to receive close frame
+	conn.ReadMessage()
+}
+
+// Feed builds feed messages of single product with consecutive sequence,
+// use Gap to script messages lost between client and feed
+type Feed struct {
+	pair     string
+	sequence order.Sequence
+	at       time.Time
+	messages []string
+}
+
+// feedEpoch is time of the first message of every feed
+var feedEpoch = time.Date(2019, 10, 17, 0, 0, 0, 0, time.UTC)
+
+// NewFeed returns feed of pair, which the first sequenced message is at sequence
+func NewFeed(pair string, sequence order.Sequence) *Feed {
+	return &Feed{pair: pair, sequence: sequence, at: feedEpoch}
+}
+
+// Messages returns raw messages built so far
+func (f *Feed) Messages() []string {
+	return f.messages
+}
+
+// Sequence returns sequence of the next message
+func (f *Feed) Sequence() order.Sequence {
+	return f.sequence
+}
+
+// Gap skips missing sequences, so that the next message does not follow the previous one
+func (f *Feed) Gap(missing uint64) *Feed {
+	f.sequence += order.Sequence(missing)
+	return f
+}
+
+// Raw appends raw message e.g. malformed payload, without taking sequence
+func (f *Feed) Raw(msg string) *Feed {
+	f.messages = append(f.messages, msg)
+	return f
+}
+
+// Error appends error message, which is sent by feed before closing connection
+func (f *Feed) Error(message, reason string) *Feed {
+	return f.add(map[string]interface{}{"type": "error", "message": message, "reason": reason}, false)
+}
+
+// Snapshot appends level2 snapshot of book, bids and asks are [price, size] tuples
+func (f *Feed) Snapshot(book order.Book) *Feed {
+	return f.add(map[string]interface{}{
+		"type":       "snapshot",
+		"product_id": f.pair,
+		"bids":       priceSizes(book.Bids),
+		"asks":       priceSizes(book.Asks),
+	}, false)
+}
+
+// L2Update appends level2 update of side buy or sell, zero size removes level.
+// actual level2 channel has no sequence, it is added so that gaps can be scripted
+func (f *Feed) L2Update(side, price, size string) *Feed {
+	return f.add(map[string]interface{}{
+		"type":       "l2update",
+		"product_id": f.pair,
+		"changes":    [][]string{{side, price, size}},
+	}, true)
+}
+
+// Received appends full channel message of limit order received by matching engine
+func (f *Feed) Received(side, orderID, price, size string) *Feed {
+	return f.add(map[string]interface{}{
+		"type": "received", "product_id": f.pair, "side": side, "order_id": orderID,
+		"order_type": "limit", "price": price, "size": size,
+	}, true)
+}
+
+// Open appends full channel message of order resting on book
+func (f *Feed) Open(side, orderID, price, size string) *Feed {
+	return f.add(map[string]interface{}{
+		"type": "open", "product_id": f.pair, "side": side, "order_id": orderID,
+		"price": price, "remaining_size": size,
+	}, true)
+}
+
+// Change appends full channel message of order size change
+func (f *Feed) Change(side, orderID, price, oldSize, newSize string) *Feed {
+	return f.add(map[string]interface{}{
+		"type": "change", "product_id": f.pair, "side": side, "order_id": orderID,
+		"price": price, "old_size": oldSize, "new_size": newSize,
+	}, true)
+}
+
+// Done appends full channel message of order removed from book, reason is filled or canceled
+func (f *Feed) Done(side, orderID, price, remaining, reason string) *Feed {
+	return f.add(map[string]interface{}{
+		"type": "done", "product_id": f.pair, "side": side, "order_id": orderID,
+		"price": price, "remaining_size": remaining, "reason": reason,
+	}, true)
+}
+
+// Match appends trade message, which is sent on both full and matches channels
+func (f *Feed) Match(tradeID int64, side, price, size string) *Feed {
+	return f.add(map[string]interface{}{
+		"type": "match", "product_id": f.pair, "trade_id": tradeID, "side": side,
+		"price": price, "size": size,
+	}, true)
+}
+
+// add encodes message, sequenced messages take the next sequence and time
+func (f *Feed) add(msg map[string]interface{}, sequenced bool) *Feed {
+	if sequenced {
+		msg["sequence"] = uint64(f.sequence)
+		msg["time"] = f.at.Format(time.RFC3339Nano)
+		f.sequence = f.sequence.Next()
+		f.at = f.at.Add(time.Millisecond)
+	}
+	raw, err := json.Marshal(msg)
+	if err != nil {
+		panic(err)
+	}
+	return f.Raw(string(raw))
+}
+
+func priceSizes(ods []order.Order) [][]string {
+	tuples := make([][]string, len(ods))
+	for i, od := range ods {
+		tuples[i] = []string{od.Price.String(), od.Size.String()}
+	}
+	return tuples
+}
@@ -0,0 +1,194 @@
+// Package coinbasetest provides fake Coinbase Pro server for integration tests,
+// which serves scripted REST responses and websocket feed messages
+package coinbasetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/choestelus/super-duper-succotash/pkg/order"
+	"github.com/gorilla/websocket"
+)
+
+// Response is scripted reply of REST request, Status is 200 when zero
+// and Delay is added on top of server latency
+type Response struct {
+	Status int
+	Body   string
+	Header http.Header
+	Delay  time.Duration
+}
+
+// Server is fake Coinbase Pro REST API and websocket feed on local listener
+type Server struct {
+	// URL is REST endpoint, used as api_url of engine configuration
+	URL string
+	// WSURL is websocket feed endpoint, used as ws_url of engine configuration
+	WSURL string
+
+	server   *httptest.Server
+	upgrader websocket.Upgrader
+
+	mu        sync.Mutex
+	latency   time.Duration
+	responses map[string][]Response
+	requests  map[string]int
+	feeds     map[string][]string
+}
+
+// NewServer starts fake server without any scripted response,
+// unscripted paths are answered with 404 as unknown products of actual API
+func NewServer() *Server {
+	s := &Server{
+		responses: map[string][]Response{},
+		requests:  map[string]int{},
+		feeds:     map[string][]string{},
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.server.URL
+	s.WSURL = "ws" + strings.TrimPrefix(s.server.URL, "http") + "/feed"
+	return s
+}
+
+// Close shuts down server and blocks until every request is done
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// SetLatency delays every response and feed message by d
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// Script queues responses of path, responses are served in order
+// and the last one is repeated after every other is served
+func (s *Server) Script(path string, responses ...Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses[path] = append(s.responses[path], responses...)
+}
+
+// ScriptBook queues responses of order book of pair
+func (s *Server) ScriptBook(pair string, responses ...Response) {
+	s.Script(BookPath(pair), responses...)
+}
+
+// Requests returns number of requests received on path
+func (s *Server) Requests(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+// BookPath returns REST path of order book of pair
+func BookPath(pair string) string {
+	return fmt.Sprintf("/products/%s/book", pair)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	if websocket.IsWebSocketUpgrade(req) {
+		s.serveFeed(w, req)
+		return
+	}
+
+	resp, latency := s.next(req.URL.Path)
+	time.Sleep(latency + resp.Delay)
+	for key, values := range resp.Header {
+		for _, v := range values {
+			w.Header().Add(key, v)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if resp.Status == 0 {
+		resp.Status = http.StatusOK
+	}
+	w.WriteHeader(resp.Status)
+	w.Write([]byte(resp.Body))
+}
+
+// next counts request of path and pops its next response
+func (s *Server) next(path string) (Response, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests[path]++
+	queue := s.responses[path]
+	switch len(queue) {
+	case 0:
+		return NotFound(), s.latency
+	case 1:
+		return queue[0], s.latency
+	}
+	s.responses[path] = queue[1:]
+	return queue[0], s.latency
+}
+
+// BookResponse encodes book as order book response, levels with order id
+// are encoded as level 3 and the others with number of orders as level 2
+func BookResponse(book order.Book) Response {
+	payload := struct {
+		Sequence uint64          `json:"sequence"`
+		Bids     [][]interface{} `json:"bids"`
+		Asks     [][]interface{} `json:"asks"`
+	}{
+		Sequence: uint64(book.Sequence),
+		Bids:     levels(book.Bids),
+		Asks:     levels(book.Asks),
+	}
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		panic(err)
+	}
+	return Response{Body: string(raw)}
+}
+
+func levels(ods []order.Order) [][]interface{} {
+	tuples := make([][]interface{}, len(ods))
+	for i, od := range ods {
+		var third interface{} = od.NumOrders
+		if od.OrderID != "" {
+			third = od.OrderID
+		}
+		tuples[i] = []interface{}{od.Price.String(), od.Size.String(), third}
+	}
+	return tuples
+}
+
+// message returns error body in the same shape as actual API
+func message(msg string) string {
+	raw, _ := json.Marshal(map[string]string{"message": msg})
+	return string(raw)
+}
+
+// NotFound is response of unknown product or order
+func NotFound() Response {
+	return Response{Status: http.StatusNotFound, Body: message("NotFound")}
+}
+
+// TooManyRequests is rate limited response, Retry-After header is set
+// in whole seconds when retryAfter is positive
+func TooManyRequests(retryAfter time.Duration) Response {
+	resp := Response{Status: http.StatusTooManyRequests, Body: message("Public rate limit exceeded")}
+	if retryAfter > 0 {
+		seconds := int64((retryAfter + time.Second - 1) / time.Second)
+		resp.Header = http.Header{"Retry-After": []string{strconv.FormatInt(seconds, 10)}}
+	}
+	return resp
+}
+
+// ServerError is 5xx response of status
+func ServerError(status int) Response {
+	return Response{Status: status, Body: message(http.StatusText(status))}
+}
+
+// Malformed is successful response of truncated JSON
+func Malformed() Response {
+	return Response{Body: `{"sequence":7371656227,"bids":[["170.95","0.3`}
+}
@@ -0,0 +1,107 @@
+package coinbasetest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/choestelus/super-duper-succotash/pkg/order"
+	"github.com/gorilla/websocket"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+func get(r *require.Assertions, url string) (*http.Response, string) {
+	resp, err := http.Get(url)
+	r.NoError(err)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	r.NoError(err)
+	return resp, string(body)
+}
+
+func TestServerScript(t *testing.T) {
+	r := require.New(t)
+	s := NewServer()
+	defer s.Close()
+
+	book := order.Book{
+		Sequence: 7371656227,
+		Bids:     []order.Order{{Price: decimal.RequireFromString("170.95"), Size: decimal.RequireFromString("3"), NumOrders: 1}},
+		Asks:     []order.Order{{OrderID: "da863862", Price: decimal.RequireFromString("170.97"), Size: decimal.RequireFromString("2")}},
+	}
+	s.ScriptBook("ETH-USD", TooManyRequests(1500*time.Millisecond), ServerError(http.StatusBadGateway), BookResponse(book))
+
+	resp, body := get(r, s.URL+"/products/ETH-USD/book?level=2")
+	r.Equal(http.StatusTooManyRequests, resp.StatusCode)
+	r.Equal("2", resp.Header.Get("Retry-After"))
+	r.JSONEq(`{"message":"Public rate limit exceeded"}`, body)
+
+	resp, _ = get(r, s.URL+"/products/ETH-USD/book?level=2")
+	r.Equal(http.StatusBadGateway, resp.StatusCode)
+
+	for i := 0; i < 2; i++ {
+		resp, body = get(r, s.URL+"/products/ETH-USD/book?level=2")
+		r.Equal(http.StatusOK, resp.StatusCode)
+		r.JSONEq(`{"sequence":7371656227,"bids":[["170.95","3",1]],"asks":[["170.97","2","da863862"]]}`, body, "last response is repeated")
+	}
+	r.Equal(4, s.Requests(BookPath("ETH-USD")))
+
+	resp, body = get(r, s.URL+"/products/XXX-USD/book")
+	r.Equal(http.StatusNotFound, resp.StatusCode)
+	r.JSONEq(`{"message":"NotFound"}`, body)
+
+	s.SetLatency(30 * time.Millisecond)
+	s.Script("/time", Response{Body: `{}`, Delay: 20 * time.Millisecond})
+	start := time.Now()
+	get(r, s.URL+"/time")
+	r.True(time.Since(start) >= 50*time.Millisecond)
+}
+
+func TestServerFeed(t *testing.T) {
+	r := require.New(t)
+	s := NewServer()
+	defer s.Close()
+
+	feed := NewFeed("ETH-USD", 10).
+		Open("buy", "a", "170.95", "1").
+		Gap(2).
+		Done("buy", "a", "170.95", "0", "canceled").
+		Raw(`{"type":`)
+	r.Equal(order.Sequence(14), feed.Sequence())
+	s.ScriptFeed("full", feed.Messages()...)
+	s.ScriptFeed("ticker", `{"type":"ticker"}`)
+
+	conn, _, err := websocket.DefaultDialer.Dial(s.WSURL, nil)
+	r.NoError(err)
+	defer conn.Close()
+	r.NoError(conn.WriteJSON(map[string]interface{}{"type": "subscribe", "product_ids": []string{"ETH-USD"}, "channels": []string{"full"}}))
+
+	received := []string{}
+	for {
+		_, raw, err := conn.ReadMessage()
+		if websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+			break
+		}
+		r.NoError(err)
+		received = append(received, string(raw))
+	}
+	r.Len(received, 4, "subscriptions and scripted messages of subscribed channel")
+	r.JSONEq(`{"type":"subscriptions","channels":[{"name":"full","product_ids":["ETH-USD"]}]}`, received[0])
+	r.Equal(`{"type":`, received[3])
+
+	sequences := []order.Sequence{}
+	for _, raw := range received[1:3] {
+		msg := struct {
+			Sequence order.Sequence `json:"sequence"`
+			Time     time.Time      `json:"time"`
+		}{}
+		r.NoError(json.Unmarshal([]byte(raw), &msg))
+		r.False(msg.Time.IsZero())
+		sequences = append(sequences, msg.Sequence)
+	}
+	r.Equal([]order.Sequence{10, 13}, sequences)
+	r.Equal(uint64(2), sequences[1].Missing(sequences[0]))
+}
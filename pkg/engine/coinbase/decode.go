@@ -0,0 +1,217 @@
+package coinbase
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"emperror.dev/errors"
+	"github.com/choestelus/super-duper-succotash/pkg/order"
+	"github.com/shopspring/decimal"
+)
+
+// bookPayload is order book response of REST API, sequence is number
+// in actual responses but string in API docs, order.Sequence accepts both
+type bookPayload struct {
+	Sequence *order.Sequence `json:"sequence"`
+	Bids     []level         `json:"bids"`
+	Asks     []level         `json:"asks"`
+}
+
+// level is single [price, size, num-orders|order-id] tuple decoded straight into order,
+// third element is number of orders on level 1 and 2, and order id on level 3
+type level order.Order
+
+// UnmarshalJSON parses level tuple without going through interface{} values
+func (l *level) UnmarshalJSON(data []byte) error {
+	p := tupleParser{data: data}
+	if err := p.expect('['); err != nil {
+		return err
+	}
+	price, err := p.decimal()
+	if err != nil {
+		return errors.Wrap(err, "[coinbase] malformed price of level")
+	}
+	if err := p.expect(','); err != nil {
+		return err
+	}
+	size, err := p.decimal()
+	if err != nil {
+		return errors.Wrap(err, "[coinbase] malformed size of level")
+	}
+	if err := p.expect(','); err != nil {
+		return err
+	}
+	*l = level{Price: price, Size: size}
+
+	token, quoted, err := p.token()
+	if err != nil {
+		return errors.Wrap(err, "[coinbase] malformed num_orders/order_id of level")
+	}
+	if quoted {
+		// encoding/json would replace invalid bytes, order ids are never expected to hold them
+		if !utf8.Valid(token) {
+			return errors.Wrap(fmt.Errorf("invalid utf-8 in level %s", data), "[coinbase] malformed order_id of level")
+		}
+		l.OrderID = string(token)
+	} else if l.NumOrders, err = strconv.ParseInt(string(token), 10, 64); err != nil {
+		// tolerate number in float notation e.g. 1.0 or 1e2
+		count, ferr := strconv.ParseFloat(string(token), 64)
+		if ferr != nil {
+			return errors.Wrap(err, "[coinbase] malformed num_orders of level")
+		}
+		l.NumOrders = int64(count)
+	}
+	return p.expect(']')
+}
+
+// tupleParser scans flat JSON array of strings and numbers
+type tupleParser struct {
+	data []byte
+	pos  int
+}
+
+func (p *tupleParser) skipSpace() {
+	for p.pos < len(p.data) {
+		switch p.data[p.pos] {
+		case ' ', '\t', '\n', '\r':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (p *tupleParser) expect(c byte) error {
+	p.skipSpace()
+	if p.pos >= len(p.data) || p.data[p.pos] != c {
+		return errors.Wrap(fmt.Errorf("expected %q at offset %v of %s", c, p.pos, p.data), "[coinbase] malformed level")
+	}
+	p.pos++
+	return nil
+}
+
+// token returns next string or number, strings are returned unquoted
+func (p *tupleParser) token() ([]byte, bool, error) {
+	p.skipSpace()
+	if p.pos >= len(p.data) {
+		return nil, false, fmt.Errorf("unexpected end of level %s", p.data)
+	}
+	if p.data[p.pos] == '"' {
+		end := bytes.IndexByte(p.data[p.pos+1:], '"')
+		if end < 0 {
+			return nil, false, fmt.Errorf("unterminated string in level %s", p.data)
+		}
+		token := p.data[p.pos+1 : p.pos+1+end]
+		if bytes.IndexByte(token, '\\') >= 0 {
+			return nil, false, fmt.Errorf("escaped string in level %s", p.data)
+		}
+		p.pos += end + 2
+		return token, true, nil
+	}
+	start := p.pos
+	for p.pos < len(p.data) && isNumberByte(p.data[p.pos]) {
+		p.pos++
+	}
+	if start == p.pos {
+		return nil, false, fmt.Errorf("expected string or number at offset %v of %s", start, p.data)
+	}
+	return p.data[start:p.pos], false, nil
+}
+
+func isNumberByte(c byte) bool {
+	return c >= '0' && c <= '9' || c == '-' || c == '+' || c == '.' || c == 'e' || c == 'E'
+}
+
+// decimal parses next string or number as decimal
+func (p *tupleParser) decimal() (decimal.Decimal, error) {
+	token, _, err := p.token()
+	if err != nil {
+		return decimal.Zero, err
+	}
+	if d, ok := parsePlainDecimal(token); ok {
+		return d, nil
+	}
+	return decimal.NewFromString(string(token))
+}
+
+// maxPlainDigits is number of digits which always fits in int64
+const maxPlainDigits = 18
+
+// parsePlainDecimal parses decimal without exponent of up to 18 digits, which covers
+// every price and size of coinbase, without allocating string and parsing through big.Int
+func parsePlainDecimal(token []byte) (decimal.Decimal, bool) {
+	var value int64
+	digits, exp := 0, int32(0)
+	negative, dot := false, false
+	for i, c := range token {
+		switch {
+		case c == '-' && i == 0:
+			negative = true
+		case c == '.' && !dot:
+			dot = true
+		case c >= '0' && c <= '9':
+			if digits++; digits > maxPlainDigits {
+				return decimal.Zero, false
+			}
+			value = value*10 + int64(c-'0')
+			if dot {
+				exp--
+			}
+		default:
+			return decimal.Zero, false
+		}
+	}
+	// trailing zeros of fraction are dropped the same way as decimal.NewFromString,
+	// which also rejects value without digits left e.g. ".00"
+	for exp < 0 && value%10 == 0 {
+		value /= 10
+		exp++
+		digits--
+	}
+	if digits == 0 {
+		return decimal.Zero, false
+	}
+	if negative {
+		value = -value
+	}
+	return decimal.New(value, exp), true
+}
+
+// DecodeOrderBook decodes order book response from r straight into book,
+// without intermediate map of interface{} values
+func DecodeOrderBook(r io.Reader, timestamp time.Time) (*order.Book, error) {
+	payload := bookPayload{}
+	if err := json.NewDecoder(r).Decode(&payload); err != nil {
+		return nil, errors.Wrap(err, "[coinbase] failed to decode order book response")
+	}
+	return payload.toBook(timestamp)
+}
+
+// toBook checks sequence of payload and converts it into book
+func (payload bookPayload) toBook(timestamp time.Time) (*order.Book, error) {
+	if payload.Sequence == nil || payload.Sequence.IsZero() {
+		return nil, errors.Wrap(fmt.Errorf("sequence is missing"), "[coinbase] malformed order book response")
+	}
+
+	book := order.Book{
+		Sequence:  *payload.Sequence,
+		Bids:      toOrders(payload.Bids),
+		Asks:      toOrders(payload.Asks),
+		UpdatedAt: timestamp,
+	}
+	return &book, nil
+}
+
+// toOrders converts levels into orders, empty side is empty slice instead of nil
+func toOrders(levels []level) []order.Order {
+	orders := make([]order.Order, len(levels))
+	for i, l := range levels {
+		orders[i] = order.Order(l)
+	}
+	return orders
+}
@@ -0,0 +1,188 @@
+package coinbase
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/choestelus/super-duper-succotash/pkg/cast"
+	"github.com/choestelus/super-duper-succotash/pkg/order"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeOrderBook(t *testing.T) {
+	r := require.New(t)
+	at := time.Date(2019, 10, 17, 0, 0, 0, 0, time.UTC)
+
+	book, err := DecodeOrderBook(strings.NewReader(`{
+		"sequence": "7371656227",
+		"bids": [[ "170.95" , "0.34084807", 1 ], [170.9, 2.5, 1.0]],
+		"asks": [["170.97","7.64562173","da863862-25f4-4868-ac41-005d11ab0a5f"]]
+	}`), at)
+	r.NoError(err)
+	r.Equal(order.Sequence(7371656227), book.Sequence, "sequence can be string as in API docs")
+	r.Equal(at, book.UpdatedAt)
+	r.Equal([]order.Order{
+		{Price: decimal.RequireFromString("170.95"), Size: decimal.RequireFromString("0.34084807"), NumOrders: 1},
+		{Price: decimal.RequireFromString("170.9"), Size: decimal.RequireFromString("2.5"), NumOrders: 1},
+	}, book.Bids)
+	r.Equal("da863862-25f4-4868-ac41-005d11ab0a5f", book.Asks[0].OrderID)
+	r.Zero(book.Asks[0].NumOrders)
+
+	book, err = DecodeOrderBook(strings.NewReader(`{"sequence":12345678901234567890,"bids":[],"asks":[]}`), at)
+	r.NoError(err)
+	r.Equal("12345678901234567890", book.Sequence.String(), "sequence beyond float64 precision is exact")
+	r.NotNil(book.Bids)
+	r.Empty(book.Asks)
+
+	for _, raw := range []string{
+		`{"bids":[],"asks":[]}`,
+		`{"sequence":"abc","bids":[],"asks":[]}`,
+		`{"sequence":1.5,"bids":[],"asks":[]}`,
+		`{"sequence":-1,"bids":[],"asks":[]}`,
+		`{"sequence":null,"bids":[],"asks":[]}`,
+		`{"sequence":1,"bids":[["1","2"]],"asks":[]}`,
+		`{"sequence":1,"bids":[["1","2",1,4]],"asks":[]}`,
+		`{"sequence":1,"bids":[["x","2",1]],"asks":[]}`,
+		`{"sequence":1,"bids":[["1","2",true]],"asks":[]}`,
+		`{"sequence":1,"bids":[["1","2","a\"b"]],"asks":[]}`,
+		"{\"sequence\":1,\"bids\":[[\"1\",\"2\",\"\xf6\"]],\"asks\":[]}",
+		`{"sequence":1,"bids":{},"asks":[]}`,
+		`{"message":"NotFound"`,
+	} {
+		_, err := DecodeOrderBook(strings.NewReader(raw), at)
+		r.Error(err, raw)
+	}
+}
+
+// legacyToOrderBook is map[string]interface{} based decoding replaced by DecodeOrderBook,
+// kept as baseline of benchmarks
+func legacyToOrderBook(raw []byte) (*order.Book, error) {
+	bookMap := map[string]interface{}{}
+	if err := json.Unmarshal(raw, &bookMap); err != nil {
+		return nil, err
+	}
+	seq, err := order.ParseSequence(fmt.Sprintf("%.0f", bookMap["sequence"]))
+	if err != nil {
+		return nil, err
+	}
+	book := order.Book{Sequence: seq}
+	for _, side := range []string{"bids", "asks"} {
+		levels, err := cast.InterfaceToSlice(bookMap[side])
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range levels {
+			od, err := ToOrder(l)
+			if err != nil {
+				return nil, err
+			}
+			if side == "bids" {
+				book.Bids = append(book.Bids, *od)
+				continue
+			}
+			book.Asks = append(book.Asks, *od)
+		}
+	}
+	return &book, nil
+}
+
+// benchmarkBook returns order book response with levels on each side,
+// third element is order id on level 3 and number of orders otherwise
+func benchmarkBook(levels int, l3 bool) []byte {
+	var b bytes.Buffer
+	b.WriteString(`{"sequence":7371931270,"bids":[`)
+	for i := 0; i < levels; i++ {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		if l3 {
+			fmt.Fprintf(&b, `["%d.%02d","%d.12345678","%08x-25f4-4868-ac41-005d11ab0a5f"]`, 9000-i/100, i%100, i%50+1, i)
+			continue
+		}
+		fmt.Fprintf(&b, `["%d.%02d","%d.12345678",%d]`, 9000-i/100, i%100, i%50+1, i%7+1)
+	}
+	b.WriteString(`],"asks":[`)
+	for i := 0; i < levels; i++ {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		if l3 {
+			fmt.Fprintf(&b, `["%d.%02d","%d.12345678","%08x-9148-491c-83b5-eb37ba9ed510"]`, 9001+i/100, i%100, i%50+1, i)
+			continue
+		}
+		fmt.Fprintf(&b, `["%d.%02d","%d.12345678",%d]`, 9001+i/100, i%100, i%50+1, i%7+1)
+	}
+	b.WriteString(`]}`)
+	return b.Bytes()
+}
+
+func TestLegacyBaselineMatches(t *testing.T) {
+	r := require.New(t)
+	for _, l3 := range []bool{false, true} {
+		raw := benchmarkBook(100, l3)
+		legacy, err := legacyToOrderBook(raw)
+		r.NoError(err)
+		book, err := ToOrderBook(raw, time.Time{})
+		r.NoError(err)
+		r.Equal(legacy.Sequence, book.Sequence)
+		r.Equal(legacy.Bids, book.Bids)
+		r.Equal(legacy.Asks, book.Asks)
+	}
+}
+
+func benchmarkDecode(b *testing.B, raw []byte, decode func([]byte) error) {
+	b.SetBytes(int64(len(raw)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := decode(raw); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func typed(raw []byte) error {
+	_, err := ToOrderBook(raw, time.Time{})
+	return err
+}
+
+func legacy(raw []byte) error {
+	_, err := legacyToOrderBook(raw)
+	return err
+}
+
+// L2 responses hold 50 levels of each side
+func BenchmarkToOrderBookL2(b *testing.B) {
+	benchmarkDecode(b, benchmarkBook(50, false), typed)
+}
+
+func BenchmarkLegacyToOrderBookL2(b *testing.B) {
+	benchmarkDecode(b, benchmarkBook(50, false), legacy)
+}
+
+// L3 responses hold every order, 50k levels of each side
+func BenchmarkToOrderBookL3(b *testing.B) {
+	benchmarkDecode(b, benchmarkBook(50000, true), typed)
+}
+
+func BenchmarkLegacyToOrderBookL3(b *testing.B) {
+	benchmarkDecode(b, benchmarkBook(50000, true), legacy)
+}
+
+func TestParsePlainDecimal(t *testing.T) {
+	r := require.New(t)
+	for _, s := range []string{"170.95", "170.90", "9000.00", "0.34084807", "-1.5", "100", "0", "0.0", "0.00000001", "123456789012345678"} {
+		d, ok := parsePlainDecimal([]byte(s))
+		r.True(ok, s)
+		r.Equal(decimal.RequireFromString(s), d, "same representation as parsing string")
+	}
+	for _, s := range []string{"", "-", ".", "1e5", "1.2.3", "--1", "1-", ".00", "-.0", "1234567890123456789"} {
+		_, ok := parsePlainDecimal([]byte(s))
+		r.False(ok, s)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"strings"
 	"time"
 
+	"emperror.dev/errors"
+	"github.com/choestelus/super-duper-succotash/pkg/execution"
 	"github.com/choestelus/super-duper-succotash/pkg/order"
 	"github.com/mitchellh/mapstructure"
 	"github.com/sirupsen/logrus"
@@ -16,44 +18,129 @@ type Engine struct {
 	APILevel     int64         `mapstructure:"api_level"`
 	Pair         string        `mapstructure:"pair"`
 	PollInterval time.Duration `mapstructure:"poll_interval"`
+	WSURL        string        `mapstructure:"ws_url"`
+	// InvalidBook is policy of invalid order book, one of drop, resync or fail
+	InvalidBook string `mapstructure:"invalid_book"`
+	// RateLimit and RateBurst limit public requests to api_url in requests per second,
+	// shared by every engine of the same api_url, which must not configure different limit.
+	// RateBurst is 1 when only RateLimit is supplied
+	RateLimit float64 `mapstructure:"rate_limit"`
+	RateBurst int     `mapstructure:"rate_burst"`
+	// CredentialsFile is path to API key file of authenticated endpoints,
+	// credentials can also be supplied via COINBASE_API_* environment variables
+	CredentialsFile string `mapstructure:"credentials_file"`
 }
 
 // MustParseConfig parse config from supplied map[string]string
-// crash when failed to parse.
+// crash when failed to parse, or when unknown key is supplied.
+// Rate limit is only applied to shared client by Configure
 func MustParseConfig(engineConfig map[string]string) Engine {
+	e, err := ParseConfig(engineConfig)
+	if err != nil {
+		logrus.Panic(err)
+	}
+	return e
+}
+
+// ParseConfig parse config from supplied map[string]string with defaults applied,
+// returns error when failed to parse, or when unknown key is supplied
+func ParseConfig(engineConfig map[string]string) (Engine, error) {
 	e := Engine{}
 	mstrConfig := mapstructure.DecoderConfig{
 		DecodeHook:       mapstructure.StringToTimeDurationHookFunc(),
 		WeaklyTypedInput: true,
+		ErrorUnused:      true,
 		Result:           &e,
 	}
 	decoder, err := mapstructure.NewDecoder(&mstrConfig)
 	if err != nil {
-		logrus.Panic(err)
+		return e, errors.Wrap(err, "[coinbase] failed to create config decoder")
 	}
 
 	err = decoder.Decode(engineConfig)
 	if err != nil {
-		logrus.Panic(err)
+		return e, errors.Wrap(err, "[coinbase] malformed engine config")
 	}
 
-	return e
+	switch e.InvalidBook {
+	case "":
+		e.InvalidBook = PolicyResync
+	case PolicyDrop, PolicyResync, PolicyFail:
+	default:
+		return e, errors.Wrap(fmt.Errorf("need [%v|%v|%v], got [%v]", PolicyDrop, PolicyResync, PolicyFail, e.InvalidBook), "[coinbase] unrecognized invalid_book policy")
+	}
+
+	switch {
+	case e.RateLimit == 0 && e.RateBurst == 0:
+		e.RateLimit, e.RateBurst = PublicRateLimit, PublicBurst
+	case e.RateBurst == 0:
+		e.RateBurst = 1
+	}
+	if err := validateRate(e.RateLimit, e.RateBurst); err != nil {
+		return e, errors.Wrap(err, "[coinbase] malformed rate_limit or rate_burst")
+	}
+	return e, nil
+}
+
+// HTTPStats returns request counters of shared client of configured api_url
+func (e Engine) HTTPStats() Stats {
+	return SharedHTTPClient(e.APIURL).Stats()
+}
+
+// Client returns authenticated client of configured API
+// with credentials loaded from credentials file and environment variables
+func (e Engine) Client() (*Client, error) {
+	creds, err := LoadCredentials(e.CredentialsFile)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(e.APIURL, creds)
+}
+
+// Executor returns executor placing orders with authenticated client
+func (e Engine) Executor() (execution.Executor, error) {
+	client, err := e.Client()
+	if err != nil {
+		return nil, err
+	}
+	return NewExecutor(client), nil
+}
+
+// DryRunExecutor returns executor logging orders of dry run without credentials
+func (e Engine) DryRunExecutor() execution.Executor {
+	return NewDryRunExecutor(e.APIURL)
 }
 
 // OpenStream streams orderbook with supplied configuration
 func (e Engine) OpenStream(cfg map[string]string) <-chan order.Book {
-	return FetchStream(e.PollInterval, e.APIURL, e.APILevel, e.Pair)
+	return FetchStream(e.PollInterval, e.APIURL, e.APILevel, e.Pair, e.InvalidBook)
+}
+
+// OpenTradeStream streams executed trades of configured pair from websocket feed
+func (e Engine) OpenTradeStream(cfg map[string]string) <-chan order.Trade {
+	return MustStreamTrades(e.WSURL, e.Pair)
 }
 
 // OneShot returns orderbook only once per call
 // with supplied configuration
 func (e Engine) OneShot(cfg map[string]string) order.Book {
-	return MustFetch(e.APIURL, e.APILevel, e.Pair)
+	return MustFetch(e.APIURL, e.APILevel, e.Pair, e.InvalidBook)
 }
 
-// Configure set self configuration with supplied args
+// FetchBook returns orderbook only once per call as OneShot does,
+// but returns error instead of crashing
+func (e Engine) FetchBook(cfg map[string]string) (order.Book, error) {
+	return Fetch(e.APIURL, e.APILevel, e.Pair, e.InvalidBook)
+}
+
+// Configure set self configuration with supplied args, and applies its rate limit
+// to shared client of api_url, crash when another engine applied different limit
 func (e Engine) Configure(cfg map[string]string) order.BookStreamer {
-	return MustParseConfig(cfg)
+	e = MustParseConfig(cfg)
+	if err := SharedHTTPClient(e.APIURL).Limit(e.RateLimit, e.RateBurst); err != nil {
+		logrus.Panicf("[coinbase] failed to configure %v: %v", e.APIURL, err)
+	}
+	return e
 }
 
 // AssetPair returns main asset and exchanging asset of pair
@@ -0,0 +1,224 @@
+package coinbase
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/choestelus/super-duper-succotash/pkg/execution"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+// Product holds trading rules of pair
+type Product struct {
+	ID             string          `json:"id"`
+	BaseCurrency   string          `json:"base_currency"`
+	QuoteCurrency  string          `json:"quote_currency"`
+	BaseIncrement  decimal.Decimal `json:"base_increment"`
+	QuoteIncrement decimal.Decimal `json:"quote_increment"`
+}
+
+// Product fetches trading rules of pair
+// see https://docs.pro.coinbase.com/#get-single-product
+func (c *Client) Product(pair string) (Product, error) {
+	product := Product{}
+	_, err := c.do("GET", "/products/"+url.PathEscape(pair), url.Values{}, nil, &product)
+	return product, err
+}
+
+// FetchProduct fetches trading rules of pair from public endpoint, which needs no credentials
+// see https://docs.pro.coinbase.com/#get-single-product
+func FetchProduct(endpoint, pair string) (Product, error) {
+	product := Product{}
+	queryURL := endpoint + "/products/" + url.PathEscape(pair)
+	resp, err := SharedHTTPClient(endpoint).Do("GET", queryURL, nil)
+	if err != nil {
+		return product, errors.Wrapf(err, "[coinbase] failed to fetch product %v", pair)
+	}
+	if err := newAPIError("GET", queryURL, resp); err != nil {
+		return product, err
+	}
+	if err := json.Unmarshal(resp.Body(), &product); err != nil {
+		return product, errors.Wrapf(err, "[coinbase] failed to decode product %v", pair)
+	}
+	return product, nil
+}
+
+// OrderRequest is body of place order request, zero fields are omitted
+// see https://docs.pro.coinbase.com/#place-a-new-order
+type OrderRequest struct {
+	ProductID   string `json:"product_id"`
+	Side        string `json:"side"`
+	Type        string `json:"type"`
+	Price       string `json:"price,omitempty"`
+	Size        string `json:"size,omitempty"`
+	Funds       string `json:"funds,omitempty"`
+	TimeInForce string `json:"time_in_force,omitempty"`
+}
+
+// PlaceOrder places new order
+func (c *Client) PlaceOrder(req OrderRequest) (PlacedOrder, error) {
+	od := PlacedOrder{}
+	_, err := c.do("POST", "/orders", url.Values{}, req, &od)
+	return od, err
+}
+
+// WaitDone polls order until it is done, or until timeout.
+// Orders canceled without any fill are purged by exchange, so not found order
+// is reported as done with done reason "canceled".
+func (c *Client) WaitDone(id string, interval, timeout time.Duration) (PlacedOrder, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		od := PlacedOrder{}
+		_, err := c.do("GET", "/orders/"+url.PathEscape(id), url.Values{}, nil, &od)
+		if errors.Is(err, ErrNotFound) {
+			return PlacedOrder{ID: id, Status: "done", DoneReason: "canceled"}, nil
+		}
+		if err != nil {
+			return od, err
+		}
+		if od.Status == "done" {
+			return od, nil
+		}
+		if time.Now().After(deadline) {
+			return od, errors.Wrapf(fmt.Errorf("order is still %v after %v", od.Status, timeout), "[coinbase] failed to wait for order %v", id)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// Executor executes requests as orders on coinbase pro
+type Executor struct {
+	// Client is nil for executor of dry run only
+	Client *Client
+	// APIURL is endpoint of public product lookup of dry run
+	APIURL string
+	// PollInterval and Timeout are used to wait for order to be done
+	PollInterval time.Duration
+	Timeout      time.Duration
+}
+
+// NewExecutor returns executor with default polling interval and timeout
+func NewExecutor(client *Client) *Executor {
+	return &Executor{Client: client, APIURL: client.Endpoint, PollInterval: 500 * time.Millisecond, Timeout: 30 * time.Second}
+}
+
+// NewDryRunExecutor returns executor which only logs orders of dry run requests,
+// so dry run works without credentials
+func NewDryRunExecutor(apiURL string) *Executor {
+	return &Executor{APIURL: apiURL}
+}
+
+// Execute places request as market or limit IOC order, waits until it is done
+// and returns its fills. Order is only logged when request is dry run.
+func (e *Executor) Execute(req execution.Request) (execution.Result, error) {
+	result := execution.Result{Request: req}
+	if err := req.Validate(); err != nil {
+		return result, errors.Wrap(err, "[coinbase] malformed execution request")
+	}
+	if !req.DryRun && e.Client == nil {
+		return result, errors.Wrap(fmt.Errorf("credentials are required to place order"), "[coinbase] failed to execute request")
+	}
+	// trading rules are public, so dry run does not need credentials
+	var product Product
+	var err error
+	if req.DryRun {
+		product, err = FetchProduct(e.APIURL, req.Pair)
+	} else {
+		product, err = e.Client.Product(req.Pair)
+	}
+	if err != nil {
+		return result, err
+	}
+	body, err := ToOrderRequest(req, product)
+	if err != nil {
+		return result, err
+	}
+
+	if req.DryRun {
+		logrus.Infof("[coinbase] dry run, would place %v %v order: %+v", body.Side, body.Type, body)
+		result.Status = "dry-run"
+		return result, nil
+	}
+
+	placed, err := e.Client.PlaceOrder(body)
+	if err != nil {
+		return result, err
+	}
+	result.OrderID = placed.ID
+	done, err := e.Client.WaitDone(placed.ID, e.PollInterval, e.Timeout)
+	if err != nil {
+		return result, err
+	}
+	result.Status = done.DoneReason
+	if done.DoneReason == "canceled" && done.FilledSize.IsZero() {
+		return result, nil
+	}
+
+	fills, err := e.Client.Fills(placed.ID, "")
+	if err != nil {
+		return result, err
+	}
+	for _, f := range fills {
+		result.Fills = append(result.Fills, execution.Fill{Price: f.Price, Size: f.Size, Fee: f.Fee, Time: f.CreatedAt})
+	}
+	return result, nil
+}
+
+// ToOrderRequest transforms request into order of product.
+// Market buy spends funds, limit buy size is the most that funds can buy at limit price,
+// sizes are rounded down to base increment and limit price is rounded
+// toward favorable direction to quote increment.
+func ToOrderRequest(req execution.Request, product Product) (OrderRequest, error) {
+	body := OrderRequest{ProductID: req.Pair, Side: req.Side, Type: "market"}
+	tooSmall := errors.Wrapf(fmt.Errorf("amount %v is below increment of %v", req.Amount, req.Pair), "[coinbase] malformed execution request")
+	if !req.IsLimit() {
+		amount := roundDown(req.Amount, product.BaseIncrement)
+		if req.Side == execution.Buy {
+			amount = roundDown(req.Amount, product.QuoteIncrement)
+		}
+		if !amount.IsPositive() {
+			return body, tooSmall
+		}
+		if req.Side == execution.Buy {
+			body.Funds = amount.String()
+		} else {
+			body.Size = amount.String()
+		}
+		return body, nil
+	}
+
+	price := roundDown(req.LimitPrice, product.QuoteIncrement)
+	size := req.Amount
+	if req.Side == execution.Sell {
+		price = roundUp(req.LimitPrice, product.QuoteIncrement)
+	} else if price.IsPositive() {
+		size = req.Amount.Div(price)
+	}
+	size = roundDown(size, product.BaseIncrement)
+	if !price.IsPositive() || !size.IsPositive() {
+		return body, tooSmall
+	}
+	body.Type = "limit"
+	body.TimeInForce = "IOC"
+	body.Price = price.String()
+	body.Size = size.String()
+	return body, nil
+}
+
+func roundDown(d, increment decimal.Decimal) decimal.Decimal {
+	if !increment.IsPositive() {
+		return d.Truncate(8)
+	}
+	return d.Div(increment).Floor().Mul(increment)
+}
+
+func roundUp(d, increment decimal.Decimal) decimal.Decimal {
+	if !increment.IsPositive() {
+		return d
+	}
+	return d.Div(increment).Ceil().Mul(increment)
+}
@@ -0,0 +1,136 @@
+package coinbase
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/choestelus/super-duper-succotash/pkg/execution"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+var testProduct = Product{
+	ID:             "BTC-USD",
+	BaseIncrement:  decimal.RequireFromString("0.00000001"),
+	QuoteIncrement: decimal.RequireFromString("0.01"),
+}
+
+func TestToOrderRequest(t *testing.T) {
+	r := require.New(t)
+	d := decimal.RequireFromString
+
+	body, err := ToOrderRequest(execution.Request{Pair: "BTC-USD", Side: execution.Buy, Amount: d("100.123")}, testProduct)
+	r.NoError(err)
+	r.Equal(OrderRequest{ProductID: "BTC-USD", Side: "buy", Type: "market", Funds: "100.12"}, body)
+
+	body, err = ToOrderRequest(execution.Request{Pair: "BTC-USD", Side: execution.Sell, Amount: d("0.123456789")}, testProduct)
+	r.NoError(err)
+	r.Equal("0.12345678", body.Size)
+
+	body, err = ToOrderRequest(execution.Request{Pair: "BTC-USD", Side: execution.Buy, Amount: d("100"), LimitPrice: d("8000.019")}, testProduct)
+	r.NoError(err)
+	r.Equal(OrderRequest{ProductID: "BTC-USD", Side: "buy", Type: "limit", Price: "8000.01", Size: "0.01249998", TimeInForce: "IOC"}, body)
+
+	body, err = ToOrderRequest(execution.Request{Pair: "BTC-USD", Side: execution.Sell, Amount: d("1"), LimitPrice: d("7999.991")}, testProduct)
+	r.NoError(err)
+	r.Equal("8000", body.Price)
+	r.Equal("1", body.Size)
+
+	_, err = ToOrderRequest(execution.Request{Pair: "BTC-USD", Side: execution.Buy, Amount: d("0.001")}, testProduct)
+	r.Error(err)
+}
+
+// executionServer serves product, accepts single order and fills it in two fills
+func executionServer(t *testing.T, placed *[]OrderRequest) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/products/BTC-USD", func(w http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(w).Encode(testProduct)
+	})
+	polls := 0
+	mux.HandleFunc("/orders", func(w http.ResponseWriter, req *http.Request) {
+		body := OrderRequest{}
+		raw, _ := ioutil.ReadAll(req.Body)
+		require.NoError(t, json.Unmarshal(raw, &body))
+		*placed = append(*placed, body)
+		w.Write([]byte(`{"id":"o1","status":"pending"}`))
+	})
+	mux.HandleFunc("/orders/o1", func(w http.ResponseWriter, req *http.Request) {
+		polls++
+		if polls == 1 {
+			w.Write([]byte(`{"id":"o1","status":"open"}`))
+			return
+		}
+		w.Write([]byte(`{"id":"o1","status":"done","done_reason":"filled","filled_size":"2"}`))
+	})
+	mux.HandleFunc("/fills", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`[{"trade_id":1,"order_id":"o1","price":"8010","size":"1","fee":"4"},{"trade_id":2,"order_id":"o1","price":"8030","size":"1","fee":"4"}]`))
+	})
+	return mux
+}
+
+func TestExecutorExecute(t *testing.T) {
+	r := require.New(t)
+	placed := []OrderRequest{}
+	server := signedServer(t, testCredentials, executionServer(t, &placed).ServeHTTP)
+	defer server.Close()
+
+	client, err := NewClient(server.URL, testCredentials)
+	r.NoError(err)
+	executor := NewExecutor(client)
+	executor.PollInterval = time.Millisecond
+
+	req := execution.Request{
+		Pair:        "BTC-USD",
+		Side:        execution.Sell,
+		Amount:      decimal.RequireFromString("2"),
+		LimitPrice:  decimal.RequireFromString("8000"),
+		QuotedPrice: decimal.RequireFromString("8040"),
+	}
+	result, err := executor.Execute(req)
+	r.NoError(err)
+	r.Len(placed, 1)
+	r.Equal("IOC", placed[0].TimeInForce)
+	r.Equal("o1", result.OrderID)
+	r.Equal("filled", result.Status)
+	r.Len(result.Fills, 2)
+	r.Equal("8020", result.AveragePrice().String())
+	r.True(result.SlippageBps().IsPositive())
+
+	req.DryRun = true
+	result, err = executor.Execute(req)
+	r.Error(err, "product of dry run is fetched without signature")
+
+	public := httptest.NewServer(executionServer(t, &placed))
+	defer public.Close()
+	for _, executor := range []*Executor{NewExecutor(client), NewDryRunExecutor(public.URL)} {
+		executor.APIURL = public.URL
+		result, err = executor.Execute(req)
+		r.NoError(err)
+		r.Len(placed, 1, "dry run must not place order")
+		r.Equal("dry-run", result.Status)
+	}
+
+	req.DryRun = false
+	_, err = NewDryRunExecutor(public.URL).Execute(req)
+	r.Error(err, "credentials are required to place order")
+	r.Len(placed, 1)
+}
+
+func TestWaitDoneCanceled(t *testing.T) {
+	r := require.New(t)
+	server := signedServer(t, testCredentials, func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message":"NotFound"}`))
+	})
+	defer server.Close()
+
+	client, err := NewClient(server.URL, testCredentials)
+	r.NoError(err)
+	od, err := client.WaitDone("o1", time.Millisecond, time.Second)
+	r.NoError(err)
+	r.Equal("canceled", od.DoneReason)
+}
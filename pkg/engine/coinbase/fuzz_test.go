@@ -0,0 +1,115 @@
+//go:build go1.18
+// +build go1.18
+
+package coinbase
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// native fuzzing requires go 1.18, so this file is excluded by build constraint
+// on older go that go.mod supports, and the rest of package tests still compile.
+// Seed corpus is run along with other tests,
+// run e.g. go test ./pkg/engine/coinbase/ -run '^$' -fuzz FuzzToOrderBook to fuzz
+
+var fuzzBookSeeds = []string{
+	`{"sequence":7371656227,"bids":[["170.95","0.34084807",1]],"asks":[["170.97","7.64562173",3]]}`,
+	`{"sequence":"7371656227","bids":[[ "170.95" , "0.34084807", 1 ], [170.9, 2.5, 1.0]],"asks":[]}`,
+	`{"sequence":7371931270,"bids":[["170.26","1","c443f5ce-354d-43e6-a279-a0cea25e3f32"]],"asks":[["170.29","21.128","dd98f6ea-6e2b-496d-971b-81df71cbb66e"]]}`,
+	`{"sequence":12345678901234567890,"bids":[],"asks":[]}`,
+	`{"sequence":1,"bids":[["1e3","-0.5",1e2]],"asks":[]}`,
+	`{"sequence":1,"bids":[["1","2"]],"asks":[]}`,
+	`{"message":"NotFound"}`,
+}
+
+func FuzzToOrderBook(f *testing.F) {
+	for _, seed := range fuzzBookSeeds {
+		f.Add([]byte(seed))
+	}
+	f.Add(benchmarkBook(3, false))
+	f.Add(benchmarkBook(3, true))
+	at := time.Date(2019, 10, 17, 0, 0, 0, 0, time.UTC)
+
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		book, err := ToOrderBook(raw, at)
+		if err != nil {
+			return
+		}
+		if book.Sequence.IsZero() {
+			t.Fatalf("decoded book without sequence from %s", raw)
+		}
+		if book.Bids == nil || book.Asks == nil {
+			t.Fatalf("decoded book with nil side from %s", raw)
+		}
+
+		// decoding from reader agrees with decoding from bytes
+		streamed, err := DecodeOrderBook(bytes.NewReader(raw), at)
+		if err != nil {
+			t.Fatalf("DecodeOrderBook failed on %s decoded by ToOrderBook: %v", raw, err)
+		}
+		if streamed.Sequence != book.Sequence || len(streamed.Bids) != len(book.Bids) || len(streamed.Asks) != len(book.Asks) {
+			t.Fatalf("DecodeOrderBook %+v differs from ToOrderBook %+v", streamed, book)
+		}
+	})
+}
+
+func FuzzToOrder(f *testing.F) {
+	for _, seed := range []string{
+		`["1","2",3]`,
+		`["295.97","5.72036512","da863862-25f4-4868-ac41-005d11ab0a5f"]`,
+		`["170.9","2.5",1.0]`,
+		`["1","2"]`,
+		`[]`,
+		`["1","2",true]`,
+		`{"price":"1"}`,
+		`"1"`,
+	} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		var rawOrder interface{}
+		if err := json.Unmarshal(raw, &rawOrder); err != nil {
+			return
+		}
+		od, err := ToOrder(rawOrder)
+		if err != nil {
+			return
+		}
+
+		// typed level decoder accepts less, e.g. no escaped strings,
+		// but levels accepted by both are the same
+		var l level
+		if err := l.UnmarshalJSON(raw); err != nil {
+			return
+		}
+		if !od.Price.Equal(l.Price) || !od.Size.Equal(l.Size) || od.OrderID != l.OrderID {
+			t.Fatalf("ToOrder %+v differs from typed level %+v of %s", od, l, raw)
+		}
+	})
+}
+
+func FuzzParsePlainDecimal(f *testing.F) {
+	for _, seed := range []string{"170.95", "0.34084807", "-1", "100.00", "0", ".5", "5.", "999999999999999999", "1e3", "--1", ""} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, token string) {
+		d, ok := parsePlainDecimal([]byte(token))
+		if !ok {
+			return
+		}
+		expected, err := decimal.NewFromString(token)
+		if err != nil {
+			t.Fatalf("parsed %q as %v, but decimal.NewFromString failed: %v", token, d, err)
+		}
+		if !expected.Equal(d) || expected.Exponent() != d.Exponent() {
+			t.Fatalf("parsed %q as %v exponent %v, expected %v exponent %v", token, d, d.Exponent(), expected, expected.Exponent())
+		}
+	})
+}
@@ -0,0 +1,103 @@
+package coinbase
+
+import (
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/choestelus/super-duper-succotash/pkg/candle"
+)
+
+// CandleFetcher pages through candles API for arbitrary date range
+// with shared client of endpoint, which keeps request rate under public rate limit,
+// requests are retried with backoff when rate limited
+type CandleFetcher struct {
+	Endpoint    string
+	Pair        string
+	Granularity time.Duration
+	// RequestInterval is minimum interval between requests on top of rate limit of shared client
+	RequestInterval time.Duration
+	// MaxRetries is maximum number of retries of single page when rate limited
+	MaxRetries int
+	// Backoff is initial wait before retry when server does not send Retry-After,
+	// doubled on every retry
+	Backoff time.Duration
+
+	client      *HTTPClient
+	lastRequest time.Time
+}
+
+// NewCandleFetcher returns fetcher with public rate limit defaults
+func NewCandleFetcher(endpoint, pair string, granularity time.Duration) *CandleFetcher {
+	return &CandleFetcher{
+		Endpoint:    endpoint,
+		Pair:        pair,
+		Granularity: granularity,
+		MaxRetries:  5,
+		Backoff:     time.Second,
+		client:      SharedHTTPClient(endpoint),
+	}
+}
+
+// Fetch fetches candles within [start, end) page by page, each page holds
+// at most MaxCandlesPerRequest candles and is passed to handle in chronological order
+func (f *CandleFetcher) Fetch(start, end time.Time, handle func([]candle.Candle) error) error {
+	start = start.UTC().Truncate(f.Granularity)
+	window := f.Granularity * MaxCandlesPerRequest
+	for pageStart := start; pageStart.Before(end); pageStart = pageStart.Add(window) {
+		// end of range is inclusive, stop before next page start to avoid duplicates
+		pageEnd := pageStart.Add(window - f.Granularity)
+		if !pageEnd.Before(end) {
+			pageEnd = end.Add(-time.Second)
+		}
+		if pageEnd.Before(pageStart) {
+			pageEnd = pageStart
+		}
+
+		raw, err := f.fetchPage(pageStart, pageEnd)
+		if err != nil {
+			return err
+		}
+		candles, err := ToCandles(raw, f.Pair, f.Granularity)
+		if err != nil {
+			return errors.Wrapf(err, "[coinbase] malformed candles page %v - %v", pageStart, pageEnd)
+		}
+
+		page := candles[:0]
+		for _, c := range candles {
+			if !c.Start.Before(pageStart) && c.Start.Before(end) {
+				page = append(page, c)
+			}
+		}
+		if err := handle(page); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetchPage requests single page, waiting for request interval
+// and retrying when rate limited
+func (f *CandleFetcher) fetchPage(start, end time.Time) ([]byte, error) {
+	queryURL, prepare, err := candlesRequest(f.Endpoint, f.Pair, f.Granularity, start, end)
+	if err != nil {
+		return nil, err
+	}
+	if wait := f.RequestInterval - time.Since(f.lastRequest); wait > 0 {
+		time.Sleep(wait)
+	}
+	f.lastRequest = time.Now()
+
+	resp, err := f.client.DoWithRetry("GET", queryURL, f.MaxRetries, f.Backoff, prepare)
+	if err != nil {
+		return nil, err
+	}
+	if err := newAPIError("GET", queryURL, resp); err != nil {
+		return nil, errors.Wrap(err, "[coinbase] failed to fetch candles")
+	}
+	return resp.Body(), nil
+}
+
+// FetchHistory pages through candles of configured pair within [start, end)
+func (e Engine) FetchHistory(interval time.Duration, start, end time.Time, handle func([]candle.Candle) error) error {
+	return NewCandleFetcher(e.APIURL, e.Pair, interval).Fetch(start, end, handle)
+}
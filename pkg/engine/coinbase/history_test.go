@@ -0,0 +1,85 @@
+package coinbase
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/choestelus/super-duper-succotash/pkg/candle"
+	"github.com/stretchr/testify/require"
+)
+
+// candleServer serves one candle per granularity within requested range,
+// every other request is rate limited
+func candleServer(t *testing.T) (*httptest.Server, *int) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		if requests%2 == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"message":"Slow rate limit exceeded"}`))
+			return
+		}
+		q := req.URL.Query()
+		start, _ := time.Parse(time.RFC3339, q.Get("start"))
+		end, _ := time.Parse(time.RFC3339, q.Get("end"))
+		buckets := []string{}
+		// newest first, end is inclusive
+		for ts := end.Truncate(time.Minute); !ts.Before(start); ts = ts.Add(-time.Minute) {
+			buckets = append(buckets, fmt.Sprintf("[%v,1,2,1.5,1.7,10]", ts.Unix()))
+		}
+		w.Write([]byte("[" + strings.Join(buckets, ",") + "]"))
+	}))
+	return server, &requests
+}
+
+func TestCandleFetcher(t *testing.T) {
+	r := require.New(t)
+	server, requests := candleServer(t)
+	defer server.Close()
+
+	fetcher := NewCandleFetcher(server.URL, "BTC-USD", time.Minute)
+	fetcher.RequestInterval = 0
+	fetcher.Backoff = time.Millisecond
+
+	start := time.Date(2019, 10, 17, 0, 0, 0, 0, time.UTC)
+	end := start.Add(700 * time.Minute)
+
+	pages := 0
+	candles := []candle.Candle{}
+	err := fetcher.Fetch(start, end, func(page []candle.Candle) error {
+		pages++
+		r.True(len(page) <= MaxCandlesPerRequest)
+		candles = append(candles, page...)
+		return nil
+	})
+	r.NoError(err)
+	r.Equal(3, pages)
+	// every page is rate limited once
+	r.Equal(6, *requests)
+	r.Len(candles, 700)
+	for i, c := range candles {
+		r.Equal(start.Add(time.Duration(i)*time.Minute), c.Start)
+	}
+}
+
+func TestCandleFetcherGiveUp(t *testing.T) {
+	r := require.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	fetcher := NewCandleFetcher(server.URL, "BTC-USD", time.Minute)
+	fetcher.RequestInterval = 0
+	fetcher.Backoff = time.Millisecond
+	fetcher.MaxRetries = 2
+
+	start := time.Date(2019, 10, 17, 0, 0, 0, 0, time.UTC)
+	err := fetcher.Fetch(start, start.Add(time.Hour), func([]candle.Candle) error { return nil })
+	r.Error(err)
+}
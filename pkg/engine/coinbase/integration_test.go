@@ -0,0 +1,316 @@
+package coinbase
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/choestelus/super-duper-succotash/pkg/engine/coinbase/coinbasetest"
+	"github.com/choestelus/super-duper-succotash/pkg/order"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+// saneBook is valid level 2 book of ETH-USD
+var saneBook = order.Book{
+	Sequence: 7371656227,
+	Bids: []order.Order{
+		{Price: decimal.RequireFromString("170.95"), Size: decimal.RequireFromString("3"), NumOrders: 1},
+		{Price: decimal.RequireFromString("170.9"), Size: decimal.RequireFromString("5"), NumOrders: 2},
+	},
+	Asks: []order.Order{
+		{Price: decimal.RequireFromString("170.97"), Size: decimal.RequireFromString("2"), NumOrders: 1},
+		{Price: decimal.RequireFromString("171"), Size: decimal.RequireFromString("10"), NumOrders: 3},
+	},
+}
+
+func fakeEngine(s *coinbasetest.Server, invalidBook string) Engine {
+	return Engine{}.Configure(map[string]string{
+		"api_url":       s.URL,
+		"ws_url":        s.WSURL,
+		"api_level":     "2",
+		"pair":          "ETH-USD",
+		"poll_interval": "10ms",
+		"invalid_book":  invalidBook,
+		"rate_limit":    "100",
+		"rate_burst":    "10",
+	}).(Engine)
+}
+
+func TestEngineOneShot(t *testing.T) {
+	r := require.New(t)
+	s := coinbasetest.NewServer()
+	defer s.Close()
+	s.SetLatency(20 * time.Millisecond)
+	s.ScriptBook("ETH-USD", coinbasetest.BookResponse(saneBook))
+
+	start := time.Now()
+	book := fakeEngine(s, PolicyFail).OneShot(nil)
+	r.True(time.Since(start) >= 20*time.Millisecond)
+	r.Equal(saneBook.Sequence, book.Sequence)
+	r.Len(book.Bids, 2)
+	r.True(saneBook.Asks[1].Size.Equal(book.Asks[1].Size))
+	r.Equal(int64(3), book.Asks[1].NumOrders)
+}
+
+func TestEngineOneShotPanics(t *testing.T) {
+	r := require.New(t)
+	for name, resp := range map[string]coinbasetest.Response{
+		"server error": coinbasetest.ServerError(http.StatusServiceUnavailable),
+		"not found":    coinbasetest.NotFound(),
+	} {
+		s := coinbasetest.NewServer()
+		s.ScriptBook("ETH-USD", resp)
+		r.Panics(func() { fakeEngine(s, PolicyResync).OneShot(nil) }, name)
+		r.Equal(1, s.Requests(coinbasetest.BookPath("ETH-USD")), "%v is not retried", name)
+		s.Close()
+	}
+
+	s := coinbasetest.NewServer()
+	defer s.Close()
+	s.ScriptBook("ETH-USD", coinbasetest.TooManyRequests(0))
+	SharedHTTPClient(s.URL).Backoff = time.Millisecond
+	r.Panics(func() { fakeEngine(s, PolicyResync).OneShot(nil) }, "still rate limited after retries")
+	r.Equal(1+SharedHTTPClient(s.URL).MaxRetries, s.Requests(coinbasetest.BookPath("ETH-USD")))
+
+	s = coinbasetest.NewServer()
+	defer s.Close()
+	r.Panics(func() { MustFetch(s.URL, 3, "ETH-USD", PolicyResync) }, "level 3 is not fetched by REST API")
+	r.Zero(s.Requests(coinbasetest.BookPath("ETH-USD")))
+}
+
+func TestEngineMalformedBook(t *testing.T) {
+	r := require.New(t)
+	s := coinbasetest.NewServer()
+	defer s.Close()
+	s.ScriptBook("ETH-USD", coinbasetest.Malformed(), coinbasetest.BookResponse(saneBook))
+	r.Equal(saneBook.Sequence, fakeEngine(s, PolicyResync).OneShot(nil).Sequence, "malformed book is refetched")
+	r.Equal(2, s.Requests(coinbasetest.BookPath("ETH-USD")))
+
+	s = coinbasetest.NewServer()
+	defer s.Close()
+	s.ScriptBook("ETH-USD", coinbasetest.Malformed())
+	r.Panics(func() { fakeEngine(s, PolicyResync).OneShot(nil) }, "resync gives up")
+	r.Equal(1+maxResyncs, s.Requests(coinbasetest.BookPath("ETH-USD")))
+	r.Panics(func() { fakeEngine(s, PolicyFail).OneShot(nil) })
+
+	_, ok, err := fetchValid(s.URL, 2, "ETH-USD", PolicyDrop)
+	r.NoError(err)
+	r.False(ok, "malformed book is dropped")
+}
+
+func TestEngineFetchBook(t *testing.T) {
+	r := require.New(t)
+	s := coinbasetest.NewServer()
+	defer s.Close()
+	s.ScriptBook("ETH-USD", coinbasetest.ServerError(http.StatusServiceUnavailable), coinbasetest.Malformed(), coinbasetest.NotFound())
+	engine := fakeEngine(s, PolicyDrop)
+
+	_, err := engine.FetchBook(nil)
+	r.Error(err)
+	r.True(temporary(err), "server error is returned instead of panic")
+
+	_, err = engine.FetchBook(nil)
+	r.Error(err)
+	dropped, ok := err.(droppedBookError)
+	r.True(ok, "dropped book is returned as error")
+	r.True(dropped.Temporary())
+
+	_, err = engine.FetchBook(nil)
+	r.Error(err)
+	r.False(temporary(err))
+}
+
+func TestEngineRateLimited(t *testing.T) {
+	r := require.New(t)
+	s := coinbasetest.NewServer()
+	defer s.Close()
+	s.ScriptBook("ETH-USD", coinbasetest.TooManyRequests(time.Second), coinbasetest.BookResponse(saneBook))
+
+	engine := fakeEngine(s, PolicyFail)
+	start := time.Now()
+	book := engine.OneShot(nil)
+	r.True(time.Since(start) >= time.Second, "Retry-After is honored")
+	r.Equal(saneBook.Sequence, book.Sequence)
+	r.Equal(2, s.Requests(coinbasetest.BookPath("ETH-USD")))
+
+	stats := engine.HTTPStats()
+	r.Equal(int64(2), stats.Requests)
+	r.Equal(int64(1), stats.RateLimited)
+	r.Equal(int64(1), stats.Retries)
+	r.Equal(int64(1), stats.Throttled, "retry waits for pause")
+
+	r.Panics(func() {
+		MustParseConfig(map[string]string{"api_url": s.URL, "rate_limit": "0", "rate_burst": "1"})
+	})
+	r.Panics(func() {
+		MustParseConfig(map[string]string{"api_url": s.URL, "rate_burst": "5"})
+	})
+	r.Equal(1, MustParseConfig(map[string]string{"api_url": s.URL, "rate_limit": "2"}).RateBurst, "burst defaults to 1")
+}
+
+func TestEngineConflictingRateLimit(t *testing.T) {
+	r := require.New(t)
+	s := coinbasetest.NewServer()
+	defer s.Close()
+
+	parsed := MustParseConfig(map[string]string{"api_url": s.URL, "rate_limit": "1"})
+	r.Equal(1.0, parsed.RateLimit)
+	r.Zero(SharedHTTPClient(s.URL).limit.rate, "parsing does not apply limit")
+
+	fakeEngine(s, PolicyFail)
+	fakeEngine(s, PolicyDrop)
+	r.Panics(func() {
+		Engine{}.Configure(map[string]string{"api_url": s.URL, "rate_limit": "1"})
+	}, "engine of the same api_url must not configure different limit")
+	r.Panics(func() {
+		Engine{}.Configure(map[string]string{"api_url": s.URL})
+	}, "default limit differs too")
+
+	client := NewHTTPClient(1, 1)
+	r.NoError(client.Limit(2, 1))
+	r.NoError(client.Limit(2, 1))
+	r.Error(client.Limit(2, 2))
+}
+
+func TestEngineOpenStream(t *testing.T) {
+	r := require.New(t)
+	// server is left open, since stream keeps polling until process exits
+	s := coinbasetest.NewServer()
+	crossed := saneBook
+	crossed.Sequence = 1
+	crossed.Bids = []order.Order{{Price: decimal.RequireFromString("171.5"), Size: decimal.RequireFromString("1"), NumOrders: 1}}
+	next := saneBook
+	next.Sequence = saneBook.Sequence + 5
+	s.ScriptBook("ETH-USD",
+		coinbasetest.BookResponse(saneBook),
+		coinbasetest.BookResponse(crossed),
+		coinbasetest.BookResponse(next),
+	)
+
+	books := fakeEngine(s, PolicyDrop).OpenStream(nil)
+	r.Equal(saneBook.Sequence, (<-books).Sequence)
+	r.Equal(next.Sequence, (<-books).Sequence, "crossed book is dropped")
+	r.True(s.Requests(coinbasetest.BookPath("ETH-USD")) >= 3)
+}
+
+func TestEngineStreamDropsAfterResync(t *testing.T) {
+	r := require.New(t)
+	// server is left open, since stream keeps polling until process exits
+	s := coinbasetest.NewServer()
+	crossed := saneBook
+	crossed.Sequence = 1
+	crossed.Bids = []order.Order{{Price: decimal.RequireFromString("171.5"), Size: decimal.RequireFromString("1"), NumOrders: 1}}
+	responses := []coinbasetest.Response{}
+	for i := 0; i < 1+maxResyncs; i++ {
+		responses = append(responses, coinbasetest.BookResponse(crossed))
+	}
+	s.ScriptBook("ETH-USD", append(responses, coinbasetest.BookResponse(saneBook))...)
+
+	books := fakeEngine(s, PolicyResync).OpenStream(nil)
+	r.Equal(saneBook.Sequence, (<-books).Sequence, "crossed book is dropped after resyncs instead of panic")
+	r.True(s.Requests(coinbasetest.BookPath("ETH-USD")) >= 2+maxResyncs)
+}
+
+func TestEngineStreamSkipsTemporaryErrors(t *testing.T) {
+	r := require.New(t)
+	// server is left open, since stream keeps polling until process exits
+	s := coinbasetest.NewServer()
+	next := saneBook
+	next.Sequence = saneBook.Sequence + 1
+	s.ScriptBook("ETH-USD",
+		coinbasetest.ServerError(http.StatusServiceUnavailable),
+		coinbasetest.Malformed(),
+		coinbasetest.BookResponse(saneBook),
+		coinbasetest.ServerError(http.StatusBadGateway),
+		coinbasetest.BookResponse(next),
+	)
+
+	books := fakeEngine(s, PolicyDrop).OpenStream(nil)
+	r.Equal(saneBook.Sequence, (<-books).Sequence, "server error is skipped")
+	r.Equal(next.Sequence, (<-books).Sequence)
+	r.True(s.Requests(coinbasetest.BookPath("ETH-USD")) >= 5)
+
+	r.True(temporary(&APIError{Status: http.StatusTooManyRequests}))
+	r.True(temporary(&APIError{Status: http.StatusServiceUnavailable}))
+	r.False(temporary(&APIError{Status: http.StatusNotFound}))
+	r.False(temporary(&APIError{Status: http.StatusUnauthorized}))
+	_, _, err := fetchValid("http://127.0.0.1:0", 2, "ETH-USD", PolicyDrop)
+	r.True(temporary(err), "network error: %v", err)
+	_, _, err = fetchValid(s.URL, 3, "ETH-USD", PolicyDrop)
+	r.False(temporary(err), "malformed params: %v", err)
+}
+
+func TestEngineTradeStream(t *testing.T) {
+	r := require.New(t)
+	s := coinbasetest.NewServer()
+	defer s.Close()
+	feed := coinbasetest.NewFeed("ETH-USD", 100).
+		Match(1, "buy", "170.95", "0.5").
+		Match(2, "sell", "170.97", "1.5")
+	s.ScriptFeed("matches", feed.Messages()...)
+
+	received := []int64{}
+	for trade := range fakeEngine(s, PolicyResync).OpenTradeStream(nil) {
+		r.Equal("ETH-USD", trade.Pair)
+		received = append(received, trade.TradeID)
+	}
+	r.Equal([]int64{1, 2}, received)
+}
+
+func TestReadFeedSequenceGap(t *testing.T) {
+	r := require.New(t)
+	s := coinbasetest.NewServer()
+	defer s.Close()
+	feed := coinbasetest.NewFeed("ETH-USD", 50).
+		Received("buy", "a", "170.95", "1").
+		Open("buy", "a", "170.95", "1").
+		Gap(3).
+		Change("buy", "a", "170.95", "1", "0.5").
+		Done("buy", "a", "170.95", "0.5", "canceled")
+	s.ScriptFeed("full", feed.Messages()...)
+
+	conn, err := OpenFeed(s.WSURL, "ETH-USD", "full")
+	r.NoError(err)
+	var prev order.Sequence
+	gaps := []uint64{}
+	readFeed(conn, func(msg feedMessage) {
+		if msg.Type == "subscriptions" {
+			return
+		}
+		if !prev.IsZero() && !msg.Sequence.Follows(prev) {
+			gaps = append(gaps, msg.Sequence.Missing(prev))
+		}
+		prev = msg.Sequence
+	})
+	r.Equal([]uint64{3}, gaps)
+	r.Equal(order.Sequence(56), prev)
+}
+
+func TestReadFeedErrors(t *testing.T) {
+	r := require.New(t)
+	s := coinbasetest.NewServer()
+	defer s.Close()
+	s.ScriptFeed("full", append([]string{`{"type":`},
+		coinbasetest.NewFeed("ETH-USD", 1).Error("Failed to subscribe", "ETH-XXX is not a valid product").Messages()...)...)
+	conn, err := OpenFeed(s.WSURL, "ETH-USD", "full")
+	r.NoError(err)
+	err = readFeed(conn, func(feedMessage) {})
+	r.True(errors.As(err, &feedError{}), "malformed message is skipped until error message: %v", err)
+
+	s.ScriptFeed("matches", append(
+		coinbasetest.NewFeed("ETH-USD", 1).Error("Failed to subscribe", "ETH-XXX is not a valid product").Messages(),
+		coinbasetest.NewFeed("ETH-USD", 2).Match(1, "buy", "170.95", "0.5").Messages()...)...)
+	trades, err := StreamTrades(s.WSURL, "ETH-USD")
+	r.NoError(err)
+	_, ok := <-trades
+	r.False(ok, "trade stream is closed on error message")
+
+	s = coinbasetest.NewServer()
+	s.Close()
+	_, err = OpenFeed(s.WSURL, "ETH-USD", "full")
+	r.Error(err, "closed server")
+	r.Panics(func() { MustStreamTrades(s.WSURL, "ETH-USD") })
+	r.Panics(func() { MustStreamTrades("", "ETH-USD") })
+}
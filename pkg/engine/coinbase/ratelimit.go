@@ -0,0 +1,256 @@
+package coinbase
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/go-resty/resty/v2"
+	"github.com/sirupsen/logrus"
+)
+
+// Rate limits of coinbase pro API in requests per second and burst of requests,
+// limits are per IP address for public endpoints and per API key for private endpoints
+// see https://docs.pro.coinbase.com/#rate-limits
+const (
+	PublicRateLimit  = 3
+	PublicBurst      = 6
+	PrivateRateLimit = 5
+	PrivateBurst     = 10
+)
+
+// Limiter is token bucket of request budget refilled at rate requests per second up to burst requests,
+// implemented as generic cell rate algorithm so that waiting requests are served in order
+type Limiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	// tolerance is how far ahead of schedule burst of requests may be sent
+	tolerance time.Duration
+	// tat is theoretical arrival time of the next request
+	tat time.Time
+	now func() time.Time
+}
+
+// NewLimiter returns limiter with full bucket
+func NewLimiter(rate float64, burst int) *Limiter {
+	l := &Limiter{now: time.Now}
+	l.SetRate(rate, burst)
+	return l
+}
+
+// SetRate changes rate and burst of limiter, non-positive burst is taken as 1
+func (l *Limiter) SetRate(rate float64, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if burst < 1 {
+		burst = 1
+	}
+	l.interval = time.Duration(float64(time.Second) / rate)
+	l.tolerance = l.interval * time.Duration(burst-1)
+}
+
+// Reserve takes one request from budget and returns how long to wait before sending it
+func (l *Limiter) Reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if l.tat.Before(now) {
+		l.tat = now
+	}
+	wait := l.tat.Sub(now) - l.tolerance
+	l.tat = l.tat.Add(l.interval)
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// Wait blocks until request can be sent, and returns how long it waited
+func (l *Limiter) Wait() time.Duration {
+	wait := l.Reserve()
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+	return wait
+}
+
+// Pause holds every request for d and empties bucket, so that burst is not sent
+// right after pause e.g. when server asks to retry after d
+func (l *Limiter) Pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := l.now().Add(d + l.tolerance); until.After(l.tat) {
+		l.tat = until
+	}
+}
+
+// Stats counts requests of HTTPClient
+type Stats struct {
+	// Requests is number of sent requests, including retries
+	Requests int64 `json:"requests"`
+	// Throttled is number of requests delayed by limiter, for ThrottledFor in total
+	Throttled    int64         `json:"throttled"`
+	ThrottledFor time.Duration `json:"throttled_for"`
+	// RateLimited is number of 429 responses, Retries is number of them retried
+	RateLimited int64 `json:"rate_limited"`
+	Retries     int64 `json:"retries"`
+}
+
+// HTTPClient is HTTP client shared by every call to the same API, which reuses connections,
+// keeps requests within rate limit and retries rate limited requests
+type HTTPClient struct {
+	// MaxRetries is maximum number of retries of rate limited request
+	MaxRetries int
+	// Backoff is initial wait before retry when server does not send Retry-After,
+	// doubled on every retry
+	Backoff time.Duration
+
+	client  *resty.Client
+	limiter *Limiter
+
+	mu    sync.Mutex
+	stats Stats
+	// limit is rate and burst applied by Limit, zero until applied
+	limit struct {
+		rate  float64
+		burst int
+	}
+}
+
+// NewHTTPClient returns client limited to rate requests per second with burst
+func NewHTTPClient(rate float64, burst int) *HTTPClient {
+	return &HTTPClient{
+		MaxRetries: 5,
+		Backoff:    time.Second,
+		client:     resty.New(),
+		limiter:    NewLimiter(rate, burst),
+	}
+}
+
+var (
+	sharedMu      sync.Mutex
+	sharedClients = map[string]*HTTPClient{}
+)
+
+// sharedHTTPClient returns client of key, created with rate and burst on first use
+func sharedHTTPClient(key string, rate float64, burst int) *HTTPClient {
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+	client, ok := sharedClients[key]
+	if !ok {
+		client = NewHTTPClient(rate, burst)
+		sharedClients[key] = client
+	}
+	return client
+}
+
+// SharedHTTPClient returns client shared by every public call to endpoint,
+// which is limited to public rate limit until changed by Limit or SetRate
+func SharedHTTPClient(endpoint string) *HTTPClient {
+	return sharedHTTPClient(endpoint, PublicRateLimit, PublicBurst)
+}
+
+// SetRate changes rate limit of client
+func (h *HTTPClient) SetRate(rate float64, burst int) {
+	h.limiter.SetRate(rate, burst)
+}
+
+// Limit applies rate limit of configured engine to client, unlike SetRate
+// it fails when different limit is already applied by another engine of the same client
+func (h *HTTPClient) Limit(rate float64, burst int) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.limit.rate != 0 && (h.limit.rate != rate || h.limit.burst != burst) {
+		return fmt.Errorf("conflicting rate limit of %v requests per second with burst %v, already limited to %v with burst %v",
+			rate, burst, h.limit.rate, h.limit.burst)
+	}
+	h.limit.rate, h.limit.burst = rate, burst
+	h.limiter.SetRate(rate, burst)
+	return nil
+}
+
+// Stats returns snapshot of request counters
+func (h *HTTPClient) Stats() Stats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.stats
+}
+
+// Do sends request of method to url with MaxRetries and Backoff of client,
+// see DoWithRetry
+func (h *HTTPClient) Do(method, url string, prepare func(req *resty.Request)) (*resty.Response, error) {
+	return h.DoWithRetry(method, url, h.MaxRetries, h.Backoff, prepare)
+}
+
+// DoWithRetry sends request of method to url, waiting for rate limit before every attempt.
+// prepare sets up fresh request of every attempt, e.g. query and signature, and may be nil.
+// Rate limited request is retried up to retries times after Retry-After, or after backoff
+// doubled on every retry when header is absent, meanwhile every other request of client is paused.
+// The last response is returned when still rate limited, so caller can tell it by status
+func (h *HTTPClient) DoWithRetry(method, url string, retries int, backoff time.Duration, prepare func(req *resty.Request)) (*resty.Response, error) {
+	for attempt := 0; ; attempt++ {
+		wait := h.limiter.Wait()
+		req := h.client.R()
+		if prepare != nil {
+			prepare(req)
+		}
+		resp, err := req.Execute(method, url)
+		h.count(wait, resp)
+		if err != nil {
+			return nil, errors.Wrapf(err, "[coinbase] failed to call %v %v", method, url)
+		}
+		if resp.StatusCode() != http.StatusTooManyRequests || attempt >= retries {
+			return resp, nil
+		}
+
+		wait = retryAfter(resp, backoff)
+		h.limiter.Pause(wait)
+		backoff *= 2
+		stats := h.retried()
+		logrus.Warnf("[coinbase] rate limited %v %v, retry in %v (%v of %v requests rate limited)", method, url, wait, stats.RateLimited, stats.Requests)
+	}
+}
+
+// count records sent request, throttled for wait
+func (h *HTTPClient) count(wait time.Duration, resp *resty.Response) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.stats.Requests++
+	if wait > 0 {
+		h.stats.Throttled++
+		h.stats.ThrottledFor += wait
+		logrus.Debugf("[coinbase] request throttled for %v", wait)
+	}
+	if resp != nil && resp.StatusCode() == http.StatusTooManyRequests {
+		h.stats.RateLimited++
+	}
+}
+
+// retried records retry of rate limited request and returns updated stats
+func (h *HTTPClient) retried() Stats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.stats.Retries++
+	return h.stats
+}
+
+// retryAfter returns wait duration from Retry-After header in seconds,
+// or fallback when header is absent or malformed
+func retryAfter(resp *resty.Response, fallback time.Duration) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header().Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return fallback
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// validateRate checks rate limit configuration
+func validateRate(rate float64, burst int) error {
+	if rate <= 0 || burst < 1 {
+		return fmt.Errorf("rate limit must be positive, got %v requests per second with burst %v", rate, burst)
+	}
+	return nil
+}
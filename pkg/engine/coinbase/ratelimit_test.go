@@ -0,0 +1,111 @@
+package coinbase
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/choestelus/super-duper-succotash/pkg/engine/coinbase/coinbasetest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter(t *testing.T) {
+	r := require.New(t)
+	now := time.Date(2019, 10, 17, 0, 0, 0, 0, time.UTC)
+	l := NewLimiter(4, 3)
+	l.now = func() time.Time { return now }
+
+	// burst is sent right away, then requests are spaced by 1/rate in order
+	waits := []time.Duration{}
+	for i := 0; i < 5; i++ {
+		waits = append(waits, l.Reserve())
+	}
+	r.Equal([]time.Duration{0, 0, 0, 250 * time.Millisecond, 500 * time.Millisecond}, waits)
+
+	// bucket is refilled at rate up to burst
+	now = now.Add(10 * time.Second)
+	for i := 0; i < 3; i++ {
+		r.Zero(l.Reserve())
+	}
+	r.Equal(250*time.Millisecond, l.Reserve())
+
+	// pause holds every request and empties bucket
+	now = now.Add(10 * time.Second)
+	l.Pause(2 * time.Second)
+	r.Equal(2*time.Second, l.Reserve())
+	r.Equal(2*time.Second+250*time.Millisecond, l.Reserve())
+	l.Pause(time.Second)
+	r.Equal(2*time.Second+500*time.Millisecond, l.Reserve(), "shorter pause does not bring requests forward")
+
+	l.SetRate(1, 1)
+	now = now.Add(time.Minute)
+	r.Zero(l.Reserve())
+	r.Equal(time.Second, l.Reserve())
+}
+
+func TestHTTPClientRetry(t *testing.T) {
+	r := require.New(t)
+	s := coinbasetest.NewServer()
+	defer s.Close()
+	s.Script("/time", coinbasetest.TooManyRequests(0), coinbasetest.TooManyRequests(0), coinbasetest.Response{Body: `{}`})
+
+	client := NewHTTPClient(1000, 10)
+	client.Backoff = 20 * time.Millisecond
+	start := time.Now()
+	resp, err := client.Do("GET", s.URL+"/time", nil)
+	r.NoError(err)
+	r.Equal(200, resp.StatusCode())
+	r.True(time.Since(start) >= 60*time.Millisecond, "backoff is doubled")
+	r.Equal(Stats{Requests: 3, Throttled: 2, ThrottledFor: client.Stats().ThrottledFor, RateLimited: 2, Retries: 2}, client.Stats())
+
+	s.Script("/accounts", coinbasetest.TooManyRequests(0))
+	resp, err = client.DoWithRetry("GET", s.URL+"/accounts", 1, time.Millisecond, nil)
+	r.NoError(err)
+	r.Equal(429, resp.StatusCode(), "last rate limited response is returned")
+	r.Equal(2, s.Requests("/accounts"))
+
+	_, err = client.Do("GET", "http://127.0.0.1:0/time", nil)
+	r.Error(err)
+}
+
+func TestHTTPClientPausesOtherRequests(t *testing.T) {
+	r := require.New(t)
+	s := coinbasetest.NewServer()
+	defer s.Close()
+	s.Script("/limited", coinbasetest.TooManyRequests(time.Second), coinbasetest.Response{Body: `{}`})
+	s.Script("/time", coinbasetest.Response{Body: `{}`})
+
+	client := NewHTTPClient(1000, 10)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		client.Do("GET", s.URL+"/limited", nil)
+	}()
+	for s.Requests("/limited") == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// wait for pause to be set after rate limited response
+	time.Sleep(50 * time.Millisecond)
+
+	start := time.Now()
+	_, err := client.Do("GET", s.URL+"/time", nil)
+	r.NoError(err)
+	r.True(time.Since(start) >= 900*time.Millisecond, "request is held until Retry-After")
+	wg.Wait()
+	r.Equal(2, s.Requests("/limited"))
+}
+
+func TestSharedHTTPClient(t *testing.T) {
+	r := require.New(t)
+	r.True(SharedHTTPClient("http://shared.test") == SharedHTTPClient("http://shared.test"))
+	r.False(SharedHTTPClient("http://shared.test") == SharedHTTPClient("http://other.test"))
+
+	creds := Credentials{Key: "key", Secret: "c2VjcmV0", Passphrase: "passphrase"}
+	a, err := NewClient("http://shared.test", creds)
+	r.NoError(err)
+	b, err := NewClient("http://shared.test", creds)
+	r.NoError(err)
+	r.True(a.client == b.client, "clients of the same key share private rate limit")
+	r.False(a.client == SharedHTTPClient("http://shared.test"))
+}
@@ -0,0 +1,183 @@
+package coinbase
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/choestelus/super-duper-succotash/pkg/order"
+	"github.com/gorilla/websocket"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+// feedMessage holds fields of websocket feed messages used by this package
+// see https://docs.pro.coinbase.com/#channels
+type feedMessage struct {
+	Type      string          `json:"type"`
+	Message   string          `json:"message"`
+	Reason    string          `json:"reason"`
+	TradeID   int64           `json:"trade_id"`
+	Sequence  order.Sequence  `json:"sequence"`
+	ProductID string          `json:"product_id"`
+	Price     decimal.Decimal `json:"price"`
+	Size      decimal.Decimal `json:"size"`
+	Side      string          `json:"side"`
+	Time      time.Time       `json:"time"`
+}
+
+// subscribeMessage is sent to subscribe to channels after connected
+type subscribeMessage struct {
+	Type       string   `json:"type"`
+	ProductIDs []string `json:"product_ids"`
+	Channels   []string `json:"channels"`
+}
+
+// OpenFeed connects to websocket feed and subscribes to supplied channels of pair
+func OpenFeed(wsURL, pair string, channels ...string) (*websocket.Conn, error) {
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "[coinbase] failed to connect to %v", wsURL)
+	}
+	sub := subscribeMessage{Type: "subscribe", ProductIDs: []string{pair}, Channels: channels}
+	if err := conn.WriteJSON(sub); err != nil {
+		conn.Close()
+		return nil, errors.Wrapf(err, "[coinbase] failed to subscribe to %v", channels)
+	}
+	return conn, nil
+}
+
+// reconnectBackoff is wait before reconnecting to lost websocket feed,
+// doubled after each failed attempt up to maxReconnectBackoff
+var reconnectBackoff = time.Second
+
+const (
+	maxReconnectBackoff = time.Minute
+	// maxReconnects is number of consecutive failed attempts before feed is given up
+	maxReconnects = 10
+)
+
+// feedError is error message sent by websocket feed, e.g. invalid product,
+// which would be sent again after reconnected
+type feedError struct {
+	Message string
+	Reason  string
+}
+
+func (e feedError) Error() string {
+	return fmt.Sprintf("[coinbase] websocket feed error: %v %v", e.Message, e.Reason)
+}
+
+// readFeed reads messages from connection and pass them to handle until connection is closed,
+// returns nil when closed normally, error when error message or unexpected disconnection is found.
+// Malformed message is skipped
+func readFeed(conn *websocket.Conn, handle func(msg feedMessage)) error {
+	defer conn.Close()
+	for {
+		_, raw, err := conn.ReadMessage()
+		if websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "[coinbase] failed to read websocket feed")
+		}
+
+		msg := feedMessage{}
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			logrus.Warnf("[coinbase] skipped malformed websocket message: %v", err)
+			continue
+		}
+		if msg.Type == "error" {
+			return errors.WithStack(feedError{Message: msg.Message, Reason: msg.Reason})
+		}
+		handle(msg)
+	}
+}
+
+// followFeed reads feed of connection, and reconnects with backoff and resubscribes when connection is lost.
+// Returns when feed is closed normally, on error message or when reconnecting gives up
+func followFeed(conn *websocket.Conn, wsURL, pair string, channels []string, handle func(msg feedMessage)) {
+	for conn != nil {
+		err := readFeed(conn, handle)
+		if err == nil {
+			return
+		}
+		if errors.As(err, &feedError{}) {
+			logrus.Errorf("[coinbase] closed %v feed of %v: %v", channels, pair, err)
+			return
+		}
+		logrus.Warnf("[coinbase] reconnecting %v feed of %v: %v", channels, pair, err)
+		conn = reconnect(wsURL, pair, channels)
+	}
+}
+
+// reconnect opens feed again with backoff, returns nil after maxReconnects failed attempts
+func reconnect(wsURL, pair string, channels []string) *websocket.Conn {
+	backoff := reconnectBackoff
+	for attempt := 1; attempt <= maxReconnects; attempt++ {
+		time.Sleep(backoff)
+		conn, err := OpenFeed(wsURL, pair, channels...)
+		if err == nil {
+			return conn
+		}
+		logrus.Warnf("[coinbase] reconnect attempt %v of %v failed: %v", attempt, maxReconnects, err)
+		if backoff *= 2; backoff > maxReconnectBackoff {
+			backoff = maxReconnectBackoff
+		}
+	}
+	logrus.Errorf("[coinbase] gave up reconnecting %v feed of %v", channels, pair)
+	return nil
+}
+
+// toTrade transform match message into trade
+func (msg feedMessage) toTrade() order.Trade {
+	return order.Trade{
+		TradeID: msg.TradeID,
+		Pair:    msg.ProductID,
+		Price:   msg.Price,
+		Size:    msg.Size,
+		Side:    msg.Side,
+		Time:    msg.Time,
+	}
+}
+
+// StreamTrades streams executed trades of pair from matches channel,
+// feed is reconnected when connection is lost, and trades seen before reconnected are skipped.
+// Channel is closed when feed is closed by server, on error message or when reconnecting gives up
+func StreamTrades(wsURL, pair string) (<-chan order.Trade, error) {
+	channels := []string{"matches"}
+	conn, err := OpenFeed(wsURL, pair, channels...)
+	if err != nil {
+		return nil, err
+	}
+	trades := make(chan order.Trade)
+	go func() {
+		defer close(trades)
+		var last int64
+		followFeed(conn, wsURL, pair, channels, func(msg feedMessage) {
+			// last_match is sent once after subscribed
+			if msg.Type != "match" && msg.Type != "last_match" {
+				return
+			}
+			if msg.TradeID <= last {
+				return
+			}
+			last = msg.TradeID
+			trades <- msg.toTrade()
+		})
+	}()
+	return trades, nil
+}
+
+// MustStreamTrades wraps StreamTrades, panic when failed to connect
+func MustStreamTrades(wsURL, pair string) <-chan order.Trade {
+	if wsURL == "" {
+		logrus.Panic(fmt.Errorf("[coinbase] ws_url is required to stream trades"))
+	}
+	trades, err := StreamTrades(wsURL, pair)
+	if err != nil {
+		logrus.Panicf("failed to stream trades: %v", err)
+	}
+	return trades
+}
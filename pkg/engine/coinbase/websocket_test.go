@@ -0,0 +1,114 @@
+package coinbase
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+// feedServer replays supplied messages after subscription and close connection normally
+func feedServer(t *testing.T, expectChannel string, messages ...string) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+
+		sub := subscribeMessage{}
+		if err := conn.ReadJSON(&sub); err != nil {
+			t.Error(err)
+			return
+		}
+		if sub.Type != "subscribe" || len(sub.Channels) != 1 || sub.Channels[0] != expectChannel {
+			t.Errorf("unexpected subscription: %+v", sub)
+		}
+		for _, msg := range messages {
+			conn.WriteMessage(websocket.TextMessage, []byte(msg))
+		}
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		// wait for client to receive close frame
+		conn.ReadMessage()
+	}))
+}
+
+func wsURL(server *httptest.Server) string {
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func TestStreamTrades(t *testing.T) {
+	r := require.New(t)
+	server := feedServer(t, "matches",
+		`{"type":"subscriptions","channels":[{"name":"matches","product_ids":["BTC-USD"]}]}`,
+		`{"type":"last_match","trade_id":9,"sequence":49,"time":"2014-11-07T08:19:26.028459Z","product_id":"BTC-USD","size":"1","price":"400","side":"buy"}`,
+		`{"type":"heartbeat","sequence":50,"product_id":"BTC-USD"}`,
+		`{"type":"match","trade_id":10,"sequence":50,"maker_order_id":"ac928c66-ca53-498f-9c13-a110027a60e8","taker_order_id":"132fb6ae-456b-4654-b4e0-d681ac05cea1","time":"2014-11-07T08:19:27.028459Z","product_id":"BTC-USD","size":"5.23512","price":"400.23","side":"sell"}`,
+	)
+	defer server.Close()
+
+	trades, err := StreamTrades(wsURL(server), "BTC-USD")
+	r.NoError(err)
+
+	received := []int64{}
+	for trade := range trades {
+		received = append(received, trade.TradeID)
+		if trade.TradeID == 10 {
+			r.Equal("BTC-USD", trade.Pair)
+			r.True(decimal.RequireFromString("400.23").Equals(trade.Price))
+			r.True(decimal.RequireFromString("5.23512").Equals(trade.Size))
+			r.Equal("sell", trade.Side)
+			r.Equal(time.Date(2014, 11, 7, 8, 19, 27, 28459000, time.UTC), trade.Time.UTC())
+		}
+	}
+	r.Equal([]int64{9, 10}, received)
+}
+
+func TestStreamTradesReconnects(t *testing.T) {
+	r := require.New(t)
+	defer func(backoff time.Duration) { reconnectBackoff = backoff }(reconnectBackoff)
+	reconnectBackoff = time.Millisecond
+
+	upgrader := websocket.Upgrader{}
+	connections := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		conn, err := upgrader.Upgrade(w, req, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		if err := conn.ReadJSON(&subscribeMessage{}); err != nil {
+			t.Error(err)
+			return
+		}
+		connections++
+		if connections == 1 {
+			// connection is dropped without close frame after first trade
+			conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"last_match","trade_id":1,"product_id":"BTC-USD","size":"1","price":"400","side":"buy"}`))
+			return
+		}
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"last_match","trade_id":1,"product_id":"BTC-USD","size":"1","price":"400","side":"buy"}`))
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"type":`))
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"match","trade_id":2,"product_id":"BTC-USD","size":"1","price":"401","side":"sell"}`))
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		conn.ReadMessage()
+	}))
+	defer server.Close()
+
+	trades, err := StreamTrades(wsURL(server), "BTC-USD")
+	r.NoError(err)
+	received := []int64{}
+	for trade := range trades {
+		received = append(received, trade.TradeID)
+	}
+	r.Equal([]int64{1, 2}, received, "trade sent again after reconnected is skipped")
+	r.Equal(2, connections)
+}
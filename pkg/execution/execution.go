@@ -0,0 +1,155 @@
+package execution
+
+import (
+	"fmt"
+	"time"
+
+	"emperror.dev/errors"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/shopspring/decimal"
+)
+
+var bpsMultiplier = decimal.New(10000, 0)
+
+// exchange sides of order, unlike book sides used by order package
+const (
+	Buy  = "buy"
+	Sell = "sell"
+)
+
+// Request is conversion to be executed as single order.
+// Buy spends Amount of quote asset, sell spends Amount of base asset.
+// Order is limit IOC at LimitPrice when supplied, otherwise market order.
+type Request struct {
+	Pair       string          `json:"pair"`
+	Side       string          `json:"side"`
+	Amount     decimal.Decimal `json:"amount"`
+	LimitPrice decimal.Decimal `json:"limit_price"`
+	// QuotedPrice is average price in quote per base from book matching,
+	// realized price is compared against it
+	QuotedPrice decimal.Decimal `json:"quoted_price"`
+	DryRun      bool            `json:"dry_run"`
+}
+
+// Validate checks that request can be placed
+func (r Request) Validate() error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.Pair, validation.Required),
+		validation.Field(&r.Side, validation.Required, validation.In(Buy, Sell)),
+		validation.Field(&r.Amount, validation.By(positive)),
+		validation.Field(&r.LimitPrice, validation.By(notNegative)),
+		validation.Field(&r.QuotedPrice, validation.By(notNegative)),
+	)
+}
+
+// IsLimit returns whether request is placed as limit IOC order
+func (r Request) IsLimit() bool {
+	return r.LimitPrice.IsPositive()
+}
+
+func positive(value interface{}) error {
+	if d, ok := value.(decimal.Decimal); !ok || !d.IsPositive() {
+		return fmt.Errorf("must be positive")
+	}
+	return nil
+}
+
+func notNegative(value interface{}) error {
+	if d, ok := value.(decimal.Decimal); !ok || d.IsNegative() {
+		return fmt.Errorf("must not be negative")
+	}
+	return nil
+}
+
+// Fill is partial or complete execution of order
+type Fill struct {
+	Price decimal.Decimal `json:"price"`
+	Size  decimal.Decimal `json:"size"`
+	Fee   decimal.Decimal `json:"fee"`
+	Time  time.Time       `json:"time"`
+}
+
+// Result holds order placed for request and its fills
+// Status is final status reported by venue, or "dry-run" when order is not placed
+type Result struct {
+	Request Request `json:"request"`
+	OrderID string  `json:"order_id"`
+	Status  string  `json:"status"`
+	Fills   []Fill  `json:"fills"`
+}
+
+// Filled returns total base size, quote value and fees of fills
+func (r Result) Filled() (decimal.Decimal, decimal.Decimal, decimal.Decimal) {
+	size, value, fees := decimal.Zero, decimal.Zero, decimal.Zero
+	for _, f := range r.Fills {
+		size = size.Add(f.Size)
+		value = value.Add(f.Price.Mul(f.Size))
+		fees = fees.Add(f.Fee)
+	}
+	return size, value, fees
+}
+
+// AveragePrice returns realized average price of fills excluding fees,
+// zero when nothing is filled
+func (r Result) AveragePrice() decimal.Decimal {
+	size, value, _ := r.Filled()
+	if size.IsZero() {
+		return decimal.Zero
+	}
+	return value.Div(size)
+}
+
+// SlippageBps returns distance between realized and quoted price in basis points,
+// positive when realized price is worse than quoted
+func (r Result) SlippageBps() decimal.Decimal {
+	avg := r.AveragePrice()
+	if avg.IsZero() || r.Request.QuotedPrice.IsZero() {
+		return decimal.Zero
+	}
+	diff := avg.Sub(r.Request.QuotedPrice)
+	if r.Request.Side == Sell {
+		diff = diff.Neg()
+	}
+	return diff.Div(r.Request.QuotedPrice).Mul(bpsMultiplier)
+}
+
+// Executor places request as order and returns its fills
+type Executor interface {
+	Execute(req Request) (Result, error)
+}
+
+// ExecutorProvider is implemented by engines that can execute orders
+type ExecutorProvider interface {
+	Executor() (Executor, error)
+}
+
+// DryRunExecutorProvider is implemented by engines that can execute dry run requests
+// without credentials needed to place orders
+type DryRunExecutorProvider interface {
+	DryRunExecutor() Executor
+}
+
+// SideOf returns exchange side to spend input asset on pair of base and quote assets
+func SideOf(inputAsset, base, quote string) (string, error) {
+	switch inputAsset {
+	case base:
+		return Sell, nil
+	case quote:
+		return Buy, nil
+	default:
+		return "", errors.Wrapf(fmt.Errorf("[%v] is not in pair %v-%v", inputAsset, base, quote), "[execution] unknown side")
+	}
+}
+
+// QuotedPrice returns average price in quote per base of matching result,
+// consumed is input amount of side and matched is output amount
+func QuotedPrice(side string, consumed, matched decimal.Decimal) decimal.Decimal {
+	base, quote := consumed, matched
+	if side == Buy {
+		base, quote = matched, consumed
+	}
+	if base.IsZero() {
+		return decimal.Zero
+	}
+	return quote.Div(base)
+}
@@ -0,0 +1,72 @@
+package execution
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+func d(s string) decimal.Decimal {
+	return decimal.RequireFromString(s)
+}
+
+func TestRequestValidate(t *testing.T) {
+	r := require.New(t)
+	valid := Request{Pair: "BTC-USD", Side: Buy, Amount: d("100")}
+	r.NoError(valid.Validate())
+	r.False(valid.IsLimit())
+
+	valid.LimitPrice = d("9000")
+	r.NoError(valid.Validate())
+	r.True(valid.IsLimit())
+
+	for _, req := range []Request{
+		{Pair: "BTC-USD", Side: "bid", Amount: d("1")},
+		{Pair: "BTC-USD", Side: Sell, Amount: decimal.Zero},
+		{Pair: "BTC-USD", Side: Sell, Amount: d("1"), LimitPrice: d("-1")},
+		{Side: Sell, Amount: d("1")},
+	} {
+		r.Error(req.Validate(), "%+v", req)
+	}
+}
+
+func TestResultSlippage(t *testing.T) {
+	r := require.New(t)
+	result := Result{
+		Request: Request{Side: Buy, QuotedPrice: d("100")},
+		Fills: []Fill{
+			{Price: d("100"), Size: d("1"), Fee: d("0.5")},
+			{Price: d("103"), Size: d("1"), Fee: d("0.5")},
+		},
+	}
+	size, value, fees := result.Filled()
+	r.Equal("2", size.String())
+	r.Equal("203", value.String())
+	r.Equal("1", fees.String())
+	r.Equal("101.5", result.AveragePrice().String())
+	r.Equal("150", result.SlippageBps().String())
+
+	// selling at higher price than quoted is favorable
+	result.Request.Side = Sell
+	r.Equal("-150", result.SlippageBps().String())
+
+	r.True(Result{Request: result.Request}.SlippageBps().IsZero())
+}
+
+func TestSideOfAndQuotedPrice(t *testing.T) {
+	r := require.New(t)
+	side, err := SideOf("btc", "btc", "usd")
+	r.NoError(err)
+	r.Equal(Sell, side)
+	r.Equal("8000", QuotedPrice(side, d("2"), d("16000")).String())
+
+	side, err = SideOf("usd", "btc", "usd")
+	r.NoError(err)
+	r.Equal(Buy, side)
+	r.Equal("8000", QuotedPrice(side, d("16000"), d("2")).String())
+
+	_, err = SideOf("eth", "btc", "usd")
+	r.Error(err)
+	r.True(QuotedPrice(Buy, d("1"), decimal.Zero).IsZero())
+}
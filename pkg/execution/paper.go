@@ -0,0 +1,291 @@
+package execution
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"emperror.dev/errors"
+	"github.com/choestelus/super-duper-succotash/pkg/order"
+	"github.com/shopspring/decimal"
+)
+
+// ErrInsufficientBalance is returned by PaperAccount.Execute when balance can not pay for fill
+var ErrInsufficientBalance = errors.NewPlain("insufficient paper balance")
+
+// FeeModel returns fee in quote asset charged for fill
+type FeeModel interface {
+	Fee(fill Fill) decimal.Decimal
+}
+
+// BpsFee charges basis points of filled value
+type BpsFee struct {
+	Bps decimal.Decimal
+}
+
+// Fee returns Bps of price*size of fill
+func (f BpsFee) Fee(fill Fill) decimal.Decimal {
+	return fill.Price.Mul(fill.Size).Mul(f.Bps).Div(bpsMultiplier)
+}
+
+// FixedFee charges fixed amount per fill
+type FixedFee struct {
+	Amount decimal.Decimal
+}
+
+// Fee returns fixed amount regardless of fill
+func (f FixedFee) Fee(fill Fill) decimal.Decimal {
+	return f.Amount
+}
+
+// CombinedFee charges sum of fees of every model
+type CombinedFee []FeeModel
+
+// Fee returns sum of fees of every model
+func (fs CombinedFee) Fee(fill Fill) decimal.Decimal {
+	total := decimal.Zero
+	for _, f := range fs {
+		total = total.Add(f.Fee(fill))
+	}
+	return total
+}
+
+// ParseFeeModel parses fee model from spec, which is either "zero",
+// "bps:<n>" of filled value, "fixed:<n>" per fill, or their combination
+// joined by "+", e.g. bps:10+fixed:0.5
+func ParseFeeModel(spec string) (FeeModel, error) {
+	models := CombinedFee{}
+	for _, part := range strings.Split(spec, "+") {
+		part = strings.TrimSpace(part)
+		if part == "zero" {
+			continue
+		}
+		kv := strings.SplitN(part, ":", 2)
+		if len(kv) != 2 {
+			return nil, errors.Wrapf(fmt.Errorf("need [zero|bps:<n>|fixed:<n>], got [%v]", part), "[execution] malformed fee model")
+		}
+		value, err := decimal.NewFromString(kv[1])
+		if err != nil || value.IsNegative() {
+			return nil, errors.Wrapf(fmt.Errorf("need non-negative number, got [%v]", kv[1]), "[execution] malformed fee model")
+		}
+		switch kv[0] {
+		case "bps":
+			models = append(models, BpsFee{Bps: value})
+		case "fixed":
+			models = append(models, FixedFee{Amount: value})
+		default:
+			return nil, errors.Wrapf(fmt.Errorf("unknown fee model [%v]", kv[0]), "[execution] malformed fee model")
+		}
+	}
+	return models, nil
+}
+
+// ParseBalances parses comma-separated asset:amount pairs, e.g. usd:10000,btc:1
+func ParseBalances(spec string) (map[string]decimal.Decimal, error) {
+	balances := map[string]decimal.Decimal{}
+	if strings.TrimSpace(spec) == "" {
+		return balances, nil
+	}
+	for _, part := range strings.Split(spec, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), ":", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, errors.Wrapf(fmt.Errorf("need asset:amount, got [%v]", part), "[execution] malformed balances")
+		}
+		amount, err := decimal.NewFromString(kv[1])
+		if err != nil || amount.IsNegative() {
+			return nil, errors.Wrapf(fmt.Errorf("need non-negative amount, got [%v]", kv[1]), "[execution] malformed balances")
+		}
+		balances[strings.ToLower(kv[0])] = amount
+	}
+	return balances, nil
+}
+
+// paperState is persisted state of paper account
+type paperState struct {
+	Balances map[string]decimal.Decimal `json:"balances"`
+	Orders   []Result                   `json:"orders"`
+}
+
+// PaperAccount simulates execution by matching requests against the latest
+// observed book of pair, with the same matching functions as quoting.
+// Fees are charged in quote asset, state is saved to Path after every execution
+// when Path is not empty.
+type PaperAccount struct {
+	Path string
+	Fee  FeeModel
+
+	mu    sync.Mutex
+	state paperState
+	books map[string]order.Book
+}
+
+// NewPaperAccount returns account with supplied initial balances, balances are keyed by lowercase asset
+func NewPaperAccount(balances map[string]decimal.Decimal, fee FeeModel) *PaperAccount {
+	a := &PaperAccount{
+		Fee:   fee,
+		state: paperState{Balances: map[string]decimal.Decimal{}, Orders: []Result{}},
+		books: map[string]order.Book{},
+	}
+	for asset, amount := range balances {
+		a.state.Balances[strings.ToLower(asset)] = amount
+	}
+	return a
+}
+
+// OpenPaperAccount loads account persisted at path, or creates one
+// with supplied initial balances when file does not exist
+func OpenPaperAccount(path string, balances map[string]decimal.Decimal, fee FeeModel) (*PaperAccount, error) {
+	a := NewPaperAccount(balances, fee)
+	a.Path = path
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return a, a.save()
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "[execution] failed to read paper account")
+	}
+	if err := json.Unmarshal(raw, &a.state); err != nil {
+		return nil, errors.Wrapf(err, "[execution] malformed paper account %v", path)
+	}
+	if a.state.Balances == nil {
+		a.state.Balances = map[string]decimal.Decimal{}
+	}
+	return a, nil
+}
+
+// Observe sets the latest book of pair, which subsequent requests are matched against
+func (a *PaperAccount) Observe(pair string, book order.Book) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.books[strings.ToUpper(pair)] = book
+}
+
+// Balances returns copy of balances keyed by lowercase asset
+func (a *PaperAccount) Balances() map[string]decimal.Decimal {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	balances := map[string]decimal.Decimal{}
+	for asset, amount := range a.state.Balances {
+		balances[asset] = amount
+	}
+	return balances
+}
+
+// Orders returns executed orders, oldest first
+func (a *PaperAccount) Orders() []Result {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]Result{}, a.state.Orders...)
+}
+
+// Execute matches request against the latest observed book as market or limit IOC order
+// would, in single fill at average price. Part of amount that cannot be matched is canceled.
+// Balances are not changed when request is dry run.
+func (a *PaperAccount) Execute(req Request) (Result, error) {
+	result := Result{Request: req}
+	if err := req.Validate(); err != nil {
+		return result, errors.Wrap(err, "[execution] malformed execution request")
+	}
+	base, quote, err := splitPair(req.Pair)
+	if err != nil {
+		return result, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	book, ok := a.books[strings.ToUpper(req.Pair)]
+	if !ok {
+		return result, errors.Wrapf(fmt.Errorf("no book of %v is observed", req.Pair), "[execution] failed to execute paper order")
+	}
+
+	// buying spends quote against asks, selling spends base against bids,
+	// as "bid" and "ask" input of MatchUntilSatisfied
+	bookSide, ods, spend, receive := "bid", book.Asks, quote, base
+	if req.Side == Sell {
+		bookSide, ods, spend, receive = "ask", book.Bids, base, quote
+	}
+	if req.IsLimit() {
+		ods = order.WithinLimit(bookSide, ods, req.LimitPrice)
+	}
+	consumed, matched := order.MatchUntilSatisfied(bookSide, ods, req.Amount)
+
+	result.OrderID = fmt.Sprintf("paper-%d", len(a.state.Orders)+1)
+	result.Status = "filled"
+	if consumed.LessThan(req.Amount) {
+		result.Status = "canceled"
+	}
+	if req.DryRun {
+		result.Status = "dry-run"
+		return result, nil
+	}
+
+	if !matched.IsZero() {
+		fill := Fill{Price: QuotedPrice(req.Side, consumed, matched), Size: matched, Time: book.UpdatedAt}
+		if req.Side == Sell {
+			fill.Size = consumed
+		}
+		fill.Fee = a.Fee.Fee(fill)
+
+		// fee is charged in quote asset
+		spent, received := consumed, matched
+		if req.Side == Buy {
+			spent = spent.Add(fill.Fee)
+		} else {
+			received = received.Sub(fill.Fee)
+		}
+		if available := a.state.Balances[spend]; available.LessThan(spent) {
+			return result, errors.Wrapf(ErrInsufficientBalance, "[execution] need %v %v, available %v", spent, spend, available)
+		}
+		a.state.Balances[spend] = a.state.Balances[spend].Sub(spent)
+		a.state.Balances[receive] = a.state.Balances[receive].Add(received)
+		result.Fills = []Fill{fill}
+	}
+
+	a.state.Orders = append(a.state.Orders, result)
+	return result, a.save()
+}
+
+// Executor returns account itself, so paper account can be used
+// in place of exchange engine
+func (a *PaperAccount) Executor() (Executor, error) {
+	return a, nil
+}
+
+// save writes state into Path atomically, nothing is written when Path is empty
+func (a *PaperAccount) save() error {
+	if a.Path == "" {
+		return nil
+	}
+	raw, err := json.MarshalIndent(a.state, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "[execution] failed to encode paper account")
+	}
+	tmp := a.Path + ".tmp"
+	if err := ioutil.WriteFile(tmp, raw, 0600); err != nil {
+		return errors.Wrap(err, "[execution] failed to save paper account")
+	}
+	return errors.Wrap(os.Rename(tmp, a.Path), "[execution] failed to save paper account")
+}
+
+// splitPair returns lowercase base and quote asset of pair, e.g. BTC-USD
+func splitPair(pair string) (string, string, error) {
+	assets := strings.Split(strings.ToLower(pair), "-")
+	if len(assets) != 2 {
+		return "", "", errors.Wrapf(fmt.Errorf("need <base>-<quote>, got [%v]", pair), "[execution] malformed pair")
+	}
+	return assets[0], assets[1], nil
+}
+
+// SortedAssets returns assets of balances in alphabetical order
+func SortedAssets(balances map[string]decimal.Decimal) []string {
+	assets := make([]string, 0, len(balances))
+	for asset := range balances {
+		assets = append(assets, asset)
+	}
+	sort.Strings(assets)
+	return assets
+}
@@ -0,0 +1,122 @@
+package execution
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/choestelus/super-duper-succotash/pkg/order"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+var paperBook = order.Book{
+	Sequence: 1,
+	Bids: []order.Order{
+		{Price: d("99"), Size: d("1")},
+		{Price: d("98"), Size: d("2")},
+	},
+	Asks: []order.Order{
+		{Price: d("101"), Size: d("1")},
+		{Price: d("102"), Size: d("2")},
+	},
+	UpdatedAt: time.Date(2019, 10, 17, 0, 0, 0, 0, time.UTC),
+}
+
+func TestParseFeeModel(t *testing.T) {
+	r := require.New(t)
+	fill := Fill{Price: d("100"), Size: d("2")}
+
+	for spec, fee := range map[string]string{
+		"zero":              "0",
+		"bps:50":            "1",
+		"fixed:0.25":        "0.25",
+		"bps:50+fixed:0.25": "1.25",
+	} {
+		model, err := ParseFeeModel(spec)
+		r.NoError(err, spec)
+		r.Equal(fee, model.Fee(fill).String(), spec)
+	}
+	for _, spec := range []string{"", "bps", "bps:-1", "percent:1"} {
+		_, err := ParseFeeModel(spec)
+		r.Error(err, spec)
+	}
+}
+
+func TestParseBalances(t *testing.T) {
+	r := require.New(t)
+	balances, err := ParseBalances("USD:1000, btc:1.5")
+	r.NoError(err)
+	r.Equal("1000", balances["usd"].String())
+	r.Equal("1.5", balances["btc"].String())
+
+	_, err = ParseBalances("usd")
+	r.Error(err)
+}
+
+func TestPaperAccountExecute(t *testing.T) {
+	r := require.New(t)
+	account := NewPaperAccount(map[string]decimal.Decimal{"usd": d("1000")}, BpsFee{Bps: d("100")})
+
+	_, err := account.Execute(Request{Pair: "BTC-USD", Side: Buy, Amount: d("101")})
+	r.Error(err, "book is not observed yet")
+
+	account.Observe("BTC-USD", paperBook)
+	result, err := account.Execute(Request{Pair: "BTC-USD", Side: Buy, Amount: d("203"), QuotedPrice: d("101.5")})
+	r.NoError(err)
+	r.Equal("filled", result.Status)
+	r.Len(result.Fills, 1)
+	r.Equal("2", result.Fills[0].Size.String())
+	r.Equal("101.5", result.AveragePrice().String())
+	r.Equal("2.03", result.Fills[0].Fee.String())
+	r.True(result.SlippageBps().IsZero())
+
+	balances := account.Balances()
+	r.Equal("794.97", balances["usd"].String())
+	r.Equal("2", balances["btc"].String())
+
+	// only the best bid is within limit, rest is canceled
+	result, err = account.Execute(Request{Pair: "BTC-USD", Side: Sell, Amount: d("2"), LimitPrice: d("99")})
+	r.NoError(err)
+	r.Equal("canceled", result.Status)
+	r.Equal("1", result.Fills[0].Size.String())
+	balances = account.Balances()
+	r.Equal("1", balances["btc"].String())
+	r.Equal("892.98", balances["usd"].String())
+
+	// dry run does not change balances
+	result, err = account.Execute(Request{Pair: "BTC-USD", Side: Sell, Amount: d("1"), DryRun: true})
+	r.NoError(err)
+	r.Equal("dry-run", result.Status)
+	r.Equal(balances, account.Balances())
+
+	_, err = account.Execute(Request{Pair: "BTC-USD", Side: Sell, Amount: d("3")})
+	r.True(errors.Is(err, ErrInsufficientBalance), "%v", err)
+	r.Equal(balances, account.Balances())
+	r.Len(account.Orders(), 2)
+}
+
+func TestPaperAccountPersisted(t *testing.T) {
+	r := require.New(t)
+	dir, err := ioutil.TempDir("", "succotash")
+	r.NoError(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "paper.json")
+
+	account, err := OpenPaperAccount(path, map[string]decimal.Decimal{"btc": d("1")}, CombinedFee{})
+	r.NoError(err)
+	account.Observe("BTC-USD", paperBook)
+	_, err = account.Execute(Request{Pair: "BTC-USD", Side: Sell, Amount: d("1")})
+	r.NoError(err)
+
+	// initial balances are ignored once state exists
+	reopened, err := OpenPaperAccount(path, map[string]decimal.Decimal{"btc": d("100")}, CombinedFee{})
+	r.NoError(err)
+	r.Equal("0", reopened.Balances()["btc"].String())
+	r.Equal("99", reopened.Balances()["usd"].String())
+	r.Len(reopened.Orders(), 1)
+	r.Equal("paper-1", reopened.Orders()[0].OrderID)
+}
@@ -0,0 +1,335 @@
+package execution
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/choestelus/super-duper-succotash/pkg/candle"
+	"github.com/choestelus/super-duper-succotash/pkg/order"
+	"github.com/shopspring/decimal"
+)
+
+// Slice is child order amount due at time
+type Slice struct {
+	At     time.Time       `json:"at"`
+	Amount decimal.Decimal `json:"amount"`
+}
+
+// TWAP slices total into count equal slices evenly spaced over window
+func TWAP(total decimal.Decimal, start time.Time, window time.Duration, count int) []Slice {
+	weights := make([]decimal.Decimal, count)
+	for i := range weights {
+		weights[i] = decimal.New(1, 0)
+	}
+	return weighted(total, start, window, weights)
+}
+
+// VWAP slices total into count slices evenly spaced over window, weighted by
+// volume of profile at time of day of each slice. Falls back to TWAP when profile
+// has no volume within window.
+func VWAP(total decimal.Decimal, start time.Time, window time.Duration, count int, profile map[time.Duration]decimal.Decimal) []Slice {
+	step := window / time.Duration(count)
+	weights := make([]decimal.Decimal, count)
+	sum := decimal.Zero
+	for i := range weights {
+		weights[i] = profile[timeOfDay(start.Add(step*time.Duration(i)), step)]
+		sum = sum.Add(weights[i])
+	}
+	if sum.IsZero() {
+		return TWAP(total, start, window, count)
+	}
+	return weighted(total, start, window, weights)
+}
+
+// weighted slices total proportionally to weights, the last slice takes
+// rounding remainder so slices sum up to total exactly
+func weighted(total decimal.Decimal, start time.Time, window time.Duration, weights []decimal.Decimal) []Slice {
+	if len(weights) == 0 {
+		return nil
+	}
+	step := window / time.Duration(len(weights))
+	sum := decimal.Zero
+	for _, w := range weights {
+		sum = sum.Add(w)
+	}
+	slices := make([]Slice, len(weights))
+	allocated := decimal.Zero
+	for i, w := range weights {
+		amount := total.Sub(allocated)
+		if i < len(weights)-1 {
+			amount = total.Mul(w).Div(sum).Truncate(8)
+		}
+		allocated = allocated.Add(amount)
+		slices[i] = Slice{At: start.Add(step * time.Duration(i)), Amount: amount}
+	}
+	return slices
+}
+
+// VolumeProfile returns total volume of candles by time of day in UTC, truncated to step,
+// which is used as relative weight of VWAP slices
+func VolumeProfile(candles []candle.Candle, step time.Duration) map[time.Duration]decimal.Decimal {
+	profile := map[time.Duration]decimal.Decimal{}
+	for _, c := range candles {
+		key := timeOfDay(c.Start, step)
+		profile[key] = profile[key].Add(c.Volume)
+	}
+	return profile
+}
+
+func timeOfDay(t time.Time, step time.Duration) time.Duration {
+	t = t.UTC()
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return t.Sub(midnight).Truncate(step)
+}
+
+// BookObserver is implemented by executors matching against observed books,
+// e.g. paper account
+type BookObserver interface {
+	Observe(pair string, book order.Book)
+}
+
+// Progress holds state of scheduled execution after each step.
+// Spent is input asset spent including fees of buying, Received is output asset received
+// after fees of selling, AvgPrice is average price of every fill excluding fees.
+type Progress struct {
+	At        time.Time       `json:"at"`
+	Slice     int             `json:"slice"`
+	Slices    int             `json:"slices"`
+	Target    decimal.Decimal `json:"target"`
+	Spent     decimal.Decimal `json:"spent"`
+	Received  decimal.Decimal `json:"received"`
+	AvgPrice  decimal.Decimal `json:"avg_price"`
+	LastChild *Result         `json:"last_child,omitempty"`
+	Remaining decimal.Decimal `json:"remaining"`
+	Paused    bool            `json:"paused"`
+	Done      bool            `json:"done"`
+}
+
+// Scheduler executes parent amount as child orders according to slices.
+// Amount of slices that are due while paused, capped by participation rate,
+// or not filled is carried over to the next child order. Child order failed
+// with temporary error is placed again on the next step.
+type Scheduler struct {
+	Pair       string
+	Side       string
+	LimitPrice decimal.Decimal
+	DryRun     bool
+	Slices     []Slice
+	// ParticipationRate caps child amount to this fraction of market volume in input asset
+	// traded since previous child order, zero disables the cap
+	ParticipationRate decimal.Decimal
+
+	Executor Executor
+	// Book returns current order book of pair, each child is quoted against it
+	Book func() (order.Book, error)
+	// OnRetry is called by Run with temporary error of child order before it is retried
+	OnRetry func(error)
+
+	mu       sync.Mutex
+	next     int
+	carry    decimal.Decimal
+	pending  bool
+	paused   bool
+	volume   decimal.Decimal
+	progress Progress
+	size     decimal.Decimal
+	value    decimal.Decimal
+}
+
+// Pause stops placing child orders until resumed, due slices are carried over
+func (s *Scheduler) Pause() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = true
+}
+
+// Resume continues placing child orders, carried amount is placed on next step
+func (s *Scheduler) Resume() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = false
+}
+
+// AddTrade adds market trade of pair to volume used by participation cap
+func (s *Scheduler) AddTrade(trade order.Trade) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Side == Buy {
+		s.volume = s.volume.Add(trade.Volume())
+		return
+	}
+	s.volume = s.volume.Add(trade.Size)
+}
+
+// NextAt returns time of next slice, zero when every slice is due
+func (s *Scheduler) NextAt() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.next >= len(s.Slices) {
+		return time.Time{}
+	}
+	return s.Slices[s.next].At
+}
+
+// Step places single child order for every slice due at now, and returns progress
+func (s *Scheduler) Step(now time.Time) (Progress, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.progress.Slices == 0 {
+		s.progress.Slices = len(s.Slices)
+		for _, slice := range s.Slices {
+			s.progress.Target = s.progress.Target.Add(slice.Amount)
+		}
+	}
+
+	for s.next < len(s.Slices) && !s.Slices[s.next].At.After(now) {
+		s.carry = s.carry.Add(s.Slices[s.next].Amount)
+		s.next++
+		s.pending = true
+	}
+	s.progress.At = now
+	s.progress.Slice = s.next
+	s.progress.Paused = s.paused
+	s.progress.LastChild = nil
+
+	if s.pending && !s.paused {
+		amount := s.carry
+		if s.ParticipationRate.IsPositive() {
+			limit := s.volume.Mul(s.ParticipationRate)
+			if amount.GreaterThan(limit) {
+				amount = limit
+			}
+		}
+		if amount.IsPositive() {
+			if err := s.placeChild(amount); err != nil {
+				// amount is still in carry, temporary failure is placed again with the same volume
+				s.pending = temporary(err)
+				s.progress.Remaining = s.progress.Target.Sub(s.progress.Spent)
+				return s.progress, err
+			}
+		}
+		s.pending = false
+		s.volume = decimal.Zero
+	}
+
+	s.progress.Remaining = s.progress.Target.Sub(s.progress.Spent)
+	s.progress.Done = s.next >= len(s.Slices) && !s.pending && !s.paused
+	return s.progress, nil
+}
+
+// Progress returns progress of the latest step
+func (s *Scheduler) Progress() Progress {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.progress
+}
+
+// temporary reports whether child order may succeed when placed again,
+// i.e. error implementing Temporary() bool such as rate limit or server error of exchange,
+// or error of connection itself
+func temporary(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var temp interface{ Temporary() bool }
+	return errors.As(err, &temp) && temp.Temporary()
+}
+
+// placeChild quotes amount against current book and executes it
+func (s *Scheduler) placeChild(amount decimal.Decimal) error {
+	book, err := s.Book()
+	if err != nil {
+		return errors.Wrap(err, "[execution] failed to get book of child order")
+	}
+	if observer, ok := s.Executor.(BookObserver); ok {
+		observer.Observe(s.Pair, book)
+	}
+
+	bookSide, ods := "bid", book.Asks
+	if s.Side == Sell {
+		bookSide, ods = "ask", book.Bids
+	}
+	if s.LimitPrice.IsPositive() {
+		ods = order.WithinLimit(bookSide, ods, s.LimitPrice)
+	}
+	consumed, matched := order.MatchUntilSatisfied(bookSide, ods, amount)
+
+	result, err := s.Executor.Execute(Request{
+		Pair:        s.Pair,
+		Side:        s.Side,
+		Amount:      amount,
+		LimitPrice:  s.LimitPrice,
+		QuotedPrice: QuotedPrice(s.Side, consumed, matched),
+		DryRun:      s.DryRun,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "[execution] failed to execute child order of slice %v", s.next)
+	}
+
+	size, value, fees := result.Filled()
+	if s.DryRun {
+		// nothing is filled on dry run, progress follows quote instead
+		size, value, fees = matched, consumed, decimal.Zero
+		if s.Side == Sell {
+			size, value = consumed, matched
+		}
+	}
+	spent, received := value.Add(fees), size
+	if s.Side == Sell {
+		spent, received = size, value.Sub(fees)
+	}
+	s.carry = s.carry.Sub(spent)
+	if s.carry.IsNegative() {
+		s.carry = decimal.Zero
+	}
+
+	s.size = s.size.Add(size)
+	s.value = s.value.Add(value)
+	s.progress.Spent = s.progress.Spent.Add(spent)
+	s.progress.Received = s.progress.Received.Add(received)
+	if !s.size.IsZero() {
+		s.progress.AvgPrice = s.value.Div(s.size)
+	}
+	s.progress.LastChild = &result
+	return nil
+}
+
+// Run steps scheduler at every slice until every slice is placed or stop is closed,
+// progress is passed to report after each child order and when done.
+// Child order failed with temporary error is retried on next wake up, other errors are returned
+func (s *Scheduler) Run(stop <-chan struct{}, report func(Progress)) error {
+	if len(s.Slices) == 0 {
+		return errors.Wrap(fmt.Errorf("no slice to execute"), "[execution] malformed schedule")
+	}
+	for {
+		progress, err := s.Step(time.Now())
+		switch {
+		case err != nil && temporary(err):
+			if s.OnRetry != nil {
+				s.OnRetry(err)
+			}
+		case err != nil:
+			return err
+		case progress.LastChild != nil || progress.Done:
+			report(progress)
+		}
+		if err == nil && progress.Done {
+			return nil
+		}
+
+		// wake up periodically so resume is picked up without waiting for next slice
+		wait := time.Second
+		if next := s.NextAt(); !next.IsZero() && time.Until(next) < wait {
+			wait = time.Until(next)
+		}
+		select {
+		case <-stop:
+			return nil
+		case <-time.After(wait):
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package execution
+
+import (
+	"testing"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/choestelus/super-duper-succotash/pkg/candle"
+	"github.com/choestelus/super-duper-succotash/pkg/order"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+var scheduleStart = time.Date(2019, 10, 17, 10, 0, 0, 0, time.UTC)
+
+func TestTWAP(t *testing.T) {
+	r := require.New(t)
+	slices := TWAP(d("10"), scheduleStart, time.Hour, 3)
+	r.Len(slices, 3)
+	sum := decimal.Zero
+	for i, s := range slices {
+		r.Equal(scheduleStart.Add(time.Duration(i)*20*time.Minute), s.At)
+		sum = sum.Add(s.Amount)
+	}
+	r.Equal("3.33333333", slices[0].Amount.String())
+	r.Equal("3.33333334", slices[2].Amount.String())
+	r.Equal("10", sum.String())
+}
+
+func TestVWAP(t *testing.T) {
+	r := require.New(t)
+	// two days of history, 10:30 is three times busier than 10:00
+	candles := []candle.Candle{}
+	for _, day := range []int{15, 16} {
+		candles = append(candles,
+			candle.Candle{Start: time.Date(2019, 10, day, 10, 0, 0, 0, time.UTC), Volume: d("1")},
+			candle.Candle{Start: time.Date(2019, 10, day, 10, 15, 0, 0, time.UTC), Volume: d("1")},
+			candle.Candle{Start: time.Date(2019, 10, day, 10, 30, 0, 0, time.UTC), Volume: d("6")},
+		)
+	}
+	profile := VolumeProfile(candles, 30*time.Minute)
+	r.Equal("4", profile[10*time.Hour].String())
+	r.Equal("12", profile[10*time.Hour+30*time.Minute].String())
+
+	slices := VWAP(d("100"), scheduleStart, time.Hour, 2, profile)
+	r.Equal("25", slices[0].Amount.String())
+	r.Equal("75", slices[1].Amount.String())
+
+	// no history within window falls back to TWAP
+	slices = VWAP(d("100"), scheduleStart.Add(time.Hour), time.Hour, 2, profile)
+	r.Equal("50", slices[0].Amount.String())
+}
+
+func newTestScheduler(slices []Slice) (*Scheduler, *PaperAccount) {
+	account := NewPaperAccount(map[string]decimal.Decimal{"btc": d("10")}, CombinedFee{})
+	return &Scheduler{
+		Pair:     "BTC-USD",
+		Side:     Sell,
+		Slices:   slices,
+		Executor: account,
+		Book:     func() (order.Book, error) { return paperBook, nil },
+	}, account
+}
+
+func TestSchedulerStep(t *testing.T) {
+	r := require.New(t)
+	s, account := newTestScheduler(TWAP(d("2"), scheduleStart, time.Hour, 2))
+
+	progress, err := s.Step(scheduleStart.Add(-time.Minute))
+	r.NoError(err)
+	r.Nil(progress.LastChild, "nothing is due yet")
+
+	progress, err = s.Step(scheduleStart)
+	r.NoError(err)
+	r.NotNil(progress.LastChild)
+	r.Equal("1", progress.Spent.String())
+	r.Equal("99", progress.Received.String())
+	r.False(progress.Done)
+
+	// second slice is carried over while paused
+	s.Pause()
+	progress, err = s.Step(scheduleStart.Add(time.Hour))
+	r.NoError(err)
+	r.Nil(progress.LastChild)
+	r.True(progress.Paused)
+	r.False(progress.Done)
+
+	s.Resume()
+	progress, err = s.Step(scheduleStart.Add(time.Hour + time.Minute))
+	r.NoError(err)
+	r.NotNil(progress.LastChild)
+	r.True(progress.Done)
+	r.Equal("2", progress.Spent.String())
+	r.Equal("198", progress.Received.String())
+	r.Equal("99", progress.AvgPrice.String())
+	r.True(progress.Remaining.IsZero())
+	r.Len(account.Orders(), 2)
+}
+
+func TestSchedulerParticipationCap(t *testing.T) {
+	r := require.New(t)
+	s, _ := newTestScheduler(TWAP(d("2"), scheduleStart, time.Hour, 2))
+	s.ParticipationRate = d("0.1")
+
+	// 10% of 5 traded is 0.5
+	s.AddTrade(order.Trade{Price: d("99"), Size: d("5")})
+	progress, err := s.Step(scheduleStart)
+	r.NoError(err)
+	r.Equal("0.5", progress.Spent.String())
+
+	// the rest is carried to last slice, capped again at 10% of 20 traded
+	s.AddTrade(order.Trade{Price: d("99"), Size: d("20")})
+	progress, err = s.Step(scheduleStart.Add(time.Hour))
+	r.NoError(err)
+	r.Equal("1.5", progress.LastChild.Request.Amount.String())
+	r.True(progress.Done)
+	r.True(progress.Remaining.IsZero())
+
+	// without traded volume nothing is placed
+	s, _ = newTestScheduler(TWAP(d("1"), scheduleStart, time.Hour, 1))
+	s.ParticipationRate = d("0.1")
+	progress, err = s.Step(scheduleStart)
+	r.NoError(err)
+	r.Nil(progress.LastChild)
+	r.Equal("1", progress.Remaining.String())
+}
+
+func TestSchedulerDryRun(t *testing.T) {
+	r := require.New(t)
+	s, account := newTestScheduler(TWAP(d("1"), scheduleStart, time.Hour, 1))
+	s.DryRun = true
+
+	progress, err := s.Step(scheduleStart)
+	r.NoError(err)
+	r.True(progress.Done)
+	r.Equal("1", progress.Spent.String())
+	r.Equal("99", progress.AvgPrice.String())
+	r.Equal("10", account.Balances()["btc"].String())
+}
+
+// temporaryError fails the same way as rate limited request
+type temporaryError struct{}
+
+func (temporaryError) Error() string   { return "rate limited" }
+func (temporaryError) Temporary() bool { return true }
+
+func TestSchedulerRetriesTemporaryError(t *testing.T) {
+	r := require.New(t)
+	s, account := newTestScheduler(TWAP(d("2"), scheduleStart, time.Hour, 2))
+	failures := 1
+	s.Book = func() (order.Book, error) {
+		if failures > 0 {
+			failures--
+			return order.Book{}, errors.WithStack(temporaryError{})
+		}
+		return paperBook, nil
+	}
+
+	progress, err := s.Step(scheduleStart)
+	r.Error(err)
+	r.True(temporary(err))
+	r.Nil(progress.LastChild)
+	r.Equal("2", progress.Remaining.String())
+
+	// failed slice is placed again on next tick, before the next slice is due
+	progress, err = s.Step(scheduleStart.Add(time.Second))
+	r.NoError(err)
+	r.NotNil(progress.LastChild)
+	r.Equal("1", progress.Spent.String())
+	r.Len(account.Orders(), 1)
+
+	retried := []error{}
+	s.OnRetry = func(err error) { retried = append(retried, err) }
+	failures = 1
+	s.Slices = TWAP(d("2"), time.Now().Add(-time.Hour), time.Hour, 2)
+	r.NoError(s.Run(make(chan struct{}), func(Progress) {}))
+	r.Len(retried, 1)
+	r.Equal("2", s.Progress().Spent.String())
+}
+
+func TestSchedulerAbortsOnError(t *testing.T) {
+	r := require.New(t)
+	s, _ := newTestScheduler(TWAP(d("2"), time.Now().Add(-100*time.Millisecond), 400*time.Millisecond, 2))
+	s.Executor = NewPaperAccount(map[string]decimal.Decimal{"btc": d("1.5")}, CombinedFee{})
+	s.OnRetry = func(err error) { r.Failf("unexpected retry", "%v", err) }
+
+	// first slice fills, second is rejected for balance and is not retried
+	err := s.Run(make(chan struct{}), func(Progress) {})
+	r.True(errors.Is(err, ErrInsufficientBalance))
+	progress := s.Progress()
+	r.Equal("1", progress.Spent.String())
+	r.Equal("1", progress.Remaining.String())
+}
@@ -0,0 +1,113 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+)
+
+// Email sends events through SMTP server at Addr, subject of event is mail subject
+// and payload is mail body as indented JSON
+type Email struct {
+	Addr string
+	From string
+	To   []string
+	Auth smtp.Auth
+	// Timeout bounds dialing and the whole SMTP session of each mail, zero means no timeout
+	Timeout time.Duration
+
+	send func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// NewEmail returns email notifier with timeout, PLAIN auth is used when username is supplied
+func NewEmail(addr, username, password, from string, to []string, timeout time.Duration) *Email {
+	email := &Email{Addr: addr, From: from, To: to, Timeout: timeout}
+	email.send = email.sendMail
+	if username != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		email.Auth = smtp.PlainAuth("", username, password, host)
+	}
+	return email
+}
+
+// Notify sends event as mail to every recipient
+func (e *Email) Notify(event Event) error {
+	body, err := json.MarshalIndent(event.Payload, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "[notify] failed to encode event payload")
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %v\r\n", e.From)
+	fmt.Fprintf(&msg, "To: %v\r\n", strings.Join(e.To, ", "))
+	fmt.Fprintf(&msg, "Subject: [%v] %v\r\n", event.Kind, event.Subject)
+	fmt.Fprintf(&msg, "Date: %v\r\n", event.Time.Format("Mon, 02 Jan 2006 15:04:05 -0700"))
+	fmt.Fprintf(&msg, "Content-Type: application/json; charset=utf-8\r\n\r\n")
+	msg.Write(body)
+	msg.WriteString("\r\n")
+
+	if err := e.send(e.Addr, e.Auth, e.From, e.To, msg.Bytes()); err != nil {
+		return errors.Wrapf(err, "[notify] failed to send mail through %v", e.Addr)
+	}
+	return nil
+}
+
+// sendMail works as smtp.SendMail, with Timeout applied to dialing and the whole session
+// since smtp.SendMail may block forever on unresponsive server
+func (e *Email) sendMail(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+	conn, err := net.DialTimeout("tcp", addr, e.Timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if e.Timeout > 0 {
+		if err := conn.SetDeadline(time.Now().Add(e.Timeout)); err != nil {
+			return err
+		}
+	}
+
+	host, _, _ := net.SplitHostPort(addr)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if a != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return fmt.Errorf("server does not support AUTH")
+		}
+		if err := c.Auth(a); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,96 @@
+package notify
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmail(t *testing.T) {
+	r := require.New(t)
+	email := NewEmail("smtp.example.com:587", "bot", "secret", "bot@example.com", []string{"a@example.com", "b@example.com"}, time.Second)
+	r.NotNil(email.Auth)
+
+	var sent string
+	email.send = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		r.Equal("smtp.example.com:587", addr)
+		r.Equal("bot@example.com", from)
+		r.Len(to, 2)
+		sent = string(msg)
+		return nil
+	}
+	at := time.Date(2019, 10, 17, 0, 0, 0, 0, time.UTC)
+	r.NoError(email.Notify(Event{Kind: "alert", Subject: "wide spread", Payload: map[string]string{"value": "25"}, Time: at}))
+	r.Contains(sent, "To: a@example.com, b@example.com\r\n")
+	r.Contains(sent, "Subject: [alert] wide spread\r\n")
+	r.Contains(sent, "Date: Thu, 17 Oct 2019 00:00:00 +0000\r\n")
+	r.Contains(sent, "\r\n\r\n{\n  \"value\": \"25\"\n}\r\n")
+
+	email.send = func(string, smtp.Auth, string, []string, []byte) error {
+		return fmt.Errorf("connection refused")
+	}
+	r.Error(email.Notify(Event{Kind: "alert"}))
+
+	r.Nil(NewEmail("localhost:25", "", "", "bot@example.com", nil, time.Second).Auth)
+}
+
+// smtpServer accepts single SMTP session, responds to every command
+// when respond is set and returns received mail data, otherwise never responds
+func smtpServer(t *testing.T, respond bool) (string, <-chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	data := make(chan string, 1)
+	go func() {
+		defer listener.Close()
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if !respond {
+			time.Sleep(time.Second)
+			return
+		}
+		tp := textproto.NewConn(conn)
+		tp.PrintfLine("220 localhost ESMTP")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); cmd {
+			case "DATA":
+				tp.PrintfLine("354 go ahead")
+				lines, _ := tp.ReadDotLines()
+				data <- strings.Join(lines, "\n")
+				tp.PrintfLine("250 queued")
+			case "QUIT":
+				tp.PrintfLine("221 bye")
+				return
+			default:
+				tp.PrintfLine("250 ok")
+			}
+		}
+	}()
+	return listener.Addr().String(), data
+}
+
+func TestEmailSMTP(t *testing.T) {
+	r := require.New(t)
+	addr, data := smtpServer(t, true)
+	email := NewEmail(addr, "", "", "bot@example.com", []string{"a@example.com"}, time.Second)
+	r.NoError(email.Notify(Event{Kind: "alert", Subject: "wide spread", Payload: map[string]string{"value": "25"}}))
+	r.Contains(<-data, "Subject: [alert] wide spread")
+
+	addr, _ = smtpServer(t, false)
+	email = NewEmail(addr, "", "", "bot@example.com", []string{"a@example.com"}, 50*time.Millisecond)
+	start := time.Now()
+	r.Error(email.Notify(Event{Kind: "alert"}), "unresponsive server")
+	r.True(time.Since(start) < 500*time.Millisecond, "session is bounded by timeout")
+}
@@ -0,0 +1,120 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/go-resty/resty/v2"
+)
+
+// Event is notification sent to notifiers, Payload is encoded as JSON
+type Event struct {
+	Kind    string      `json:"kind"`
+	Subject string      `json:"subject"`
+	Payload interface{} `json:"payload"`
+	Time    time.Time   `json:"time"`
+}
+
+// Notifier delivers events to external destination
+type Notifier interface {
+	Notify(event Event) error
+}
+
+// Stdout writes each event as single line of JSON to Writer, e.g. os.Stdout
+type Stdout struct {
+	Writer io.Writer
+}
+
+// Notify writes event as JSON line
+func (s Stdout) Notify(event Event) error {
+	encoder := json.NewEncoder(s.Writer)
+	// rule expressions are written as is, e.g. spread > 20 bps
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(event); err != nil {
+		return errors.Wrap(err, "[notify] failed to write event")
+	}
+	return nil
+}
+
+// Multi delivers events to every notifier, failure of one does not stop the others
+type Multi []Notifier
+
+// Notify sends event to every notifier and returns their combined errors
+func (m Multi) Notify(event Event) error {
+	errs := []error{}
+	for _, n := range m {
+		errs = append(errs, n.Notify(event))
+	}
+	return errors.Combine(errs...)
+}
+
+// Async delivers events to notifier in background, so slow destination does not block caller.
+// Failure of delivery is passed to onError since caller has already moved on
+type Async struct {
+	notifier Notifier
+	events   chan Event
+	onError  func(error)
+	done     sync.WaitGroup
+}
+
+// NewAsync returns notifier queueing up to buffer events for notifier
+func NewAsync(notifier Notifier, buffer int, onError func(error)) *Async {
+	a := &Async{notifier: notifier, events: make(chan Event, buffer), onError: onError}
+	a.done.Add(1)
+	go func() {
+		defer a.done.Done()
+		for event := range a.events {
+			if err := a.notifier.Notify(event); err != nil {
+				a.onError(err)
+			}
+		}
+	}()
+	return a
+}
+
+// Notify queues event without waiting for delivery, event is dropped when queue is full
+func (a *Async) Notify(event Event) error {
+	select {
+	case a.events <- event:
+		return nil
+	default:
+		return errors.Wrapf(fmt.Errorf("queue of %v events is full", cap(a.events)), "[notify] dropped event %v", event.Subject)
+	}
+}
+
+// Close stops accepting events and waits until queued events are delivered
+func (a *Async) Close() {
+	close(a.events)
+	a.done.Wait()
+}
+
+// Webhook posts events as JSON to URL
+type Webhook struct {
+	URL string
+
+	client *resty.Client
+}
+
+// NewWebhook returns webhook notifier posting to url with timeout
+func NewWebhook(url string, timeout time.Duration) *Webhook {
+	return &Webhook{URL: url, client: resty.New().SetTimeout(timeout)}
+}
+
+// Notify posts event to URL, non-2xx response is an error
+func (w *Webhook) Notify(event Event) error {
+	resp, err := w.client.R().
+		SetHeader("Content-Type", "application/json").
+		SetBody(event).
+		Post(w.URL)
+	if err != nil {
+		return errors.Wrapf(err, "[notify] failed to call webhook %v", w.URL)
+	}
+	if resp.IsError() {
+		return errors.Wrapf(fmt.Errorf("unexpected status %v", resp.StatusCode()), "[notify] failed to call webhook %v", w.URL)
+	}
+	return nil
+}
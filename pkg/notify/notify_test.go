@@ -0,0 +1,96 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhook(t *testing.T) {
+	r := require.New(t)
+	received := []map[string]interface{}{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body := map[string]interface{}{}
+		r.NoError(json.NewDecoder(req.Body).Decode(&body))
+		received = append(received, body)
+		if body["kind"] == "fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	webhook := NewWebhook(server.URL, time.Second)
+	r.NoError(webhook.Notify(Event{Kind: "arbitrage", Subject: "BTC-USD", Payload: map[string]string{"size": "1"}}))
+	r.Len(received, 1)
+	r.Equal("BTC-USD", received[0]["subject"])
+	r.Equal(map[string]interface{}{"size": "1"}, received[0]["payload"])
+
+	r.Error(webhook.Notify(Event{Kind: "fail"}))
+}
+
+type failing struct{}
+
+func (failing) Notify(Event) error {
+	return fmt.Errorf("unavailable")
+}
+
+func TestStdoutAndMulti(t *testing.T) {
+	r := require.New(t)
+	var a, b bytes.Buffer
+	at := time.Date(2019, 10, 17, 0, 0, 0, 0, time.UTC)
+
+	multi := Multi{Stdout{Writer: &a}, failing{}, Stdout{Writer: &b}}
+	err := multi.Notify(Event{Kind: "alert", Subject: "wide spread", Time: at})
+	r.Error(err)
+	r.Equal(`{"kind":"alert","subject":"wide spread","payload":null,"time":"2019-10-17T00:00:00Z"}`+"\n", a.String())
+	r.Equal(a.String(), b.String(), "failing notifier does not stop the others")
+
+	r.NoError(Multi{Stdout{Writer: &a}}.Notify(Event{}))
+}
+
+// blocking records events after release is closed
+type blocking struct {
+	release chan struct{}
+	events  chan Event
+}
+
+func (b blocking) Notify(event Event) error {
+	<-b.release
+	b.events <- event
+	if event.Kind == "fail" {
+		return fmt.Errorf("unavailable")
+	}
+	return nil
+}
+
+func TestAsync(t *testing.T) {
+	r := require.New(t)
+	slow := blocking{release: make(chan struct{}), events: make(chan Event, 10)}
+	errs := make(chan error, 10)
+	async := NewAsync(slow, 2, func(err error) { errs <- err })
+
+	// first event is taken by delivery goroutine, next two wait in queue
+	r.NoError(async.Notify(Event{Subject: "1"}))
+	for len(async.events) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	r.NoError(async.Notify(Event{Subject: "2"}))
+	r.NoError(async.Notify(Event{Subject: "3", Kind: "fail"}))
+	r.Error(async.Notify(Event{Subject: "4"}), "queue is full")
+
+	close(slow.release)
+	async.Close()
+	close(slow.events)
+	delivered := []string{}
+	for event := range slow.events {
+		delivered = append(delivered, event.Subject)
+	}
+	r.Equal([]string{"1", "2", "3"}, delivered)
+	r.Len(errs, 1, "failure of delivery is reported")
+}
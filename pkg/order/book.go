@@ -98,7 +98,7 @@ func MatchUntilSatisfied(side string, ods []Order, amount decimal.Decimal) (deci
 // Book holds general info of orderbook list
 // both bid side and ask side along with retrieval timestamp
 type Book struct {
-	Sequence  string    `json:"sequence"`
+	Sequence  Sequence  `json:"sequence"`
 	Bids      []Order   `json:"bids"`
 	Asks      []Order   `json:"asks"`
 	UpdatedAt time.Time `json:"updated_at"`
@@ -127,3 +127,9 @@ type BookStreamer interface {
 	AssetPair() (string, string)
 	PairOf(string) string
 }
+
+// BookFetcher is implemented by engines that can fetch single order book
+// without crashing on failure, so caller can retry later
+type BookFetcher interface {
+	FetchBook(config map[string]string) (Book, error)
+}
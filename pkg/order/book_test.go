@@ -38,7 +38,7 @@ func TestMatchAsk(t *testing.T) {
 			expectedSatisfactory: true,
 			expectedLeft:         decimal.NewFromFloat(0),
 			expectedLeftover: Order{
-				Price: decimal.NewFromFloat(3000),
+				Price: decimal.NewFromFloat(100),
 				Size:  decimal.NewFromFloat(0),
 			},
 		},
@@ -49,7 +49,7 @@ func TestMatchAsk(t *testing.T) {
 			expectedSatisfactory: false,
 			expectedLeft:         decimal.NewFromFloat(0),
 			expectedLeftover: Order{
-				Price: decimal.NewFromFloat(0),
+				Price: decimal.NewFromFloat(100),
 				Size:  decimal.NewFromFloat(0),
 			},
 		},
@@ -61,6 +61,7 @@ func TestMatchAsk(t *testing.T) {
 		a.Equal(tc.expectedSatisfactory, satisfied)
 		a.True(tc.expectedLeft.Equals(left))
 		a.True(tc.expectedLeftover.Size.Equals(leftover.Size))
+		a.True(tc.expectedLeftover.Price.Equals(leftover.Price))
 	}
 }
 
@@ -104,7 +105,7 @@ func TestMatchBid(t *testing.T) {
 			expectedSatisfactory: false,
 			expectedLeft:         decimal.NewFromFloat(0),
 			expectedLeftover: Order{
-				Price: decimal.NewFromFloat(0),
+				Price: decimal.NewFromFloat(100),
 				Size:  decimal.NewFromFloat(0),
 			},
 		},
@@ -116,6 +117,7 @@ func TestMatchBid(t *testing.T) {
 		a.Equal(tc.expectedSatisfactory, satisfied)
 		a.True(tc.expectedLeft.Equals(left))
 		a.True(tc.expectedLeftover.Size.Equals(leftover.Size))
+		a.True(tc.expectedLeftover.Price.Equals(leftover.Price))
 	}
 }
 
@@ -143,7 +145,7 @@ func TestMatchUntilSatisfied(t *testing.T) {
 		},
 	}
 	book := Book{
-		Sequence:  "0",
+		Sequence:  0,
 		Bids:      bids,
 		Asks:      asks,
 		UpdatedAt: time.Now(),
@@ -0,0 +1,326 @@
+package order
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"math/bits"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/shopspring/decimal"
+)
+
+// ErrFixedOverflow is returned when fixed-point value or intermediate
+// volume of matching does not fit in int64
+var ErrFixedOverflow = errors.NewPlain("fixed-point value overflows int64")
+
+// maxPlaces is the most decimal places 10^places of which fits in int64
+const maxPlaces = 18
+
+// Scale is number of decimal places of prices and sizes of product, e.g. BTC-USD
+// with 0.01 quote increment and 0.00000001 base increment has Scale{Price: 2, Size: 8}.
+// volume of price*size has Price+Size places, so that it is exact as well
+type Scale struct {
+	Price int32 `json:"price"`
+	Size  int32 `json:"size"`
+}
+
+// Volume returns number of decimal places of price*size
+func (s Scale) Volume() int32 {
+	return s.Price + s.Size
+}
+
+// Validate checks that volume of scale can be represented in int64
+func (s Scale) Validate() error {
+	if s.Price < 0 || s.Size < 0 || s.Volume() > maxPlaces {
+		return errors.Wrapf(fmt.Errorf("need non-negative places up to %v in total, got %+v", maxPlaces, s), "malformed scale")
+	}
+	return nil
+}
+
+// input returns places of amount matched against side, as in MatchUntilSatisfied
+// "bid" input is in quote and "ask" input is in base
+func (s Scale) input(side string) int32 {
+	if side == "ask" {
+		return s.Size
+	}
+	return s.Volume()
+}
+
+// output returns places of amount matched by side
+func (s Scale) output(side string) int32 {
+	if side == "ask" {
+		return s.Volume()
+	}
+	return s.Size
+}
+
+// ScaleOf returns scale of product from its price and size increments
+func ScaleOf(priceIncrement, sizeIncrement decimal.Decimal) (Scale, error) {
+	scale := Scale{Price: places(priceIncrement), Size: places(sizeIncrement)}
+	return scale, scale.Validate()
+}
+
+// DetectScale returns the smallest scale of at least min places which represents
+// every level of book losslessly, for products of which increments are unknown
+func DetectScale(book Book, min Scale) (Scale, error) {
+	scale := min
+	for _, ods := range [][]Order{book.Bids, book.Asks} {
+		for _, od := range ods {
+			if p := places(od.Price); p > scale.Price {
+				scale.Price = p
+			}
+			if p := places(od.Size); p > scale.Size {
+				scale.Size = p
+			}
+		}
+	}
+	return scale, scale.Validate()
+}
+
+// places returns number of decimal places of d without trailing zeros
+func places(d decimal.Decimal) int32 {
+	s := d.String()
+	dot := strings.IndexByte(s, '.')
+	if dot < 0 {
+		return 0
+	}
+	return int32(len(s) - dot - 1)
+}
+
+// ToFixed converts d into integer count of 10^-places units,
+// fails when d has more decimal places or does not fit in int64
+func ToFixed(d decimal.Decimal, places int32) (int64, error) {
+	value := d.Coefficient()
+	shift := d.Exponent() + places
+	switch {
+	case shift < 0:
+		remainder := new(big.Int)
+		value.QuoRem(value, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(-shift)), nil), remainder)
+		if remainder.Sign() != 0 {
+			return 0, errors.Wrapf(fmt.Errorf("%v has more than %v decimal places", d, places), "lossy fixed-point conversion")
+		}
+	case shift > 0:
+		value.Mul(value, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(shift)), nil))
+	}
+	if !value.IsInt64() {
+		return 0, errors.Wrapf(ErrFixedOverflow, "%v at %v decimal places", d, places)
+	}
+	return value.Int64(), nil
+}
+
+// FromFixed converts integer count of 10^-places units back into decimal
+func FromFixed(value int64, places int32) decimal.Decimal {
+	return decimal.New(value, -places)
+}
+
+// FixedOrder is Order of which price and size are fixed-point integers of book scale
+type FixedOrder struct {
+	OrderID   string
+	Price     int64
+	Size      int64
+	NumOrders int64
+}
+
+// ToFixedOrders converts orders into fixed-point orders of scale,
+// prices must be positive and sizes must not be negative
+func ToFixedOrders(ods []Order, scale Scale) ([]FixedOrder, error) {
+	fixed := make([]FixedOrder, len(ods))
+	for i, od := range ods {
+		price, err := ToFixed(od.Price, scale.Price)
+		if err != nil {
+			return nil, errors.Wrap(err, "malformed price")
+		}
+		size, err := ToFixed(od.Size, scale.Size)
+		if err != nil {
+			return nil, errors.Wrap(err, "malformed size")
+		}
+		if price <= 0 || size < 0 {
+			return nil, errors.Wrapf(fmt.Errorf("level %v at %v", od.Size, od.Price), "need positive price and non-negative size")
+		}
+		fixed[i] = FixedOrder{OrderID: od.OrderID, Price: price, Size: size, NumOrders: od.NumOrders}
+	}
+	return fixed, nil
+}
+
+// FromFixedOrders converts fixed-point orders of scale back into orders
+func FromFixedOrders(fixed []FixedOrder, scale Scale) []Order {
+	ods := make([]Order, len(fixed))
+	for i, od := range fixed {
+		ods[i] = Order{
+			OrderID:   od.OrderID,
+			Price:     FromFixed(od.Price, scale.Price),
+			Size:      FromFixed(od.Size, scale.Size),
+			NumOrders: od.NumOrders,
+		}
+	}
+	return ods
+}
+
+// mulFixed multiplies non-negative values through 128-bit product,
+// and fails instead of wrapping around when result does not fit in int64
+func mulFixed(a, b int64) (int64, error) {
+	hi, lo := bits.Mul64(uint64(a), uint64(b))
+	if hi != 0 || lo > math.MaxInt64 {
+		return 0, ErrFixedOverflow
+	}
+	return int64(lo), nil
+}
+
+// addFixed adds non-negative values, and fails when sum does not fit in int64
+func addFixed(a, b int64) (int64, error) {
+	if a > math.MaxInt64-b {
+		return 0, ErrFixedOverflow
+	}
+	return a + b, nil
+}
+
+// MatchFixed works as MatchUntilSatisfied on fixed-point orders without allocating.
+// "bid" amount and consumed are quote at volume places of scale and matched is base at size places,
+// "ask" amount and consumed are base at size places and matched is quote at volume places.
+// base matched on partially taken level is rounded down to size places, as exchange can not fill
+// less than base increment, everything else is exact
+func MatchFixed(side string, ods []FixedOrder, amount int64) (int64, int64, error) {
+	if side != "bid" && side != "ask" {
+		panic("unexpected side value")
+	}
+	consumed, matched := int64(0), int64(0)
+	for _, od := range ods {
+		left := amount - consumed
+		if left <= 0 {
+			break
+		}
+		volume, err := mulFixed(od.Price, od.Size)
+		if err != nil {
+			return 0, 0, err
+		}
+		input, output := volume, od.Size
+		if side == "ask" {
+			input, output = od.Size, volume
+		}
+
+		if input >= left {
+			taken := left / od.Price
+			if side == "ask" {
+				if taken, err = mulFixed(left, od.Price); err != nil {
+					return 0, 0, err
+				}
+			}
+			matched, err = addFixed(matched, taken)
+			return amount, matched, err
+		}
+		consumed += input
+		if matched, err = addFixed(matched, output); err != nil {
+			return 0, 0, err
+		}
+	}
+	return consumed, matched, nil
+}
+
+// QuoteFixed converts amount into fixed-point input of side, matches it with MatchFixed
+// and converts consumed and matched back into decimal
+func QuoteFixed(side string, ods []FixedOrder, scale Scale, amount decimal.Decimal) (decimal.Decimal, decimal.Decimal, error) {
+	input, err := ToFixed(amount, scale.input(side))
+	if err != nil {
+		return decimal.Zero, decimal.Zero, errors.Wrap(err, "malformed amount")
+	}
+	consumed, matched, err := MatchFixed(side, ods, input)
+	if err != nil {
+		return decimal.Zero, decimal.Zero, err
+	}
+	return FromFixed(consumed, scale.input(side)), FromFixed(matched, scale.output(side)), nil
+}
+
+// FixedBook is Book of fixed-point orders of single product scale
+type FixedBook struct {
+	Scale     Scale
+	Sequence  Sequence
+	Bids      []FixedOrder
+	Asks      []FixedOrder
+	UpdatedAt time.Time
+}
+
+// NewFixedBook converts book into fixed-point book of scale,
+// fails when any level can not be represented losslessly
+func NewFixedBook(book Book, scale Scale) (*FixedBook, error) {
+	if err := scale.Validate(); err != nil {
+		return nil, err
+	}
+	bids, err := ToFixedOrders(book.Bids, scale)
+	if err != nil {
+		return nil, errors.Wrap(err, "malformed bids")
+	}
+	asks, err := ToFixedOrders(book.Asks, scale)
+	if err != nil {
+		return nil, errors.Wrap(err, "malformed asks")
+	}
+	return &FixedBook{Scale: scale, Sequence: book.Sequence, Bids: bids, Asks: asks, UpdatedAt: book.UpdatedAt}, nil
+}
+
+// Book converts fixed-point book back into book
+func (b *FixedBook) Book() Book {
+	return Book{
+		Sequence:  b.Sequence,
+		Bids:      FromFixedOrders(b.Bids, b.Scale),
+		Asks:      FromFixedOrders(b.Asks, b.Scale),
+		UpdatedAt: b.UpdatedAt,
+	}
+}
+
+// GetOrdersBySide returns orders by side argument
+func (b *FixedBook) GetOrdersBySide(side string) ([]FixedOrder, error) {
+	switch side {
+	case "bid":
+		return b.Bids, nil
+	case "ask":
+		return b.Asks, nil
+	default:
+		return nil, errors.Wrapf(fmt.Errorf("unexpected side, need [bid|ask] got [%v]", side), "unrecognized side")
+	}
+}
+
+// Update sets size of price level on side as level 2 update does, zero size removes level.
+// levels are kept sorted, bids from highest and asks from lowest price
+func (b *FixedBook) Update(side string, price, size int64) error {
+	if price <= 0 || size < 0 {
+		return errors.Wrapf(fmt.Errorf("level %v at %v", size, price), "need positive price and non-negative size")
+	}
+	levels := &b.Asks
+	better := func(a, b int64) bool { return a < b }
+	switch side {
+	case "bid":
+		levels = &b.Bids
+		better = func(a, b int64) bool { return a > b }
+	case "ask":
+	default:
+		return errors.Wrapf(fmt.Errorf("unexpected side, need [bid|ask] got [%v]", side), "unrecognized side")
+	}
+
+	// binary search for first level not better than price
+	ods := *levels
+	lo, hi := 0, len(ods)
+	for lo < hi {
+		mid := int(uint(lo+hi) >> 1)
+		if better(ods[mid].Price, price) {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	found := lo < len(ods) && ods[lo].Price == price
+
+	switch {
+	case found && size == 0:
+		*levels = append(ods[:lo], ods[lo+1:]...)
+	case found:
+		ods[lo].Size = size
+	case size != 0:
+		ods = append(ods, FixedOrder{})
+		copy(ods[lo+1:], ods[lo:])
+		ods[lo] = FixedOrder{Price: price, Size: size}
+		*levels = ods
+	}
+	return nil
+}
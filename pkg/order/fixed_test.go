@@ -0,0 +1,212 @@
+package order
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"emperror.dev/errors"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFixedConversion(t *testing.T) {
+	r := require.New(t)
+
+	scale, err := ScaleOf(decimal.RequireFromString("0.01000000"), decimal.RequireFromString("0.00000001"))
+	r.NoError(err)
+	r.Equal(Scale{Price: 2, Size: 8}, scale)
+	r.Equal(int32(10), scale.Volume())
+
+	for _, s := range []string{"170.95", "0.34084807", "171", "0", "-1.5", "92233720368.54775807"} {
+		d := decimal.RequireFromString(s)
+		fixed, err := ToFixed(d, scale.Size)
+		r.NoError(err, s)
+		r.True(d.Equal(FromFixed(fixed, scale.Size)), "lossless round trip of %v", s)
+	}
+	fixed, err := ToFixed(decimal.RequireFromString("170.95"), 2)
+	r.NoError(err)
+	r.Equal(int64(17095), fixed)
+
+	_, err = ToFixed(decimal.RequireFromString("170.955"), 2)
+	r.Error(err, "more places than scale")
+	_, err = ToFixed(decimal.RequireFromString("92233720368.54775808"), 8)
+	r.True(errors.Is(err, ErrFixedOverflow))
+
+	_, err = ScaleOf(decimal.RequireFromString("0.0000000001"), decimal.RequireFromString("0.000000001"))
+	r.Error(err, "volume places beyond int64")
+}
+
+func TestFixedBook(t *testing.T) {
+	r := require.New(t)
+	book := Book{
+		Sequence: 7,
+		Bids: []Order{
+			{Price: decimal.RequireFromString("170.95"), Size: decimal.RequireFromString("0.34084807"), NumOrders: 1},
+			{Price: decimal.RequireFromString("170.9"), Size: decimal.RequireFromString("2"), NumOrders: 3},
+		},
+		Asks: []Order{
+			{Price: decimal.RequireFromString("170.97"), Size: decimal.RequireFromString("7.64562173"), OrderID: "da863862"},
+		},
+	}
+	scale, err := DetectScale(book, Scale{})
+	r.NoError(err)
+	r.Equal(Scale{Price: 2, Size: 8}, scale)
+	detected, err := DetectScale(book, Scale{Price: 4, Size: 2})
+	r.NoError(err)
+	r.Equal(Scale{Price: 4, Size: 8}, detected)
+
+	fb, err := NewFixedBook(book, scale)
+	r.NoError(err)
+	r.Equal(FixedOrder{Price: 17095, Size: 34084807, NumOrders: 1}, fb.Bids[0])
+	r.Equal("da863862", fb.Asks[0].OrderID)
+
+	back := fb.Book()
+	r.Equal(book.Sequence, back.Sequence)
+	for i := range book.Bids {
+		r.True(book.Bids[i].Price.Equal(back.Bids[i].Price))
+		r.True(book.Bids[i].Size.Equal(back.Bids[i].Size))
+		r.Equal(book.Bids[i].NumOrders, back.Bids[i].NumOrders)
+	}
+
+	_, err = NewFixedBook(book, Scale{Price: 1, Size: 8})
+	r.Error(err, "170.95 can not be represented with 1 place")
+	_, err = NewFixedBook(Book{Bids: []Order{{Price: decimal.Zero, Size: decimal.New(1, 0)}}}, scale)
+	r.Error(err, "zero price")
+}
+
+func TestFixedBookUpdate(t *testing.T) {
+	r := require.New(t)
+	fb := &FixedBook{Scale: Scale{Price: 2, Size: 8}}
+
+	r.NoError(fb.Update("bid", 100, 1))
+	r.NoError(fb.Update("bid", 300, 3))
+	r.NoError(fb.Update("bid", 200, 2))
+	r.NoError(fb.Update("ask", 500, 5))
+	r.NoError(fb.Update("ask", 400, 4))
+	r.NoError(fb.Update("ask", 600, 6))
+	r.Equal([]FixedOrder{{Price: 300, Size: 3}, {Price: 200, Size: 2}, {Price: 100, Size: 1}}, fb.Bids)
+	r.Equal([]FixedOrder{{Price: 400, Size: 4}, {Price: 500, Size: 5}, {Price: 600, Size: 6}}, fb.Asks)
+
+	r.NoError(fb.Update("bid", 200, 20))
+	r.NoError(fb.Update("ask", 400, 0))
+	r.NoError(fb.Update("ask", 450, 0), "removing missing level is no-op")
+	r.Equal([]FixedOrder{{Price: 300, Size: 3}, {Price: 200, Size: 20}, {Price: 100, Size: 1}}, fb.Bids)
+	r.Equal([]FixedOrder{{Price: 500, Size: 5}, {Price: 600, Size: 6}}, fb.Asks)
+
+	r.Error(fb.Update("both", 100, 1))
+	r.Error(fb.Update("bid", 0, 1))
+	r.Error(fb.Update("bid", 100, -1))
+}
+
+func TestMatchFixed(t *testing.T) {
+	r := require.New(t)
+	ods := []Order{
+		{Price: decimal.RequireFromString("3000"), Size: decimal.RequireFromString("2")},
+		{Price: decimal.RequireFromString("3000.5"), Size: decimal.RequireFromString("0.5")},
+		{Price: decimal.RequireFromString("3001.25"), Size: decimal.RequireFromString("1.12345678")},
+	}
+	scale := Scale{Price: 2, Size: 8}
+	fixed, err := ToFixedOrders(ods, scale)
+	r.NoError(err)
+
+	for _, s := range []string{"0", "1000", "6000", "6000.01", "7500.25", "9000", "100000"} {
+		amount := decimal.RequireFromString(s)
+		for _, side := range []string{"bid", "ask"} {
+			if side == "ask" && amount.GreaterThan(decimal.New(10, 0)) {
+				amount = amount.Div(decimal.New(1000, 0))
+			}
+			expectConsumed, expectMatched := MatchUntilSatisfied(side, ods, amount)
+			consumed, matched, err := QuoteFixed(side, fixed, scale, amount)
+			r.NoError(err)
+			r.True(expectConsumed.Equal(consumed), "%v %v consumed %v, decimal %v", side, amount, consumed, expectConsumed)
+			if side == "ask" {
+				r.True(expectMatched.Equal(matched), "%v %v matched %v, decimal %v", side, amount, matched, expectMatched)
+				continue
+			}
+			// base of partially taken level is rounded down to size places
+			r.True(matched.LessThanOrEqual(expectMatched), "%v %v matched %v, decimal %v", side, amount, matched, expectMatched)
+			r.True(expectMatched.Sub(matched).LessThan(decimal.New(1, -scale.Size)), "%v %v matched %v, decimal %v", side, amount, matched, expectMatched)
+		}
+	}
+
+	_, _, err = QuoteFixed("ask", fixed, scale, decimal.RequireFromString("0.000000001"))
+	r.Error(err, "amount finer than base increment")
+
+	_, _, err = MatchFixed("bid", []FixedOrder{{Price: math.MaxInt64 / 2, Size: 3}}, 1)
+	r.True(errors.Is(err, ErrFixedOverflow))
+	r.Panics(func() { MatchFixed("both", fixed, 1) })
+}
+
+// benchmarkOrders returns 50 levels of BTC-USD like asks
+func benchmarkOrders() []Order {
+	ods := make([]Order, 50)
+	for i := range ods {
+		ods[i] = Order{
+			Price: decimal.RequireFromString(fmt.Sprintf("9000.%02d", i)),
+			Size:  decimal.RequireFromString(fmt.Sprintf("%d.12345678", i%5+1)),
+		}
+	}
+	return ods
+}
+
+// benchmark amount walks about half of benchmark levels
+var benchmarkAmount = decimal.RequireFromString("600000.01")
+
+func BenchmarkMatchUntilSatisfied(b *testing.B) {
+	ods := benchmarkOrders()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		MatchUntilSatisfied("bid", ods, benchmarkAmount)
+	}
+}
+
+func BenchmarkMatchFixed(b *testing.B) {
+	scale := Scale{Price: 2, Size: 8}
+	fixed, err := ToFixedOrders(benchmarkOrders(), scale)
+	if err != nil {
+		b.Fatal(err)
+	}
+	amount, err := ToFixed(benchmarkAmount, scale.Volume())
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := MatchFixed("bid", fixed, amount); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkQuoteFixed(b *testing.B) {
+	scale := Scale{Price: 2, Size: 8}
+	fixed, err := ToFixedOrders(benchmarkOrders(), scale)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := QuoteFixed("bid", fixed, scale, benchmarkAmount); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFixedBookUpdate(b *testing.B) {
+	fb, err := NewFixedBook(Book{Asks: benchmarkOrders()}, Scale{Price: 2, Size: 8})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// level in the middle is removed and inserted again on every other update
+		if err := fb.Update("ask", 900025, int64(i%2)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package order
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/shopspring/decimal"
+)
+
+var bpsMultiplier = decimal.New(10000, 0)
+
+// Rung holds matching result of single amount in ladder
+// AvgPrice and WorstPrice are in book price unit, SlippageBps is distance
+// between average price and best price of book in basis points
+type Rung struct {
+	Amount      decimal.Decimal `json:"amount"`
+	Consumed    decimal.Decimal `json:"consumed"`
+	Matched     decimal.Decimal `json:"matched"`
+	AvgPrice    decimal.Decimal `json:"avg_price"`
+	WorstPrice  decimal.Decimal `json:"worst_price"`
+	SlippageBps decimal.Decimal `json:"slippage_bps"`
+	Satisfied   bool            `json:"satisfied"`
+}
+
+// MatchLadder matches every amount against "sorted" orders in single pass
+// and returns rungs in the same order as supplied amounts.
+// consumed and matched of each rung are the same as calling MatchUntilSatisfied with its amount.
+func MatchLadder(side string, ods []Order, amounts []decimal.Decimal) []Rung {
+	if side != "bid" && side != "ask" {
+		panic("unexpected side value")
+	}
+
+	rungs := make([]Rung, len(amounts))
+	indexes := make([]int, len(amounts))
+	for i := range amounts {
+		indexes[i] = i
+		rungs[i].Amount = amounts[i]
+	}
+	sort.SliceStable(indexes, func(a, b int) bool {
+		return amounts[indexes[a]].LessThan(amounts[indexes[b]])
+	})
+
+	// cumulative input taken and output matched from fully consumed orders
+	cumInput := decimal.Zero
+	cumOutput := decimal.Zero
+	next := 0
+	for _, od := range ods {
+		if next == len(indexes) {
+			break
+		}
+		input, output := od.Volume(), od.Size
+		if side == "ask" {
+			input, output = od.Size, od.Volume()
+		}
+
+		levelEnd := cumInput.Add(input)
+		for next < len(indexes) && amounts[indexes[next]].LessThanOrEqual(levelEnd) {
+			i := indexes[next]
+			taken := amounts[i].Sub(cumInput)
+			takenOutput := taken.Div(od.Price)
+			if side == "ask" {
+				takenOutput = taken.Mul(od.Price)
+			}
+			rungs[i].Consumed = amounts[i]
+			rungs[i].Matched = cumOutput.Add(takenOutput)
+			rungs[i].WorstPrice = od.Price
+			rungs[i].Satisfied = true
+			next++
+		}
+		cumInput = levelEnd
+		cumOutput = cumOutput.Add(output)
+	}
+
+	// amounts larger than whole book are filled as much as possible
+	for ; next < len(indexes); next++ {
+		i := indexes[next]
+		rungs[i].Consumed = cumInput
+		rungs[i].Matched = cumOutput
+		if len(ods) != 0 {
+			rungs[i].WorstPrice = ods[len(ods)-1].Price
+		}
+	}
+
+	for i := range rungs {
+		rungs[i].AvgPrice, rungs[i].SlippageBps = priceImpact(side, ods, rungs[i].Consumed, rungs[i].Matched)
+	}
+	return rungs
+}
+
+// priceImpact returns average price and slippage from best price in basis points
+func priceImpact(side string, ods []Order, consumed, matched decimal.Decimal) (decimal.Decimal, decimal.Decimal) {
+	if len(ods) == 0 || consumed.IsZero() || matched.IsZero() {
+		return decimal.Zero, decimal.Zero
+	}
+	avg := consumed.Div(matched)
+	if side == "ask" {
+		avg = matched.Div(consumed)
+	}
+	best := ods[0].Price
+	slippage := avg.Sub(best).Abs().Div(best).Mul(bpsMultiplier)
+	return avg, slippage
+}
+
+// MaxLadderRungs is maximum number of amounts of ladder, since every rung
+// is matched against every order book
+const MaxLadderRungs = 1000
+
+// ParseLadder parses ladder notation into list of positive amounts
+// ladder can be either comma-separated amounts, e.g. "1,10,100,1000"
+// or range with step in start:stop:step format, e.g. "100:1000:100" which includes stop,
+// ladder of more than MaxLadderRungs amounts is rejected
+func ParseLadder(ladder string) ([]decimal.Decimal, error) {
+	if strings.Contains(ladder, ":") {
+		return parseLadderRange(ladder)
+	}
+
+	fields := strings.Split(ladder, ",")
+	if len(fields) > MaxLadderRungs {
+		return nil, errors.Wrapf(fmt.Errorf("need at most %v amounts, got %v", MaxLadderRungs, len(fields)), "malformed ladder")
+	}
+	amounts := []decimal.Decimal{}
+	for _, field := range fields {
+		amount, err := decimal.NewFromString(strings.TrimSpace(field))
+		if err != nil {
+			return nil, errors.Wrapf(err, "malformed ladder amount [%v]", field)
+		}
+		if !amount.IsPositive() {
+			return nil, errors.Wrapf(fmt.Errorf("need positive amount, got [%v]", field), "malformed ladder amount")
+		}
+		amounts = append(amounts, amount)
+	}
+	return amounts, nil
+}
+
+func parseLadderRange(ladder string) ([]decimal.Decimal, error) {
+	fields := strings.Split(ladder, ":")
+	if len(fields) != 3 {
+		return nil, errors.Wrapf(fmt.Errorf("need start:stop:step, got [%v]", ladder), "malformed ladder range")
+	}
+	bounds := make([]decimal.Decimal, 3)
+	for i, field := range fields {
+		d, err := decimal.NewFromString(strings.TrimSpace(field))
+		if err != nil {
+			return nil, errors.Wrapf(err, "malformed ladder range [%v]", ladder)
+		}
+		bounds[i] = d
+	}
+	start, stop, step := bounds[0], bounds[1], bounds[2]
+	if !start.IsPositive() || !step.IsPositive() || start.GreaterThan(stop) {
+		return nil, errors.Wrapf(fmt.Errorf("need positive start <= stop and positive step, got [%v]", ladder), "malformed ladder range")
+	}
+	if rungs := stop.Sub(start).Div(step).Floor().Add(decimal.New(1, 0)); rungs.GreaterThan(decimal.New(MaxLadderRungs, 0)) {
+		return nil, errors.Wrapf(fmt.Errorf("need at most %v rungs, got %v", MaxLadderRungs, rungs), "malformed ladder range")
+	}
+
+	amounts := []decimal.Decimal{}
+	for amount := start; amount.LessThanOrEqual(stop); amount = amount.Add(step) {
+		amounts = append(amounts, amount)
+	}
+	return amounts, nil
+}
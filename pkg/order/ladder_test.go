@@ -0,0 +1,101 @@
+package order
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchLadder(t *testing.T) {
+	r := require.New(t)
+
+	bids := []Order{
+		{Price: decimal.NewFromFloat(3000), Size: decimal.NewFromFloat(1)},
+		{Price: decimal.NewFromFloat(2000), Size: decimal.NewFromFloat(1)},
+	}
+	asks := []Order{
+		{Price: decimal.NewFromFloat(4000), Size: decimal.NewFromFloat(1)},
+		{Price: decimal.NewFromFloat(5000), Size: decimal.NewFromFloat(1)},
+	}
+
+	testcases := []struct {
+		name    string
+		side    string
+		orders  []Order
+		amounts []string
+	}{
+		{name: "[ask] unsorted ladder", side: "bid", orders: asks, amounts: []string{"9000", "3000", "15000", "6000", "4000"}},
+		{name: "[bid] unsorted ladder", side: "ask", orders: bids, amounts: []string{"1.5", "0.5", "5", "2", "1"}},
+	}
+
+	for _, tc := range testcases {
+		t.Logf("testcase: %v", tc.name)
+		amounts := []decimal.Decimal{}
+		for _, a := range tc.amounts {
+			amounts = append(amounts, decimal.RequireFromString(a))
+		}
+		rungs := MatchLadder(tc.side, tc.orders, amounts)
+		r.Len(rungs, len(amounts))
+		for i, rung := range rungs {
+			consumed, matched := MatchUntilSatisfied(tc.side, tc.orders, amounts[i])
+			r.True(amounts[i].Equals(rung.Amount))
+			r.Truef(consumed.Equals(rung.Consumed), "amount %v: expect consumed %v, got %v", amounts[i], consumed, rung.Consumed)
+			r.Truef(matched.Equals(rung.Matched), "amount %v: expect matched %v, got %v", amounts[i], matched, rung.Matched)
+		}
+	}
+
+	rungs := MatchLadder("bid", asks, []decimal.Decimal{decimal.NewFromFloat(4000), decimal.NewFromFloat(9000), decimal.NewFromFloat(10000)})
+	r.True(rungs[0].Satisfied)
+	r.True(decimal.NewFromFloat(4000).Equals(rungs[0].AvgPrice))
+	r.True(decimal.NewFromFloat(4000).Equals(rungs[0].WorstPrice))
+	r.True(rungs[0].SlippageBps.IsZero())
+	// 9000 usd for 2 btc, avg price 4500 is 1250 bps above best ask
+	r.True(decimal.NewFromFloat(4500).Equals(rungs[1].AvgPrice))
+	r.True(decimal.NewFromFloat(5000).Equals(rungs[1].WorstPrice))
+	r.True(decimal.NewFromFloat(1250).Equals(rungs[1].SlippageBps))
+	r.False(rungs[2].Satisfied)
+}
+
+func TestParseLadder(t *testing.T) {
+	r := require.New(t)
+
+	amounts, err := ParseLadder("1, 10,100,1000")
+	r.NoError(err)
+	r.Len(amounts, 4)
+	r.True(decimal.NewFromFloat(1000).Equals(amounts[3]))
+
+	amounts, err = ParseLadder("100:1000:100")
+	r.NoError(err)
+	r.Len(amounts, 10)
+	r.True(decimal.NewFromFloat(100).Equals(amounts[0]))
+	r.True(decimal.NewFromFloat(1000).Equals(amounts[9]))
+
+	amounts, err = ParseLadder("1:1000:1")
+	r.NoError(err)
+	r.Len(amounts, MaxLadderRungs)
+
+	testcases := []struct {
+		name   string
+		ladder string
+	}{
+		{name: "empty", ladder: ""},
+		{name: "malformed amount", ladder: "1,x"},
+		{name: "missing step", ladder: "1:2"},
+		{name: "start after stop", ladder: "10:1:1"},
+		{name: "zero step", ladder: "1:10:0"},
+		{name: "negative step", ladder: "1:10:-1"},
+		{name: "negative amount", ladder: "1,-10,100"},
+		{name: "zero amount", ladder: "0,10"},
+		{name: "zero start", ladder: "0:10:1"},
+		{name: "negative start", ladder: "-5:10:1"},
+		{name: "too many rungs of range", ladder: "1:1000000:0.000001"},
+		{name: "one rung over cap", ladder: "1:1001:1"},
+		{name: "too many amounts", ladder: strings.Repeat("1,", MaxLadderRungs) + "1"},
+	}
+	for _, tc := range testcases {
+		_, err := ParseLadder(tc.ladder)
+		r.Errorf(err, "%v: ladder [%v] should be rejected", tc.name, tc.ladder)
+	}
+}
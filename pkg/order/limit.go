@@ -0,0 +1,51 @@
+package order
+
+import (
+	"fmt"
+
+	"emperror.dev/errors"
+	"github.com/shopspring/decimal"
+)
+
+// WithinLimit returns leading orders of "sorted" orders that can be matched at limit price.
+// side follows MatchUntilSatisfied, "bid" input buys with price at or below limit
+// and "ask" input sells with price at or above limit.
+func WithinLimit(side string, ods []Order, limit decimal.Decimal) []Order {
+	for i, od := range ods {
+		switch side {
+		case "bid":
+			if od.Price.GreaterThan(limit) {
+				return ods[:i]
+			}
+		case "ask":
+			if od.Price.LessThan(limit) {
+				return ods[:i]
+			}
+		default:
+			panic("unexpected side value")
+		}
+	}
+	return ods
+}
+
+// LimitFromSlippage returns limit price which is maxSlippageBps away from reference price
+// in unfavorable direction of side
+func LimitFromSlippage(side string, reference, maxSlippageBps decimal.Decimal) decimal.Decimal {
+	offset := reference.Mul(maxSlippageBps).Div(bpsMultiplier)
+	switch side {
+	case "bid":
+		return reference.Add(offset)
+	case "ask":
+		return reference.Sub(offset)
+	default:
+		panic("unexpected side value")
+	}
+}
+
+// MidPrice returns average of best bid and best ask
+func (b Book) MidPrice() (decimal.Decimal, error) {
+	if len(b.Bids) == 0 || len(b.Asks) == 0 {
+		return decimal.Zero, errors.Wrap(fmt.Errorf("need both bids and asks, got %v bids and %v asks", len(b.Bids), len(b.Asks)), "mid price unavailable")
+	}
+	return b.Bids[0].Price.Add(b.Asks[0].Price).Div(decimal.New(2, 0)), nil
+}
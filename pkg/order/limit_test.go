@@ -0,0 +1,100 @@
+package order
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithinLimit(t *testing.T) {
+	r := require.New(t)
+
+	bids := []Order{
+		{Price: decimal.NewFromFloat(3000), Size: decimal.NewFromFloat(1)},
+		{Price: decimal.NewFromFloat(2000), Size: decimal.NewFromFloat(1)},
+	}
+	asks := []Order{
+		{Price: decimal.NewFromFloat(4000), Size: decimal.NewFromFloat(1)},
+		{Price: decimal.NewFromFloat(5000), Size: decimal.NewFromFloat(1)},
+	}
+
+	testcases := []struct {
+		name           string
+		orders         []Order
+		inputSide      string
+		input          decimal.Decimal
+		limit          decimal.Decimal
+		expectConsumed decimal.Decimal
+		expectMatched  decimal.Decimal
+		expectRest     decimal.Decimal
+	}{
+		{
+			name:           "[ask] limit stops before second level",
+			orders:         asks,
+			inputSide:      "bid",
+			input:          decimal.NewFromFloat(9000),
+			limit:          decimal.NewFromFloat(4500),
+			expectConsumed: decimal.NewFromFloat(4000),
+			expectMatched:  decimal.NewFromFloat(1),
+			expectRest:     decimal.NewFromFloat(5000),
+		},
+		{
+			name:           "[ask] limit is not reached",
+			orders:         asks,
+			inputSide:      "bid",
+			input:          decimal.NewFromFloat(3000),
+			limit:          decimal.NewFromFloat(4000),
+			expectConsumed: decimal.NewFromFloat(3000),
+			expectMatched:  decimal.NewFromFloat(0.75),
+			expectRest:     decimal.Zero,
+		},
+		{
+			name:           "[ask] limit below best price",
+			orders:         asks,
+			inputSide:      "bid",
+			input:          decimal.NewFromFloat(3000),
+			limit:          decimal.NewFromFloat(3999),
+			expectConsumed: decimal.Zero,
+			expectMatched:  decimal.Zero,
+			expectRest:     decimal.NewFromFloat(3000),
+		},
+		{
+			name:           "[bid] limit stops before second level",
+			orders:         bids,
+			inputSide:      "ask",
+			input:          decimal.NewFromFloat(1.5),
+			limit:          decimal.NewFromFloat(2500),
+			expectConsumed: decimal.NewFromFloat(1),
+			expectMatched:  decimal.NewFromFloat(3000),
+			expectRest:     decimal.NewFromFloat(0.5),
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Logf("testcase: %v", tc.name)
+		consumed, matched := MatchUntilSatisfied(tc.inputSide, WithinLimit(tc.inputSide, tc.orders, tc.limit), tc.input)
+		rest := tc.input.Sub(consumed)
+		r.Truef(tc.expectConsumed.Equals(consumed), "expect consumed %v, got %v", tc.expectConsumed, consumed)
+		r.Truef(tc.expectMatched.Equals(matched), "expect matched %v, got %v", tc.expectMatched, matched)
+		r.Truef(tc.expectRest.Equals(rest), "expect rest %v, got %v", tc.expectRest, rest)
+	}
+}
+
+func TestLimitFromSlippage(t *testing.T) {
+	r := require.New(t)
+	reference := decimal.NewFromFloat(4000)
+	r.True(decimal.NewFromFloat(4040).Equals(LimitFromSlippage("bid", reference, decimal.NewFromFloat(100))))
+	r.True(decimal.NewFromFloat(3960).Equals(LimitFromSlippage("ask", reference, decimal.NewFromFloat(100))))
+
+	book := Book{
+		Bids: []Order{{Price: decimal.NewFromFloat(3000), Size: decimal.NewFromFloat(1)}},
+		Asks: []Order{{Price: decimal.NewFromFloat(4000), Size: decimal.NewFromFloat(1)}},
+	}
+	mid, err := book.MidPrice()
+	r.NoError(err)
+	r.True(decimal.NewFromFloat(3500).Equals(mid))
+
+	_, err = Book{}.MidPrice()
+	r.Error(err)
+}
@@ -0,0 +1,168 @@
+package order
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+// propertyRuns is number of random books each property is checked against
+const propertyRuns = 500
+
+// roundingTolerance covers rounding of "bid" matched base to DivisionPrecision places,
+// which may exceed exact base by half of the last place, multiplied by price
+var roundingTolerance = decimal.New(1, -10)
+
+// randomBook generates valid book of up to levels levels each side,
+// prices are at cent increment and sizes at satoshi increment, bids are strictly below asks
+func randomBook(rng *rand.Rand, levels int) Book {
+	mid := int64(rng.Intn(10000000) + 1000)
+	book := Book{Sequence: Sequence(rng.Int63())}
+
+	bid := mid - int64(rng.Intn(100))
+	ask := mid + 1 + int64(rng.Intn(100))
+	for i := rng.Intn(levels + 1); i > 0 && bid > 0; i-- {
+		book.Bids = append(book.Bids, randomLevel(rng, bid))
+		bid -= int64(rng.Intn(50) + 1)
+	}
+	for i := rng.Intn(levels + 1); i > 0; i-- {
+		book.Asks = append(book.Asks, randomLevel(rng, ask))
+		ask += int64(rng.Intn(50) + 1)
+	}
+	return book
+}
+
+func randomLevel(rng *rand.Rand, cents int64) Order {
+	return Order{
+		Price:     decimal.New(cents, -2),
+		Size:      decimal.New(rng.Int63n(1000000000)+1, -8),
+		NumOrders: int64(rng.Intn(10) + 1),
+	}
+}
+
+// randomAmount generates input amount of side at satoshi increment,
+// up to a bit more than total input orders can take
+func randomAmount(rng *rand.Rand, side string, ods []Order) decimal.Decimal {
+	total := decimal.Zero
+	for _, od := range ods {
+		if side == "bid" {
+			total = total.Add(od.Volume())
+		} else {
+			total = total.Add(od.Size)
+		}
+	}
+	ratio := decimal.New(rng.Int63n(1200000)+1, -6)
+	return total.Mul(ratio).Add(decimal.New(rng.Int63n(100), -8)).Truncate(8)
+}
+
+func TestRandomBookIsValid(t *testing.T) {
+	r := require.New(t)
+	for seed := int64(0); seed < propertyRuns; seed++ {
+		book := randomBook(rand.New(rand.NewSource(seed)), 20)
+		r.NoError(book.Validate(), "seed %v", seed)
+
+		sorted, err := NewSortedBookFrom(book)
+		r.NoError(err, "seed %v", seed)
+		snapshot := sorted.Snapshot(0)
+		r.Equal(prices(book.Bids), prices(snapshot.Bids), "seed %v", seed)
+		r.Equal(prices(book.Asks), prices(snapshot.Asks), "seed %v", seed)
+	}
+}
+
+func TestMatchConsumedWithinAmount(t *testing.T) {
+	r := require.New(t)
+	for seed := int64(0); seed < propertyRuns; seed++ {
+		rng := rand.New(rand.NewSource(seed))
+		book := randomBook(rng, 20)
+		for _, side := range []string{"bid", "ask"} {
+			ods := book.Asks
+			if side == "ask" {
+				ods = book.Bids
+			}
+			amount := randomAmount(rng, side, ods)
+			consumed, matched := MatchUntilSatisfied(side, ods, amount)
+			r.True(consumed.LessThanOrEqual(amount), "seed %v %v: consumed %v of %v", seed, side, consumed, amount)
+			r.False(consumed.IsNegative(), "seed %v %v", seed, side)
+			r.False(matched.IsNegative(), "seed %v %v", seed, side)
+		}
+	}
+}
+
+func TestMatchMonotonicInAmount(t *testing.T) {
+	r := require.New(t)
+	for seed := int64(0); seed < propertyRuns; seed++ {
+		rng := rand.New(rand.NewSource(seed))
+		book := randomBook(rng, 20)
+		for _, side := range []string{"bid", "ask"} {
+			ods := book.Asks
+			if side == "ask" {
+				ods = book.Bids
+			}
+			smaller, larger := randomAmount(rng, side, ods), randomAmount(rng, side, ods)
+			if smaller.GreaterThan(larger) {
+				smaller, larger = larger, smaller
+			}
+			smallConsumed, smallMatched := MatchUntilSatisfied(side, ods, smaller)
+			largeConsumed, largeMatched := MatchUntilSatisfied(side, ods, larger)
+			r.True(smallConsumed.LessThanOrEqual(largeConsumed), "seed %v %v: consumed %v > %v", seed, side, smallConsumed, largeConsumed)
+			r.True(smallMatched.LessThanOrEqual(largeMatched), "seed %v %v: matched %v > %v", seed, side, smallMatched, largeMatched)
+
+			// ladder matches every amount the same way
+			rungs := MatchLadder(side, ods, []decimal.Decimal{larger, smaller})
+			r.True(largeConsumed.Equal(rungs[0].Consumed), "seed %v %v", seed, side)
+			r.True(largeMatched.Equal(rungs[0].Matched), "seed %v %v", seed, side)
+			r.True(smallConsumed.Equal(rungs[1].Consumed), "seed %v %v", seed, side)
+			r.True(smallMatched.Equal(rungs[1].Matched), "seed %v %v", seed, side)
+		}
+	}
+}
+
+func TestMatchRoundTripNeverGains(t *testing.T) {
+	r := require.New(t)
+	for seed := int64(0); seed < propertyRuns; seed++ {
+		rng := rand.New(rand.NewSource(seed))
+		book := randomBook(rng, 20)
+
+		// buy base with quote, then sell all bought base
+		quote := randomAmount(rng, "bid", book.Asks)
+		spent, bought := MatchUntilSatisfied("bid", book.Asks, quote)
+		_, received := MatchUntilSatisfied("ask", book.Bids, bought)
+		r.True(received.LessThanOrEqual(spent.Add(roundingTolerance)), "seed %v: spent %v quote and received %v", seed, spent, received)
+
+		// sell base for quote, then buy back with all received quote
+		base := randomAmount(rng, "ask", book.Bids)
+		sold, proceeds := MatchUntilSatisfied("ask", book.Bids, base)
+		_, rebought := MatchUntilSatisfied("bid", book.Asks, proceeds)
+		r.True(rebought.LessThanOrEqual(sold.Add(roundingTolerance)), "seed %v: sold %v base and bought back %v", seed, sold, rebought)
+	}
+}
+
+func TestMatchFixedAgreesWithDecimal(t *testing.T) {
+	r := require.New(t)
+	scale := Scale{Price: 2, Size: 8}
+	// base matched by MatchFixed on partial level is floored to size places
+	sizeIncrement := decimal.New(1, -8)
+	for seed := int64(0); seed < propertyRuns; seed++ {
+		rng := rand.New(rand.NewSource(seed))
+		book := randomBook(rng, 20)
+		fixed, err := NewFixedBook(book, scale)
+		r.NoError(err, "seed %v", seed)
+
+		amount := randomAmount(rng, "ask", book.Bids)
+		consumed, matched := MatchUntilSatisfied("ask", book.Bids, amount)
+		fixedConsumed, fixedMatched, err := QuoteFixed("ask", fixed.Bids, scale, amount)
+		r.NoError(err, "seed %v", seed)
+		r.True(consumed.Equal(fixedConsumed), "seed %v: consumed %v != %v", seed, consumed, fixedConsumed)
+		r.True(matched.Equal(fixedMatched), "seed %v: matched %v != %v", seed, matched, fixedMatched)
+
+		amount = randomAmount(rng, "bid", book.Asks)
+		consumed, matched = MatchUntilSatisfied("bid", book.Asks, amount)
+		fixedConsumed, fixedMatched, err = QuoteFixed("bid", fixed.Asks, scale, amount)
+		r.NoError(err, "seed %v", seed)
+		r.True(consumed.Equal(fixedConsumed), "seed %v: consumed %v != %v", seed, consumed, fixedConsumed)
+		r.True(fixedMatched.LessThanOrEqual(matched), "seed %v: matched %v > %v", seed, fixedMatched, matched)
+		r.True(matched.Sub(fixedMatched).LessThan(sizeIncrement), "seed %v: matched %v, fixed %v", seed, matched, fixedMatched)
+	}
+}
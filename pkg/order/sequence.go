@@ -0,0 +1,104 @@
+package order
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"emperror.dev/errors"
+)
+
+// Sequence is exchange sequence number of book or feed message,
+// zero denotes unknown sequence e.g. book restored from storage without one
+type Sequence uint64
+
+// ParseSequence parses decimal integer sequence exactly,
+// empty string is parsed as zero
+func ParseSequence(s string) (Sequence, error) {
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "malformed sequence [%v]", s)
+	}
+	return Sequence(n), nil
+}
+
+// String returns sequence in decimal
+func (s Sequence) String() string {
+	return strconv.FormatUint(uint64(s), 10)
+}
+
+// IsZero reports whether sequence is unknown
+func (s Sequence) IsZero() bool {
+	return s == 0
+}
+
+// Compare returns -1, 0 or +1 when s is before, equal to or after other
+func (s Sequence) Compare(other Sequence) int {
+	switch {
+	case s < other:
+		return -1
+	case s > other:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Before reports whether s is older than other
+func (s Sequence) Before(other Sequence) bool {
+	return s < other
+}
+
+// After reports whether s is newer than other
+func (s Sequence) After(other Sequence) bool {
+	return s > other
+}
+
+// Next returns sequence directly following s
+func (s Sequence) Next() Sequence {
+	return s + 1
+}
+
+// Follows reports whether s directly follows prev without gap
+func (s Sequence) Follows(prev Sequence) bool {
+	return prev < s && s-prev == 1
+}
+
+// Missing returns number of sequences skipped between prev and s,
+// it is zero when s directly follows prev or is not newer than prev
+func (s Sequence) Missing(prev Sequence) uint64 {
+	if s <= prev {
+		return 0
+	}
+	return uint64(s-prev) - 1
+}
+
+// MarshalJSON encodes sequence as string, so that consumers decoding
+// JSON numbers into float64 do not lose precision
+func (s Sequence) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(s.String())), nil
+}
+
+// UnmarshalJSON decodes sequence from either JSON number or string
+// of decimal integer, null and empty string are decoded as zero
+func (s *Sequence) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		*s = 0
+		return nil
+	}
+	if len(data) >= 2 && data[0] == '"' && data[len(data)-1] == '"' {
+		data = data[1 : len(data)-1]
+	} else if len(data) == 0 || data[0] == '"' {
+		return errors.Wrap(fmt.Errorf("unexpected sequence %s", data), "malformed sequence")
+	}
+	seq, err := ParseSequence(string(data))
+	if err != nil {
+		return err
+	}
+	*s = seq
+	return nil
+}
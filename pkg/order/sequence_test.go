@@ -0,0 +1,78 @@
+package order
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSequenceJSON(t *testing.T) {
+	r := require.New(t)
+
+	testcases := []struct {
+		raw      string
+		expected Sequence
+	}{
+		{raw: `7371656227`, expected: 7371656227},
+		{raw: `"7371656227"`, expected: 7371656227},
+		// float64 would round both to 9007199254740992
+		{raw: `9007199254740993`, expected: 9007199254740993},
+		{raw: `"18446744073709551615"`, expected: math.MaxUint64},
+		{raw: `null`, expected: 0},
+		{raw: `""`, expected: 0},
+	}
+	for _, tc := range testcases {
+		seq := Sequence(1)
+		r.NoError(json.Unmarshal([]byte(tc.raw), &seq), tc.raw)
+		r.Equal(tc.expected, seq, tc.raw)
+	}
+
+	for _, raw := range []string{`-1`, `1.5`, `1e3`, `"abc"`, `"1`, `18446744073709551616`, `true`} {
+		seq := Sequence(0)
+		r.Error(json.Unmarshal([]byte(raw), &seq), raw)
+	}
+
+	book := Book{Sequence: 9007199254740993}
+	raw, err := json.Marshal(book)
+	r.NoError(err)
+	r.Contains(string(raw), `"sequence":"9007199254740993"`)
+	decoded := Book{}
+	r.NoError(json.Unmarshal(raw, &decoded))
+	r.Equal(book.Sequence, decoded.Sequence)
+}
+
+func TestSequenceOrdering(t *testing.T) {
+	r := require.New(t)
+	prev := Sequence(100)
+
+	r.Equal(-1, prev.Compare(101))
+	r.Equal(0, prev.Compare(100))
+	r.Equal(1, prev.Compare(99))
+	r.True(prev.Before(101))
+	r.False(prev.Before(100))
+	r.True(prev.After(99))
+	r.Equal(Sequence(101), prev.Next())
+
+	r.True(Sequence(101).Follows(prev))
+	r.False(Sequence(100).Follows(prev), "duplicate")
+	r.False(Sequence(103).Follows(prev), "gap")
+	r.False(Sequence(99).Follows(prev), "stale")
+	r.False(Sequence(0).Follows(math.MaxUint64))
+
+	r.Zero(Sequence(101).Missing(prev))
+	r.Equal(uint64(2), Sequence(103).Missing(prev))
+	r.Zero(Sequence(100).Missing(prev))
+	r.Zero(Sequence(50).Missing(prev))
+	r.Equal(uint64(math.MaxUint64-1), Sequence(math.MaxUint64).Missing(0))
+
+	seq, err := ParseSequence("12345678901234567890")
+	r.NoError(err)
+	r.Equal("12345678901234567890", seq.String())
+	seq, err = ParseSequence("")
+	r.NoError(err)
+	r.True(seq.IsZero())
+	_, err = ParseSequence("1e3")
+	r.Error(err)
+}
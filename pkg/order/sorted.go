@@ -0,0 +1,501 @@
+package order
+
+import (
+	"fmt"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/shopspring/decimal"
+)
+
+// ErrCrossedBook is returned by Validate when best bid is higher than best ask
+var ErrCrossedBook = errors.NewPlain("crossed book")
+
+// SortedBook is order book kept sorted between incremental updates of streaming feeds.
+// price levels of each side are held in treap, so that insert, update and delete by price
+// are O(log n), and level 3 orders are indexed by order id on top of their levels.
+// each level holds either level 2 size or level 3 orders, never both
+type SortedBook struct {
+	Sequence  Sequence
+	UpdatedAt time.Time
+
+	bids   *bookSide
+	asks   *bookSide
+	orders map[string]*bookOrder
+}
+
+// priceLevel is treap node of single price, in-order traversal yields levels
+// from the best price, orders are linked in arrival order when level is level 3
+type priceLevel struct {
+	price     decimal.Decimal
+	size      decimal.Decimal
+	numOrders int64
+
+	head, tail *bookOrder
+
+	priority    uint64
+	left, right *priceLevel
+}
+
+// bookOrder is level 3 order linked into its price level
+type bookOrder struct {
+	id         string
+	side       string
+	size       decimal.Decimal
+	level      *priceLevel
+	prev, next *bookOrder
+}
+
+// bookSide is treap of price levels of one side, with best level cached
+type bookSide struct {
+	name string
+	// descending orders levels from the highest price as bids are
+	descending bool
+	root       *priceLevel
+	best       *priceLevel
+	count      int
+	seed       uint64
+}
+
+// NewSortedBook returns empty book
+func NewSortedBook() *SortedBook {
+	return &SortedBook{
+		bids:   &bookSide{name: "bid", descending: true, seed: 0x9e3779b97f4a7c15},
+		asks:   &bookSide{name: "ask", seed: 0xbf58476d1ce4e5b9},
+		orders: map[string]*bookOrder{},
+	}
+}
+
+// NewSortedBookFrom loads snapshot of book, orders with order id are loaded as level 3 orders
+// and the others as level 2 levels, so that both REST responses can be loaded as they are
+func NewSortedBookFrom(book Book) (*SortedBook, error) {
+	sb := NewSortedBook()
+	sb.Sequence, sb.UpdatedAt = book.Sequence, book.UpdatedAt
+	for side, ods := range map[string][]Order{"bid": book.Bids, "ask": book.Asks} {
+		for _, od := range ods {
+			var err error
+			if od.OrderID != "" {
+				err = sb.AddOrder(side, od.OrderID, od.Price, od.Size)
+			} else {
+				err = sb.SetLevel(side, od.Price, od.Size, od.NumOrders)
+			}
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to load snapshot")
+			}
+		}
+	}
+	return sb, nil
+}
+
+func (b *SortedBook) side(side string) (*bookSide, error) {
+	switch side {
+	case "bid":
+		return b.bids, nil
+	case "ask":
+		return b.asks, nil
+	default:
+		return nil, errors.Wrapf(fmt.Errorf("unexpected side, need [bid|ask] got [%v]", side), "unrecognized side")
+	}
+}
+
+// SetLevel sets size and number of orders of level 2 price level, zero size removes level
+func (b *SortedBook) SetLevel(side string, price, size decimal.Decimal, numOrders int64) error {
+	s, err := b.side(side)
+	if err != nil {
+		return err
+	}
+	if !price.IsPositive() || size.IsNegative() {
+		return errors.Wrapf(fmt.Errorf("level %v at %v", size, price), "need positive price and non-negative size")
+	}
+	lvl := s.find(price)
+	if lvl != nil && lvl.head != nil {
+		return errors.Wrapf(fmt.Errorf("%v level %v holds level 3 orders", side, price), "can not set level")
+	}
+	switch {
+	case size.IsZero() && lvl != nil:
+		s.remove(price)
+	case size.IsZero():
+	case lvl != nil:
+		lvl.size, lvl.numOrders = size, numOrders
+	default:
+		s.insert(&priceLevel{price: price, size: size, numOrders: numOrders})
+	}
+	return nil
+}
+
+// RemoveLevel removes price level along with its level 3 orders, and reports whether it existed
+func (b *SortedBook) RemoveLevel(side string, price decimal.Decimal) bool {
+	s, err := b.side(side)
+	if err != nil {
+		return false
+	}
+	lvl := s.find(price)
+	if lvl == nil {
+		return false
+	}
+	for o := lvl.head; o != nil; o = o.next {
+		delete(b.orders, o.id)
+	}
+	s.remove(price)
+	return true
+}
+
+// Level returns aggregated price level of side
+func (b *SortedBook) Level(side string, price decimal.Decimal) (Order, bool) {
+	s, err := b.side(side)
+	if err != nil {
+		return Order{}, false
+	}
+	lvl := s.find(price)
+	if lvl == nil {
+		return Order{}, false
+	}
+	return lvl.order(), true
+}
+
+// AddOrder adds level 3 order to the back of its price level
+func (b *SortedBook) AddOrder(side, id string, price, size decimal.Decimal) error {
+	s, err := b.side(side)
+	if err != nil {
+		return err
+	}
+	if id == "" || !price.IsPositive() || !size.IsPositive() {
+		return errors.Wrapf(fmt.Errorf("order [%v] %v at %v", id, size, price), "need order id, positive price and positive size")
+	}
+	if _, ok := b.orders[id]; ok {
+		return errors.Wrapf(fmt.Errorf("order [%v] already exists", id), "can not add order")
+	}
+	lvl := s.find(price)
+	if lvl == nil {
+		lvl = &priceLevel{price: price, size: decimal.Zero}
+		s.insert(lvl)
+	} else if lvl.head == nil {
+		return errors.Wrapf(fmt.Errorf("%v level %v is level 2", side, price), "can not add order")
+	}
+
+	o := &bookOrder{id: id, side: side, size: size, level: lvl, prev: lvl.tail}
+	if lvl.tail != nil {
+		lvl.tail.next = o
+	} else {
+		lvl.head = o
+	}
+	lvl.tail = o
+	lvl.size = lvl.size.Add(size)
+	lvl.numOrders++
+	b.orders[id] = o
+	return nil
+}
+
+// ChangeOrder sets remaining size of level 3 order, keeping its place in queue,
+// zero size removes order
+func (b *SortedBook) ChangeOrder(id string, size decimal.Decimal) error {
+	o, ok := b.orders[id]
+	if !ok {
+		return errors.Wrapf(fmt.Errorf("order [%v] does not exist", id), "can not change order")
+	}
+	if size.IsNegative() {
+		return errors.Wrapf(fmt.Errorf("order [%v] size %v", id, size), "need non-negative size")
+	}
+	if size.IsZero() {
+		b.RemoveOrder(id)
+		return nil
+	}
+	o.level.size = o.level.size.Sub(o.size).Add(size)
+	o.size = size
+	return nil
+}
+
+// RemoveOrder removes level 3 order, and its price level when it was the last order.
+// reports whether order existed
+func (b *SortedBook) RemoveOrder(id string) bool {
+	o, ok := b.orders[id]
+	if !ok {
+		return false
+	}
+	delete(b.orders, id)
+	lvl := o.level
+	if o.prev != nil {
+		o.prev.next = o.next
+	} else {
+		lvl.head = o.next
+	}
+	if o.next != nil {
+		o.next.prev = o.prev
+	} else {
+		lvl.tail = o.prev
+	}
+	lvl.size = lvl.size.Sub(o.size)
+	lvl.numOrders--
+	if lvl.head == nil {
+		s, _ := b.side(o.side)
+		s.remove(lvl.price)
+	}
+	return true
+}
+
+// Order returns level 3 order by id
+func (b *SortedBook) Order(id string) (Order, bool) {
+	o, ok := b.orders[id]
+	if !ok {
+		return Order{}, false
+	}
+	return Order{OrderID: o.id, Price: o.level.price, Size: o.size}, true
+}
+
+// Best returns best price level of side in O(1)
+func (b *SortedBook) Best(side string) (Order, bool) {
+	s, err := b.side(side)
+	if err != nil || s.best == nil {
+		return Order{}, false
+	}
+	return s.best.order(), true
+}
+
+// Len returns number of price levels of side
+func (b *SortedBook) Len(side string) int {
+	s, err := b.side(side)
+	if err != nil {
+		return 0
+	}
+	return s.count
+}
+
+// Orders exports aggregated price levels of side from the best price, as sorted orders
+// expected by MatchUntilSatisfied, depth of zero or less exports every level
+func (b *SortedBook) Orders(side string, depth int) []Order {
+	s, err := b.side(side)
+	if err != nil {
+		return nil
+	}
+	n := s.count
+	if depth > 0 && depth < n {
+		n = depth
+	}
+	ods := make([]Order, 0, n)
+	s.walk(func(lvl *priceLevel) bool {
+		ods = append(ods, lvl.order())
+		return len(ods) < n
+	})
+	return ods
+}
+
+// Snapshot exports book of aggregated price levels, depth of zero or less exports every level
+func (b *SortedBook) Snapshot(depth int) Book {
+	return Book{
+		Sequence:  b.Sequence,
+		Bids:      b.Orders("bid", depth),
+		Asks:      b.Orders("ask", depth),
+		UpdatedAt: b.UpdatedAt,
+	}
+}
+
+// Validate checks invariants of book: levels of each side are sorted from the best price
+// without duplicates, treap and cached best level are consistent, sizes of levels
+// match their level 3 orders, and best bid is not higher than best ask
+func (b *SortedBook) Validate() error {
+	indexed := 0
+	for _, s := range []*bookSide{b.bids, b.asks} {
+		count := 0
+		var prev *priceLevel
+		var err error
+		s.walk(func(lvl *priceLevel) bool {
+			if prev != nil && !s.better(prev.price, lvl.price) {
+				err = fmt.Errorf("%v level %v is not after %v", s.name, lvl.price, prev.price)
+				return false
+			}
+			if lvl.left != nil && lvl.left.priority > lvl.priority || lvl.right != nil && lvl.right.priority > lvl.priority {
+				err = fmt.Errorf("%v level %v violates heap order", s.name, lvl.price)
+				return false
+			}
+			orders := 0
+			if orders, err = b.validateLevel(s, lvl); err != nil {
+				return false
+			}
+			indexed += orders
+			prev = lvl
+			count++
+			return true
+		})
+		if err != nil {
+			return errors.Wrap(err, "unsorted book")
+		}
+		if count != s.count {
+			return errors.Wrapf(fmt.Errorf("%v side holds %v levels, counted %v", s.name, count, s.count), "inconsistent book")
+		}
+		if s.best != s.leftmost() {
+			return errors.Wrapf(fmt.Errorf("cached best %v level is not the best level", s.name), "inconsistent book")
+		}
+	}
+	if indexed != len(b.orders) {
+		return errors.Wrapf(fmt.Errorf("%v orders in levels, %v indexed", indexed, len(b.orders)), "inconsistent book")
+	}
+
+	if b.bids.best != nil && b.asks.best != nil && b.bids.best.price.GreaterThan(b.asks.best.price) {
+		return errors.Wrapf(ErrCrossedBook, "best bid %v is higher than best ask %v", b.bids.best.price, b.asks.best.price)
+	}
+	return nil
+}
+
+// validateLevel checks price level and its level 3 orders, and returns number of level 3 orders
+func (b *SortedBook) validateLevel(s *bookSide, lvl *priceLevel) (int, error) {
+	if !lvl.price.IsPositive() || !lvl.size.IsPositive() {
+		return 0, fmt.Errorf("%v level %v at %v is not positive", s.name, lvl.size, lvl.price)
+	}
+	if lvl.head == nil {
+		return 0, nil
+	}
+	size, count := decimal.Zero, 0
+	for o := lvl.head; o != nil; o = o.next {
+		if b.orders[o.id] != o || o.level != lvl || o.side != s.name {
+			return 0, fmt.Errorf("%v order [%v] at %v is not indexed", s.name, o.id, lvl.price)
+		}
+		if o.next != nil && o.next.prev != o || o.next == nil && lvl.tail != o {
+			return 0, fmt.Errorf("%v orders at %v are not linked", s.name, lvl.price)
+		}
+		size = size.Add(o.size)
+		count++
+	}
+	if !size.Equal(lvl.size) || int64(count) != lvl.numOrders {
+		return 0, fmt.Errorf("%v level %v holds %v in %v orders, sum is %v in %v orders", s.name, lvl.price, lvl.size, lvl.numOrders, size, count)
+	}
+	return count, nil
+}
+
+func (lvl *priceLevel) order() Order {
+	return Order{Price: lvl.price, Size: lvl.size, NumOrders: lvl.numOrders}
+}
+
+// better reports whether price a comes before price b on side
+func (s *bookSide) better(a, b decimal.Decimal) bool {
+	if s.descending {
+		return a.GreaterThan(b)
+	}
+	return a.LessThan(b)
+}
+
+// random returns next priority of xorshift generator, owned by side
+// so that updates do not contend on global random source
+func (s *bookSide) random() uint64 {
+	s.seed ^= s.seed << 13
+	s.seed ^= s.seed >> 7
+	s.seed ^= s.seed << 17
+	return s.seed
+}
+
+func (s *bookSide) find(price decimal.Decimal) *priceLevel {
+	n := s.root
+	for n != nil {
+		switch cmp := price.Cmp(n.price); {
+		case cmp == 0:
+			return n
+		case s.better(price, n.price):
+			n = n.left
+		default:
+			n = n.right
+		}
+	}
+	return nil
+}
+
+func (s *bookSide) leftmost() *priceLevel {
+	n := s.root
+	for n != nil && n.left != nil {
+		n = n.left
+	}
+	return n
+}
+
+// insert adds level of price not in treap yet
+func (s *bookSide) insert(lvl *priceLevel) {
+	lvl.priority = s.random()
+	s.root = s.insertAt(s.root, lvl)
+	s.count++
+	if s.best == nil || s.better(lvl.price, s.best.price) {
+		s.best = lvl
+	}
+}
+
+func (s *bookSide) insertAt(n, lvl *priceLevel) *priceLevel {
+	if n == nil {
+		return lvl
+	}
+	if s.better(lvl.price, n.price) {
+		n.left = s.insertAt(n.left, lvl)
+		if n.left.priority > n.priority {
+			n = rotateRight(n)
+		}
+		return n
+	}
+	n.right = s.insertAt(n.right, lvl)
+	if n.right.priority > n.priority {
+		n = rotateLeft(n)
+	}
+	return n
+}
+
+// remove deletes level of price, which must be in treap
+func (s *bookSide) remove(price decimal.Decimal) {
+	s.root = s.removeAt(s.root, price)
+	s.count--
+	if s.best != nil && s.best.price.Equal(price) {
+		s.best = s.leftmost()
+	}
+}
+
+func (s *bookSide) removeAt(n *priceLevel, price decimal.Decimal) *priceLevel {
+	if n == nil {
+		return nil
+	}
+	if !price.Equal(n.price) {
+		if s.better(price, n.price) {
+			n.left = s.removeAt(n.left, price)
+		} else {
+			n.right = s.removeAt(n.right, price)
+		}
+		return n
+	}
+	// rotate level down until it has at most one child
+	switch {
+	case n.left == nil:
+		return n.right
+	case n.right == nil:
+		return n.left
+	case n.left.priority > n.right.priority:
+		n = rotateRight(n)
+		n.right = s.removeAt(n.right, price)
+	default:
+		n = rotateLeft(n)
+		n.left = s.removeAt(n.left, price)
+	}
+	return n
+}
+
+func rotateRight(n *priceLevel) *priceLevel {
+	l := n.left
+	n.left, l.right = l.right, n
+	return l
+}
+
+func rotateLeft(n *priceLevel) *priceLevel {
+	r := n.right
+	n.right, r.left = r.left, n
+	return r
+}
+
+// walk visits levels from the best price until visit returns false
+func (s *bookSide) walk(visit func(*priceLevel) bool) {
+	stack := []*priceLevel{}
+	n := s.root
+	for n != nil || len(stack) > 0 {
+		for n != nil {
+			stack = append(stack, n)
+			n = n.left
+		}
+		n = stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if !visit(n) {
+			return
+		}
+		n = n.right
+	}
+}
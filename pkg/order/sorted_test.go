@@ -0,0 +1,214 @@
+package order
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"emperror.dev/errors"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+func prices(ods []Order) []string {
+	ps := make([]string, len(ods))
+	for i, od := range ods {
+		ps[i] = od.Price.String()
+	}
+	return ps
+}
+
+func TestSortedBookLevel2(t *testing.T) {
+	r := require.New(t)
+	b := NewSortedBook()
+	for _, p := range []string{"170.90", "170.95", "170.5", "170.92"} {
+		r.NoError(b.SetLevel("bid", decimal.RequireFromString(p), decimal.New(1, 0), 1))
+	}
+	for _, p := range []string{"171.2", "170.97", "171"} {
+		r.NoError(b.SetLevel("ask", decimal.RequireFromString(p), decimal.New(2, 0), 2))
+	}
+	r.NoError(b.Validate())
+	r.Equal([]string{"170.95", "170.92", "170.9", "170.5"}, prices(b.Orders("bid", 0)))
+	r.Equal([]string{"170.97", "171"}, prices(b.Orders("ask", 2)))
+	r.Equal(4, b.Len("bid"))
+
+	best, ok := b.Best("bid")
+	r.True(ok)
+	r.Equal("170.95", best.Price.String())
+
+	// update in place, and remove best level
+	r.NoError(b.SetLevel("bid", decimal.RequireFromString("170.9"), decimal.New(5, 0), 3))
+	lvl, ok := b.Level("bid", decimal.RequireFromString("170.90"))
+	r.True(ok)
+	r.Equal(int64(3), lvl.NumOrders)
+	r.True(decimal.New(5, 0).Equal(lvl.Size))
+	r.NoError(b.SetLevel("bid", decimal.RequireFromString("170.95"), decimal.Zero, 0))
+	r.NoError(b.SetLevel("bid", decimal.RequireFromString("1"), decimal.Zero, 0), "removing missing level is no-op")
+	best, _ = b.Best("bid")
+	r.Equal("170.92", best.Price.String())
+	r.True(b.RemoveLevel("ask", decimal.RequireFromString("170.97")))
+	r.False(b.RemoveLevel("ask", decimal.RequireFromString("170.97")))
+	best, _ = b.Best("ask")
+	r.Equal("171", best.Price.String())
+	r.NoError(b.Validate())
+
+	r.Error(b.SetLevel("both", decimal.New(1, 0), decimal.New(1, 0), 1))
+	r.Error(b.SetLevel("bid", decimal.Zero, decimal.New(1, 0), 1))
+	r.Error(b.SetLevel("bid", decimal.New(1, 0), decimal.New(-1, 0), 1))
+
+	// bid above best ask crosses book
+	r.NoError(b.SetLevel("bid", decimal.RequireFromString("171.1"), decimal.New(1, 0), 1))
+	r.True(errors.Is(b.Validate(), ErrCrossedBook))
+}
+
+func TestSortedBookLevel3(t *testing.T) {
+	r := require.New(t)
+	b, err := NewSortedBookFrom(Book{
+		Sequence: 10,
+		Bids: []Order{
+			{OrderID: "a", Price: decimal.RequireFromString("100"), Size: decimal.RequireFromString("1")},
+			{OrderID: "b", Price: decimal.RequireFromString("100"), Size: decimal.RequireFromString("2")},
+			{OrderID: "c", Price: decimal.RequireFromString("99"), Size: decimal.RequireFromString("3")},
+		},
+		Asks: []Order{
+			{OrderID: "d", Price: decimal.RequireFromString("101"), Size: decimal.RequireFromString("4")},
+		},
+	})
+	r.NoError(err)
+	r.NoError(b.Validate())
+	r.Equal(Sequence(10), b.Sequence)
+
+	snapshot := b.Snapshot(0)
+	r.Len(snapshot.Bids, 2)
+	r.True(decimal.RequireFromString("3").Equal(snapshot.Bids[0].Size))
+	r.Equal(int64(2), snapshot.Bids[0].NumOrders)
+
+	r.Error(b.AddOrder("bid", "a", decimal.RequireFromString("98"), decimal.New(1, 0)), "duplicate order id")
+	r.Error(b.SetLevel("bid", decimal.RequireFromString("100"), decimal.New(1, 0), 1), "level 3 level can not be set")
+	r.NoError(b.SetLevel("bid", decimal.RequireFromString("98"), decimal.New(1, 0), 1))
+	r.Error(b.AddOrder("bid", "e", decimal.RequireFromString("98"), decimal.New(1, 0)), "level 2 level can not hold orders")
+
+	r.NoError(b.ChangeOrder("a", decimal.RequireFromString("0.5")))
+	lvl, _ := b.Level("bid", decimal.RequireFromString("100"))
+	r.True(decimal.RequireFromString("2.5").Equal(lvl.Size))
+	od, ok := b.Order("a")
+	r.True(ok)
+	r.True(decimal.RequireFromString("0.5").Equal(od.Size))
+
+	r.True(b.RemoveOrder("a"))
+	r.False(b.RemoveOrder("a"))
+	r.NoError(b.ChangeOrder("b", decimal.Zero))
+	_, ok = b.Level("bid", decimal.RequireFromString("100"))
+	r.False(ok, "level is removed along with its last order")
+	best, _ := b.Best("bid")
+	r.Equal("99", best.Price.String())
+	r.Error(b.ChangeOrder("b", decimal.New(1, 0)))
+
+	r.True(b.RemoveLevel("bid", decimal.RequireFromString("99")))
+	_, ok = b.Order("c")
+	r.False(ok, "orders are removed along with their level")
+	r.NoError(b.Validate())
+}
+
+// reference is naive book of level 2 sizes by price
+type reference map[string]decimal.Decimal
+
+// orders returns prices of reference sorted from the best price
+func (ref reference) orders(descending bool) []string {
+	keys := make([]decimal.Decimal, 0, len(ref))
+	for p := range ref {
+		keys = append(keys, decimal.RequireFromString(p))
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if descending {
+			return keys[i].GreaterThan(keys[j])
+		}
+		return keys[i].LessThan(keys[j])
+	})
+	out := make([]string, len(keys))
+	for i, k := range keys {
+		out[i] = k.String()
+	}
+	return out
+}
+
+func TestSortedBookRandomized(t *testing.T) {
+	r := require.New(t)
+	rng := rand.New(rand.NewSource(45))
+	b := NewSortedBook()
+	refs := map[string]reference{"bid": {}, "ask": {}}
+
+	for i := 0; i < 5000; i++ {
+		side := "bid"
+		// keep book uncrossed, bids below 100 and asks above
+		price := decimal.New(int64(rng.Intn(200)+1), -2).Add(decimal.New(98, 0))
+		if rng.Intn(2) == 0 {
+			side = "ask"
+			price = price.Add(decimal.New(3, 0))
+		}
+		size := decimal.New(int64(rng.Intn(4)), 0)
+		r.NoError(b.SetLevel(side, price, size, 1))
+		if size.IsZero() {
+			delete(refs[side], price.String())
+		} else {
+			refs[side][price.String()] = size
+		}
+
+		if i%100 == 0 {
+			r.NoError(b.Validate(), "after %v updates", i)
+		}
+	}
+	r.NoError(b.Validate())
+	r.Equal(refs["bid"].orders(true), prices(b.Orders("bid", 0)))
+	r.Equal(refs["ask"].orders(false), prices(b.Orders("ask", 0)))
+	r.Equal(len(refs["bid"]), b.Len("bid"))
+}
+
+func TestSortedBookMatchesSnapshot(t *testing.T) {
+	r := require.New(t)
+	book := Book{
+		Bids: []Order{
+			{Price: decimal.RequireFromString("170.95"), Size: decimal.RequireFromString("3"), NumOrders: 1},
+			{Price: decimal.RequireFromString("170.90"), Size: decimal.RequireFromString("5"), NumOrders: 2},
+		},
+		Asks: []Order{
+			{Price: decimal.RequireFromString("170.97"), Size: decimal.RequireFromString("2"), NumOrders: 3},
+			{Price: decimal.RequireFromString("171.00"), Size: decimal.RequireFromString("10"), NumOrders: 1},
+		},
+	}
+	b, err := NewSortedBookFrom(book)
+	r.NoError(err)
+	snapshot := b.Snapshot(0)
+	for _, amount := range []string{"1", "4", "1000"} {
+		expectConsumed, expectMatched := MatchUntilSatisfied("bid", book.Asks, decimal.RequireFromString(amount))
+		consumed, matched := MatchUntilSatisfied("bid", snapshot.Asks, decimal.RequireFromString(amount))
+		r.True(expectConsumed.Equal(consumed))
+		r.True(expectMatched.Equal(matched))
+	}
+}
+
+func BenchmarkSortedBookSetLevel(b *testing.B) {
+	book := NewSortedBook()
+	for i := 0; i < 10000; i++ {
+		if err := book.SetLevel("ask", decimal.New(int64(900000+2*i), -2), decimal.New(1, 0), 1); err != nil {
+			b.Fatal(err)
+		}
+	}
+	rng := rand.New(rand.NewSource(1))
+	updates := make([]decimal.Decimal, 1024)
+	for i := range updates {
+		updates[i] = decimal.New(int64(900000+rng.Intn(20000)), -2)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// half of updates insert or remove level, the others update size
+		if err := book.SetLevel("ask", updates[i%len(updates)], decimal.New(int64(i%2), 0), 1); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+	if err := book.Validate(); err != nil {
+		b.Fatal(err)
+	}
+}
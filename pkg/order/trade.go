@@ -0,0 +1,29 @@
+package order
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Trade holds information of single executed trade
+// Side denotes side of maker order, as reported by exchange
+type Trade struct {
+	TradeID int64           `json:"trade_id"`
+	Pair    string          `json:"pair"`
+	Price   decimal.Decimal `json:"price"`
+	Size    decimal.Decimal `json:"size"`
+	Side    string          `json:"side"`
+	Time    time.Time       `json:"time"`
+}
+
+// Volume return price*size of trade
+func (t Trade) Volume() decimal.Decimal {
+	return t.Price.Mul(t.Size)
+}
+
+// TradeStreamer is implemented by engines that can stream executed trades
+// alongside order book
+type TradeStreamer interface {
+	OpenTradeStream(config map[string]string) <-chan Trade
+}
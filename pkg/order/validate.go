@@ -0,0 +1,134 @@
+package order
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// Problem classifies what is wrong with level or book
+type Problem string
+
+// problems found by Check
+const (
+	// ProblemUnsorted is level not after previous level of its side,
+	// bids must be from the highest and asks from the lowest price
+	ProblemUnsorted Problem = "unsorted"
+	// ProblemDuplicateLevel is aggregated level at the same price as previous level,
+	// level 3 orders at the same price are expected
+	ProblemDuplicateLevel   Problem = "duplicate_level"
+	ProblemNonPositivePrice Problem = "non_positive_price"
+	ProblemNonPositiveSize  Problem = "non_positive_size"
+	// ProblemCrossed is best bid above best ask
+	ProblemCrossed Problem = "crossed"
+	// ProblemLocked is best bid at best ask
+	ProblemLocked Problem = "locked"
+)
+
+// maxReportedIssues is number of issues written into error message
+const maxReportedIssues = 5
+
+// Issue is single problem of book, Level is index of level within Side,
+// crossed and locked issues are of best bid and have no side
+type Issue struct {
+	Problem Problem         `json:"problem"`
+	Side    string          `json:"side,omitempty"`
+	Level   int             `json:"level"`
+	Price   decimal.Decimal `json:"price"`
+	Size    decimal.Decimal `json:"size"`
+}
+
+func (i Issue) String() string {
+	if i.Side == "" {
+		return fmt.Sprintf("%v at best bid %v", i.Problem, i.Price)
+	}
+	return fmt.Sprintf("%v %v level %v of %v at %v", i.Problem, i.Side, i.Level, i.Size, i.Price)
+}
+
+// InvalidBookError holds every issue found in book
+type InvalidBookError struct {
+	Sequence Sequence
+	Issues   []Issue
+}
+
+func (e *InvalidBookError) Error() string {
+	issues := []string{}
+	for i, issue := range e.Issues {
+		if i == maxReportedIssues {
+			issues = append(issues, fmt.Sprintf("and %v more", len(e.Issues)-maxReportedIssues))
+			break
+		}
+		issues = append(issues, issue.String())
+	}
+	return fmt.Sprintf("invalid book at sequence %v: %v", e.Sequence, strings.Join(issues, ", "))
+}
+
+// Has reports whether any issue is of problem
+func (e *InvalidBookError) Has(problem Problem) bool {
+	for _, issue := range e.Issues {
+		if issue.Problem == problem {
+			return true
+		}
+	}
+	return false
+}
+
+// Check returns every issue of book, in order of bids, asks then best prices
+func (b Book) Check() []Issue {
+	issues := checkSide("bid", b.Bids, true)
+	issues = append(issues, checkSide("ask", b.Asks, false)...)
+	if len(b.Bids) == 0 || len(b.Asks) == 0 {
+		return issues
+	}
+	bid, ask := b.Bids[0], b.Asks[0]
+	switch bid.Price.Cmp(ask.Price) {
+	case 1:
+		issues = append(issues, Issue{Problem: ProblemCrossed, Price: bid.Price, Size: bid.Size})
+	case 0:
+		issues = append(issues, Issue{Problem: ProblemLocked, Price: bid.Price, Size: bid.Size})
+	}
+	return issues
+}
+
+// Validate returns *InvalidBookError when book has any issue
+// books should be validated before matching, since corrupted book is silently mismatched
+func (b Book) Validate() error {
+	issues := b.Check()
+	if len(issues) == 0 {
+		return nil
+	}
+	return &InvalidBookError{Sequence: b.Sequence, Issues: issues}
+}
+
+// checkSide checks levels of side, descending sides are sorted from the highest price
+func checkSide(side string, ods []Order, descending bool) []Issue {
+	issues := []Issue{}
+	for i, od := range ods {
+		issue := Issue{Side: side, Level: i, Price: od.Price, Size: od.Size}
+		if !od.Price.IsPositive() {
+			issue.Problem = ProblemNonPositivePrice
+			issues = append(issues, issue)
+		}
+		if !od.Size.IsPositive() {
+			issue.Problem = ProblemNonPositiveSize
+			issues = append(issues, issue)
+		}
+		if i == 0 {
+			continue
+		}
+		cmp := od.Price.Cmp(ods[i-1].Price)
+		if descending {
+			cmp = -cmp
+		}
+		switch {
+		case cmp < 0:
+			issue.Problem = ProblemUnsorted
+			issues = append(issues, issue)
+		case cmp == 0 && (od.OrderID == "" || ods[i-1].OrderID == ""):
+			issue.Problem = ProblemDuplicateLevel
+			issues = append(issues, issue)
+		}
+	}
+	return issues
+}
@@ -0,0 +1,103 @@
+package order
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+func level(price, size string) Order {
+	return Order{Price: decimal.RequireFromString(price), Size: decimal.RequireFromString(size), NumOrders: 1}
+}
+
+func problems(issues []Issue) []Problem {
+	ps := []Problem{}
+	for _, issue := range issues {
+		ps = append(ps, issue.Problem)
+	}
+	return ps
+}
+
+func TestBookCheck(t *testing.T) {
+	r := require.New(t)
+	testcases := []struct {
+		name     string
+		book     Book
+		expected []Problem
+	}{
+		{
+			name: "sane book",
+			book: Book{Bids: []Order{level("170.95", "3"), level("170.90", "5")}, Asks: []Order{level("170.97", "2"), level("171", "10")}},
+		},
+		{
+			name: "one sided book",
+			book: Book{Asks: []Order{level("170.97", "2")}},
+		},
+		{
+			name:     "unsorted bids and asks",
+			book:     Book{Bids: []Order{level("170.90", "5"), level("170.95", "3")}, Asks: []Order{level("171", "10"), level("170.97", "2")}},
+			expected: []Problem{ProblemUnsorted, ProblemUnsorted},
+		},
+		{
+			name:     "duplicate aggregated level",
+			book:     Book{Bids: []Order{level("170.95", "3"), level("170.950", "5")}},
+			expected: []Problem{ProblemDuplicateLevel},
+		},
+		{
+			name:     "zero and negative sizes",
+			book:     Book{Bids: []Order{level("170.95", "0"), level("170.90", "-1")}, Asks: []Order{level("0", "1")}},
+			expected: []Problem{ProblemNonPositiveSize, ProblemNonPositiveSize, ProblemNonPositivePrice, ProblemCrossed},
+		},
+		{
+			name:     "crossed",
+			book:     Book{Bids: []Order{level("171.5", "3")}, Asks: []Order{level("170.97", "2")}},
+			expected: []Problem{ProblemCrossed},
+		},
+		{
+			name:     "locked",
+			book:     Book{Bids: []Order{level("170.97", "3")}, Asks: []Order{level("170.970", "2")}},
+			expected: []Problem{ProblemLocked},
+		},
+	}
+	for _, tc := range testcases {
+		r.Equal(tc.expected, nonEmpty(problems(tc.book.Check())), tc.name)
+		if len(tc.expected) == 0 {
+			r.NoError(tc.book.Validate(), tc.name)
+		}
+	}
+
+	// level 3 orders share price
+	l3 := Book{Bids: []Order{
+		{OrderID: "a", Price: decimal.RequireFromString("100"), Size: decimal.RequireFromString("1")},
+		{OrderID: "b", Price: decimal.RequireFromString("100"), Size: decimal.RequireFromString("2")},
+	}}
+	r.NoError(l3.Validate())
+}
+
+// nonEmpty returns nil for empty problems, so that expectations can omit them
+func nonEmpty(ps []Problem) []Problem {
+	if len(ps) == 0 {
+		return nil
+	}
+	return ps
+}
+
+func TestBookValidate(t *testing.T) {
+	r := require.New(t)
+	book := Book{Sequence: 42, Bids: []Order{level("171.5", "3")}, Asks: []Order{level("170.97", "2")}}
+	for i := 0; i < 10; i++ {
+		book.Bids = append(book.Bids, level("172", "0"))
+	}
+
+	err := book.Validate()
+	r.Error(err)
+	invalid, ok := err.(*InvalidBookError)
+	r.True(ok)
+	r.Equal(Sequence(42), invalid.Sequence)
+	r.True(invalid.Has(ProblemCrossed))
+	r.False(invalid.Has(ProblemLocked))
+	r.Len(invalid.Issues, 21)
+	r.Contains(err.Error(), "invalid book at sequence 42: non_positive_size bid level 1 of 0 at 172, unsorted bid level 1 of 0 at 172")
+	r.Contains(err.Error(), "and 16 more")
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"strings"
+
+	"emperror.dev/errors"
+)
+
+// migration is single schema change, statements are written in
+// common SQL with {{type}} markers substituted per dialect
+type migration struct {
+	version    int
+	statements []string
+}
+
+var dialectTypes = map[string]*strings.Replacer{
+	DriverSQLite: strings.NewReplacer(
+		"{{id}}", "INTEGER PRIMARY KEY AUTOINCREMENT",
+		"{{timestamp}}", "TIMESTAMP",
+		"{{numeric}}", "TEXT",
+	),
+	DriverPostgres: strings.NewReplacer(
+		"{{id}}", "BIGSERIAL PRIMARY KEY",
+		"{{timestamp}}", "TIMESTAMPTZ",
+		"{{numeric}}", "NUMERIC",
+	),
+}
+
+// migrations must be append-only, applied version is recorded in schema_migrations
+var migrations = []migration{
+	{
+		version: 1,
+		statements: []string{
+			`CREATE TABLE book_levels (
+				id          {{id}},
+				engine      TEXT NOT NULL,
+				pair        TEXT NOT NULL,
+				sequence    BIGINT NOT NULL,
+				side        TEXT NOT NULL,
+				level       INTEGER NOT NULL,
+				price       {{numeric}} NOT NULL,
+				size        {{numeric}} NOT NULL,
+				num_orders  BIGINT NOT NULL DEFAULT 0,
+				order_id    TEXT NOT NULL DEFAULT '',
+				recorded_at {{timestamp}} NOT NULL
+			)`,
+			`CREATE INDEX book_levels_lookup_idx ON book_levels (engine, pair, sequence, recorded_at)`,
+			`CREATE TABLE quotes (
+				id           {{id}},
+				engine       TEXT NOT NULL,
+				pair         TEXT NOT NULL,
+				sequence     BIGINT NOT NULL,
+				input_asset  TEXT NOT NULL,
+				output_asset TEXT NOT NULL,
+				amount       {{numeric}} NOT NULL,
+				consumed     {{numeric}} NOT NULL,
+				matched      {{numeric}} NOT NULL,
+				recorded_at  {{timestamp}} NOT NULL
+			)`,
+			`CREATE INDEX quotes_lookup_idx ON quotes (engine, pair, sequence, recorded_at)`,
+		},
+	},
+	{
+		version: 2,
+		statements: []string{
+			`ALTER TABLE quotes ADD COLUMN job TEXT NOT NULL DEFAULT ''`,
+			`CREATE INDEX quotes_as_of_idx ON quotes (engine, pair, input_asset, amount, recorded_at)`,
+		},
+	},
+}
+
+// Migrate applies pending schema migrations, each version in its own transaction
+func (s *Store) Migrate() error {
+	_, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`)
+	if err != nil {
+		return errors.Wrap(err, "[storage] failed to create schema_migrations table")
+	}
+
+	current := 0
+	row := s.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`)
+	if err := row.Scan(&current); err != nil {
+		return errors.Wrap(err, "[storage] failed to read schema version")
+	}
+
+	replacer := dialectTypes[s.driver]
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		tx, err := s.db.Begin()
+		if err != nil {
+			return errors.Wrapf(err, "[storage] failed to begin migration %v", m.version)
+		}
+		for _, stmt := range m.statements {
+			if _, err := tx.Exec(replacer.Replace(stmt)); err != nil {
+				tx.Rollback()
+				return errors.Wrapf(err, "[storage] failed to apply migration %v", m.version)
+			}
+		}
+		if _, err := tx.Exec(s.rebind(`INSERT INTO schema_migrations (version) VALUES (?)`), m.version); err != nil {
+			tx.Rollback()
+			return errors.Wrapf(err, "[storage] failed to record migration %v", m.version)
+		}
+		if err := tx.Commit(); err != nil {
+			return errors.Wrapf(err, "[storage] failed to commit migration %v", m.version)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/choestelus/super-duper-succotash/pkg/order"
+	"github.com/shopspring/decimal"
+)
+
+// Supported database drivers, driver package itself must be imported
+// by caller, e.g. in main package, to keep this package free from cgo
+const (
+	DriverSQLite   = "sqlite3"
+	DriverPostgres = "postgres"
+)
+
+// Store wraps sql.DB along with dialect-specific details
+// of supported databases
+type Store struct {
+	db     *sql.DB
+	driver string
+}
+
+// Quote holds result of matching amount against order book
+// as reported in service mode, Job is name of job quoting amount
+type Quote struct {
+	Job         string          `json:"job"`
+	Engine      string          `json:"engine"`
+	Pair        string          `json:"pair"`
+	Sequence    order.Sequence  `json:"sequence"`
+	InputAsset  string          `json:"input_asset"`
+	OutputAsset string          `json:"output_asset"`
+	Amount      decimal.Decimal `json:"amount"`
+	Consumed    decimal.Decimal `json:"consumed"`
+	Matched     decimal.Decimal `json:"matched"`
+	RecordedAt  time.Time       `json:"recorded_at"`
+}
+
+// Open opens database connection with supplied driver and data source name
+// and verify that connection can be established.
+func Open(driver, dsn string) (*Store, error) {
+	switch driver {
+	case DriverSQLite, DriverPostgres:
+	default:
+		return nil, errors.Wrapf(fmt.Errorf("unsupported driver [%v]", driver), "[storage] need [%v|%v]", DriverSQLite, DriverPostgres)
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, errors.Wrapf(err, "[storage] failed to open %v database", driver)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, errors.Wrapf(err, "[storage] failed to connect to %v database", driver)
+	}
+	if driver == DriverSQLite {
+		// sqlite only allow single writer at a time
+		db.SetMaxOpenConns(1)
+	}
+	return &Store{db: db, driver: driver}, nil
+}
+
+// Close closes underlying database connection
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// rebind rewrites '?' placeholders into dialect-specific form
+func (s *Store) rebind(query string) string {
+	if s.driver != DriverPostgres {
+		return query
+	}
+	sb := strings.Builder{}
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			sb.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
+
+// QuoteAsOf returns latest quote recorded at or before supplied timestamp
+// for specified engine, pair, input asset and amount, of any job when job is empty.
+func (s *Store) QuoteAsOf(engine, pair, inputAsset string, amount decimal.Decimal, job string, at time.Time) (*Quote, error) {
+	query := s.rebind(`SELECT job, engine, pair, sequence, input_asset, output_asset, amount, consumed, matched, recorded_at
+		FROM quotes
+		WHERE engine = ? AND pair = ? AND input_asset = ? AND amount = ? AND (? = '' OR job = ?) AND recorded_at <= ?
+		ORDER BY recorded_at DESC, sequence DESC
+		LIMIT 1`)
+
+	q := Quote{}
+	seq := int64(0)
+	row := s.db.QueryRow(query, engine, pair, inputAsset, amount.String(), job, job, at.UTC())
+	err := row.Scan(&q.Job, &q.Engine, &q.Pair, &seq, &q.InputAsset, &q.OutputAsset, &q.Amount, &q.Consumed, &q.Matched, &q.RecordedAt)
+	if err == sql.ErrNoRows {
+		return nil, errors.Wrapf(err, "[storage] no quote of [%v] %v for %v %v as of %v", amount, inputAsset, engine, pair, at.UTC())
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "[storage] failed to query quote")
+	}
+	q.Sequence = order.Sequence(seq)
+	return &q, nil
+}
+
+// sequenceValue converts book sequence into integer for indexing,
+// sequence beyond BIGINT can not be stored.
+func sequenceValue(seq order.Sequence) (int64, error) {
+	if uint64(seq) > math.MaxInt64 {
+		return 0, errors.Wrap(fmt.Errorf("sequence [%v] overflows BIGINT", seq), "[storage] malformed sequence")
+	}
+	return int64(seq), nil
+}
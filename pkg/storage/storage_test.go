@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/choestelus/super-duper-succotash/pkg/order"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRebind(t *testing.T) {
+	r := require.New(t)
+	pg := Store{driver: DriverPostgres}
+	r.Equal("SELECT $1, $2", pg.rebind("SELECT ?, ?"))
+	lite := Store{driver: DriverSQLite}
+	r.Equal("SELECT ?, ?", lite.rebind("SELECT ?, ?"))
+}
+
+func TestBatchWriterAndQuoteAsOf(t *testing.T) {
+	r := require.New(t)
+
+	store, err := Open(DriverSQLite, ":memory:")
+	r.NoError(err)
+	defer store.Close()
+	r.NoError(store.Migrate())
+	// migration must be idempotent
+	r.NoError(store.Migrate())
+
+	t0 := time.Date(2019, 10, 17, 0, 0, 0, 0, time.UTC)
+	book := order.Book{
+		Sequence: 7371656227,
+		Bids: []order.Order{
+			{Price: decimal.RequireFromString("170.95"), Size: decimal.RequireFromString("0.34084807"), NumOrders: 1},
+			{Price: decimal.RequireFromString("170.90"), Size: decimal.RequireFromString("1"), NumOrders: 2},
+		},
+		Asks: []order.Order{
+			{Price: decimal.RequireFromString("170.97"), Size: decimal.RequireFromString("7.64562173"), NumOrders: 3},
+		},
+		UpdatedAt: t0,
+	}
+
+	w := NewBatchWriter(store, 1, 3, 0, nil)
+	r.NoError(w.WriteBook("coinbase_pro", "ETH-USD", book))
+	for i, matched := range []string{"1", "2"} {
+		r.NoError(w.WriteQuote(Quote{
+			Job:         "eth",
+			Engine:      "coinbase_pro",
+			Pair:        "ETH-USD",
+			Sequence:    7371656227,
+			InputAsset:  "eth",
+			OutputAsset: "usd",
+			Amount:      decimal.RequireFromString("1"),
+			Consumed:    decimal.RequireFromString("1"),
+			Matched:     decimal.RequireFromString(matched),
+			RecordedAt:  t0.Add(time.Duration(i) * time.Minute),
+		}))
+	}
+
+	// batch size is reached, everything should already be written
+	levels := 0
+	r.NoError(store.db.QueryRow(`SELECT COUNT(*) FROM book_levels`).Scan(&levels))
+	r.Equal(2, levels)
+
+	one := decimal.RequireFromString("1")
+	q, err := store.QuoteAsOf("coinbase_pro", "ETH-USD", "eth", one, "", t0.Add(30*time.Second))
+	r.NoError(err)
+	r.Equal(order.Sequence(7371656227), q.Sequence)
+	r.Equal("eth", q.Job)
+	r.True(decimal.RequireFromString("1").Equals(q.Matched))
+
+	q, err = store.QuoteAsOf("coinbase_pro", "ETH-USD", "eth", one, "eth", t0.Add(time.Hour))
+	r.NoError(err)
+	r.True(decimal.RequireFromString("2").Equals(q.Matched))
+
+	_, err = store.QuoteAsOf("coinbase_pro", "ETH-USD", "eth", one, "", t0.Add(-time.Hour))
+	r.Error(err)
+
+	// quotes of other amounts and jobs recorded later are not returned
+	for _, other := range []Quote{
+		{Job: "eth", Amount: decimal.RequireFromString("10"), Matched: decimal.RequireFromString("3")},
+		{Job: "eth-ladder", Amount: one, Matched: decimal.RequireFromString("4")},
+	} {
+		other.Engine, other.Pair, other.InputAsset, other.OutputAsset = "coinbase_pro", "ETH-USD", "eth", "usd"
+		other.RecordedAt = t0.Add(2 * time.Minute)
+		r.NoError(w.WriteQuote(other))
+	}
+	r.NoError(w.Flush())
+
+	q, err = store.QuoteAsOf("coinbase_pro", "ETH-USD", "eth", decimal.RequireFromString("1.0"), "eth", t0.Add(time.Hour))
+	r.NoError(err)
+	r.True(decimal.RequireFromString("2").Equals(q.Matched), "amount is compared by value")
+	q, err = store.QuoteAsOf("coinbase_pro", "ETH-USD", "eth", decimal.RequireFromString("10"), "", t0.Add(time.Hour))
+	r.NoError(err)
+	r.True(decimal.RequireFromString("3").Equals(q.Matched))
+	q, err = store.QuoteAsOf("coinbase_pro", "ETH-USD", "eth", one, "", t0.Add(time.Hour))
+	r.NoError(err)
+	r.Equal("eth-ladder", q.Job, "latest quote of any job")
+	_, err = store.QuoteAsOf("coinbase_pro", "ETH-USD", "eth", decimal.RequireFromString("5"), "", t0.Add(time.Hour))
+	r.Error(err)
+
+	// sequence beyond BIGINT is rejected instead of wrapping around
+	r.NoError(w.WriteQuote(Quote{Engine: "coinbase_pro", Pair: "ETH-USD", Sequence: math.MaxUint64, RecordedAt: t0}))
+	r.Error(w.Flush())
+}
+
+func TestBatchWriterFlushIntervalAndClose(t *testing.T) {
+	r := require.New(t)
+	dir, err := ioutil.TempDir("", "succotash")
+	r.NoError(err)
+	defer os.RemoveAll(dir)
+	dsn := filepath.Join(dir, "history.db")
+
+	store, err := Open(DriverSQLite, dsn)
+	r.NoError(err)
+	r.NoError(store.Migrate())
+	count := func(store *Store) int {
+		n := 0
+		r.NoError(store.db.QueryRow(`SELECT COUNT(*) FROM quotes`).Scan(&n))
+		return n
+	}
+	quote := Quote{Engine: "coinbase_pro", Pair: "ETH-USD", InputAsset: "eth", OutputAsset: "usd", RecordedAt: time.Now()}
+
+	w := NewBatchWriter(store, 1, 100, 50*time.Millisecond, func(err error) { t.Error(err) })
+	r.NoError(w.WriteQuote(quote))
+	r.Zero(count(store), "batch is not full")
+	r.Eventually(func() bool { return count(store) == 1 }, time.Second, 10*time.Millisecond, "buffer is flushed in background while idle")
+
+	r.NoError(w.WriteQuote(quote))
+	r.NoError(w.Close())
+	r.Error(store.db.Ping(), "store is closed")
+
+	store, err = Open(DriverSQLite, dsn)
+	r.NoError(err)
+	defer store.Close()
+	r.Equal(2, count(store), "buffer is written on close")
+}
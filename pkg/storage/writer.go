@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/choestelus/super-duper-succotash/pkg/order"
+)
+
+// bookSnapshot is book waiting in buffer to be written
+type bookSnapshot struct {
+	engine string
+	pair   string
+	book   order.Book
+}
+
+// BatchWriter buffers book snapshots and quotes, then writes them in single
+// transaction when buffer is full or flush interval is passed, even when nothing is written afterward.
+// Only top Depth levels of each side are written.
+type BatchWriter struct {
+	store     *Store
+	Depth     int
+	BatchSize int
+	// FlushInterval is supplied to NewBatchWriter, since background flush is started by it
+	FlushInterval time.Duration
+
+	mu        sync.Mutex
+	books     []bookSnapshot
+	quotes    []Quote
+	lastFlush time.Time
+	stop      chan struct{}
+	stopped   chan struct{}
+}
+
+// NewBatchWriter returns writer with supplied depth and batch size,
+// buffer is also flushed in background every flushInterval when it is positive,
+// and failure of background flush is passed to onError when supplied
+func NewBatchWriter(store *Store, depth, batchSize int, flushInterval time.Duration, onError func(error)) *BatchWriter {
+	w := &BatchWriter{
+		store:         store,
+		Depth:         depth,
+		BatchSize:     batchSize,
+		FlushInterval: flushInterval,
+		lastFlush:     time.Now(),
+		stop:          make(chan struct{}),
+		stopped:       make(chan struct{}),
+	}
+	go w.flushEvery(flushInterval, onError)
+	return w
+}
+
+// flushEvery flushes buffer when flush interval is passed until writer is closed,
+// buffer kept by failed flush is retried on next tick
+func (w *BatchWriter) flushEvery(interval time.Duration, onError func(error)) {
+	defer close(w.stopped)
+	if interval <= 0 {
+		<-w.stop
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			if err := w.flushIfDue(); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// WriteBook adds top levels of book to buffer
+func (w *BatchWriter) WriteBook(engine, pair string, book order.Book) error {
+	w.mu.Lock()
+	w.books = append(w.books, bookSnapshot{engine: engine, pair: pair, book: book})
+	w.mu.Unlock()
+	return w.flushIfDue()
+}
+
+// WriteQuote adds quote to buffer
+func (w *BatchWriter) WriteQuote(q Quote) error {
+	w.mu.Lock()
+	w.quotes = append(w.quotes, q)
+	w.mu.Unlock()
+	return w.flushIfDue()
+}
+
+// Close stops background flush, flushes buffered records and closes store,
+// store is closed even when flush is failed
+func (w *BatchWriter) Close() error {
+	close(w.stop)
+	<-w.stopped
+	flushErr := w.Flush()
+	return errors.Combine(flushErr, w.store.Close())
+}
+
+func (w *BatchWriter) flushIfDue() error {
+	w.mu.Lock()
+	pending := len(w.books) + len(w.quotes)
+	due := pending >= w.BatchSize ||
+		(w.FlushInterval > 0 && time.Since(w.lastFlush) >= w.FlushInterval)
+	w.mu.Unlock()
+	if !due {
+		return nil
+	}
+	return w.Flush()
+}
+
+// Flush writes all buffered records, buffer is kept when write is failed
+// so it can be retried on next flush
+func (w *BatchWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.books) == 0 && len(w.quotes) == 0 {
+		w.lastFlush = time.Now()
+		return nil
+	}
+
+	tx, err := w.store.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "[storage] failed to begin batch")
+	}
+
+	levelStmt, err := tx.Prepare(w.store.rebind(`INSERT INTO book_levels
+		(engine, pair, sequence, side, level, price, size, num_orders, order_id, recorded_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`))
+	if err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "[storage] failed to prepare book level statement")
+	}
+	defer levelStmt.Close()
+
+	quoteStmt, err := tx.Prepare(w.store.rebind(`INSERT INTO quotes
+		(job, engine, pair, sequence, input_asset, output_asset, amount, consumed, matched, recorded_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`))
+	if err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "[storage] failed to prepare quote statement")
+	}
+	defer quoteStmt.Close()
+
+	// decimals are bound as string since drivers are not required to
+	// support decimal.Decimal passed through database/sql as-is
+	for _, snapshot := range w.books {
+		seq, err := sequenceValue(snapshot.book.Sequence)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		sides := map[string][]order.Order{"bid": snapshot.book.Bids, "ask": snapshot.book.Asks}
+		for side, ods := range sides {
+			for level, od := range topN(ods, w.Depth) {
+				_, err := levelStmt.Exec(snapshot.engine, snapshot.pair, seq, side, level,
+					od.Price.String(), od.Size.String(), od.NumOrders, od.OrderID, snapshot.book.UpdatedAt.UTC())
+				if err != nil {
+					tx.Rollback()
+					return errors.Wrap(err, "[storage] failed to insert book level")
+				}
+			}
+		}
+	}
+
+	for _, q := range w.quotes {
+		seq, err := sequenceValue(q.Sequence)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		_, err = quoteStmt.Exec(q.Job, q.Engine, q.Pair, seq, q.InputAsset, q.OutputAsset,
+			q.Amount.String(), q.Consumed.String(), q.Matched.String(), q.RecordedAt.UTC())
+		if err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "[storage] failed to insert quote")
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "[storage] failed to commit batch")
+	}
+
+	w.books = w.books[:0]
+	w.quotes = w.quotes[:0]
+	w.lastFlush = time.Now()
+	return nil
+}
+
+// topN returns first n orders, or all orders when n is not positive
+func topN(ods []order.Order, n int) []order.Order {
+	if n <= 0 || len(ods) <= n {
+		return ods
+	}
+	return ods[:n]
+}
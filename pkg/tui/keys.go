@@ -0,0 +1,82 @@
+package tui
+
+import (
+	"bufio"
+	"io"
+)
+
+// Key is action of key press
+type Key int
+
+// supported actions, arrow keys and letters are mapped to the same action
+const (
+	Unknown Key = iota
+	NextPair
+	PrevPair
+	NextAmount
+	PrevAmount
+	Quit
+)
+
+// ReadKeys reads key presses from r until it is closed or errors,
+// terminal should be in raw mode so keys arrive without enter
+func ReadKeys(r io.Reader) <-chan Key {
+	keys := make(chan Key)
+	go func() {
+		defer close(keys)
+		reader := bufio.NewReader(r)
+		for {
+			key, err := readKey(reader)
+			if err != nil {
+				return
+			}
+			if key != Unknown {
+				keys <- key
+			}
+		}
+	}()
+	return keys
+}
+
+// readKey reads single key, arrow keys are escape sequences of ESC [ A-D
+func readKey(r *bufio.Reader) (Key, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return Unknown, err
+	}
+	switch c {
+	case 'n', '\t', 'l':
+		return NextPair, nil
+	case 'p', 'h':
+		return PrevPair, nil
+	case '+', '=', 'k':
+		return NextAmount, nil
+	case '-', 'j':
+		return PrevAmount, nil
+	case 'q', 3: // ctrl-c is not a signal in raw mode
+		return Quit, nil
+	case 0x1b:
+	default:
+		return Unknown, nil
+	}
+
+	if next, err := r.ReadByte(); err != nil || next != '[' {
+		return Unknown, err
+	}
+	arrow, err := r.ReadByte()
+	if err != nil {
+		return Unknown, err
+	}
+	switch arrow {
+	case 'A':
+		return NextAmount, nil
+	case 'B':
+		return PrevAmount, nil
+	case 'C':
+		return NextPair, nil
+	case 'D':
+		return PrevPair, nil
+	default:
+		return Unknown, nil
+	}
+}
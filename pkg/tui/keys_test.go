@@ -0,0 +1,17 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadKeys(t *testing.T) {
+	r := require.New(t)
+	keys := []Key{}
+	for key := range ReadKeys(strings.NewReader("nx\x1b[A\x1b[D\x1b[Z-p\tq\x03")) {
+		keys = append(keys, key)
+	}
+	r.Equal([]Key{NextPair, NextAmount, PrevPair, PrevAmount, PrevPair, NextPair, Quit, Quit}, keys)
+}
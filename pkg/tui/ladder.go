@@ -0,0 +1,232 @@
+package tui
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/choestelus/super-duper-succotash/pkg/order"
+	"github.com/shopspring/decimal"
+)
+
+// HideCursor and ShowCursor are ANSI escape sequences written around ladder screen
+const (
+	HideCursor = "\x1b[?25l"
+	ShowCursor = "\x1b[?25h"
+)
+
+// ANSI escape sequences used by renderer
+const (
+	clearScreen = "\x1b[H\x1b[2J"
+	reverse     = "\x1b[7m"
+	green       = "\x1b[32m"
+	red         = "\x1b[31m"
+	reset       = "\x1b[0m"
+)
+
+var bpsMultiplier = decimal.New(10000, 0)
+
+// Target is amount of input asset highlighted on ladder
+type Target struct {
+	InputAsset string
+	Amount     decimal.Decimal
+}
+
+// Pair holds latest book of pair and targets which can be switched between
+type Pair struct {
+	Name    string
+	Base    string
+	Quote   string
+	Targets []Target
+	Book    order.Book
+
+	target int
+}
+
+// Model is state of ladder screen, one pair and one of its targets is shown at a time
+type Model struct {
+	Pairs []*Pair
+	// Depth is number of levels shown on each side
+	Depth int
+	// BarWidth is width of cumulative size bar at the deepest level
+	BarWidth int
+	// Color enables ANSI colors and highlighting
+	Color bool
+
+	pair int
+}
+
+// NewModel returns model of pairs showing depth levels of each side
+func NewModel(pairs []*Pair, depth int) *Model {
+	return &Model{Pairs: pairs, Depth: depth, BarWidth: 30, Color: true}
+}
+
+// Update sets latest book of pair, and reports whether pair is currently shown
+func (m *Model) Update(name string, book order.Book) bool {
+	for i, p := range m.Pairs {
+		if p.Name == name {
+			p.Book = book
+			return i == m.pair
+		}
+	}
+	return false
+}
+
+// Key applies key press, and reports whether screen should be closed
+func (m *Model) Key(key Key) bool {
+	if len(m.Pairs) == 0 {
+		return key == Quit
+	}
+	p := m.Pairs[m.pair]
+	switch key {
+	case NextPair:
+		m.pair = (m.pair + 1) % len(m.Pairs)
+	case PrevPair:
+		m.pair = (m.pair + len(m.Pairs) - 1) % len(m.Pairs)
+	case NextAmount:
+		if len(p.Targets) > 0 {
+			p.target = (p.target + 1) % len(p.Targets)
+		}
+	case PrevAmount:
+		if len(p.Targets) > 0 {
+			p.target = (p.target + len(p.Targets) - 1) % len(p.Targets)
+		}
+	case Quit:
+		return true
+	}
+	return false
+}
+
+// Current returns shown pair
+func (m *Model) Current() *Pair {
+	if len(m.Pairs) == 0 {
+		return nil
+	}
+	return m.Pairs[m.pair]
+}
+
+// Render draws whole screen of current pair
+func (m *Model) Render(w io.Writer) error {
+	var b strings.Builder
+	if m.Color {
+		b.WriteString(clearScreen)
+	}
+	p := m.Current()
+	if p == nil {
+		b.WriteString("no pair to show\r\n")
+		_, err := io.WriteString(w, b.String())
+		return err
+	}
+	book := p.Book
+
+	target := Target{}
+	if len(p.Targets) > 0 {
+		target = p.Targets[p.target]
+	}
+	// selling base walks bids by size, buying with quote walks asks by volume
+	consumedBids, consumedAsks := 0, 0
+	action := "sell"
+	switch target.InputAsset {
+	case p.Base:
+		consumedBids = consumedLevels(book.Bids, target.Amount, false)
+	case p.Quote:
+		consumedAsks = consumedLevels(book.Asks, target.Amount, true)
+		action = "buy with"
+	}
+
+	bids, asks := top(book.Bids, m.Depth), top(book.Asks, m.Depth)
+	bidTotals, askTotals := cumulative(bids), cumulative(asks)
+	maxTotal := decimal.Zero
+	if len(bidTotals) > 0 {
+		maxTotal = bidTotals[len(bidTotals)-1]
+	}
+	if len(askTotals) > 0 && askTotals[len(askTotals)-1].GreaterThan(maxTotal) {
+		maxTotal = askTotals[len(askTotals)-1]
+	}
+
+	fmt.Fprintf(&b, "%v [%v/%v]  %v %v %v [%v/%v]  updated %v\r\n",
+		p.Name, m.pair+1, len(m.Pairs),
+		action, target.Amount, target.InputAsset, p.target+1, len(p.Targets),
+		book.UpdatedAt.UTC().Format(time.RFC3339Nano))
+	fmt.Fprintf(&b, "  %16v %16v %16v\r\n", "PRICE", "SIZE", "TOTAL")
+
+	// asks are drawn from the deepest level down to best ask
+	for i := len(asks) - 1; i >= 0; i-- {
+		m.row(&b, asks[i], askTotals[i], maxTotal, i < consumedAsks, red)
+	}
+	b.WriteString(m.summary(book))
+	for i := range bids {
+		m.row(&b, bids[i], bidTotals[i], maxTotal, i < consumedBids, green)
+	}
+	b.WriteString("[n/p ←/→] pair  [+/- ↑/↓] amount  [q] quit\r\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// row draws single level, consumed levels are marked and highlighted
+func (m *Model) row(b *strings.Builder, o order.Order, total, maxTotal decimal.Decimal, consumed bool, color string) {
+	marker := " "
+	if consumed {
+		marker = ">"
+	}
+	width := 0
+	if maxTotal.IsPositive() {
+		width = int(total.Mul(decimal.New(int64(m.BarWidth), 0)).Div(maxTotal).Ceil().IntPart())
+	}
+	line := fmt.Sprintf("%v %16v %16v %16v  %v", marker, o.Price.String(), o.Size.StringFixed(8), total.StringFixed(8), strings.Repeat("█", width))
+	if m.Color {
+		if consumed {
+			line = reverse + line
+		}
+		line = color + line + reset
+	}
+	b.WriteString(line + "\r\n")
+}
+
+// summary returns line of spread and mid price between asks and bids
+func (m *Model) summary(book order.Book) string {
+	mid, err := book.MidPrice()
+	if err != nil {
+		return "  ---- no spread ----\r\n"
+	}
+	spread := book.Asks[0].Price.Sub(book.Bids[0].Price)
+	return fmt.Sprintf("  ---- spread %v (%v bps)  mid %v ----\r\n",
+		spread.String(), spread.Div(mid).Mul(bpsMultiplier).StringFixed(2), mid.String())
+}
+
+func top(orders []order.Order, depth int) []order.Order {
+	if depth > 0 && len(orders) > depth {
+		return orders[:depth]
+	}
+	return orders
+}
+
+// cumulative returns running total size of orders
+func cumulative(orders []order.Order) []decimal.Decimal {
+	totals := make([]decimal.Decimal, len(orders))
+	total := decimal.Zero
+	for i, o := range orders {
+		total = total.Add(o.Size)
+		totals[i] = total
+	}
+	return totals
+}
+
+// consumedLevels returns number of levels amount reaches, amount is in quote
+// and compared against volume of levels when byVolume, otherwise against size
+func consumedLevels(orders []order.Order, amount decimal.Decimal, byVolume bool) int {
+	left := amount
+	for i, o := range orders {
+		if !left.IsPositive() {
+			return i
+		}
+		if byVolume {
+			left = left.Sub(o.Volume())
+			continue
+		}
+		left = left.Sub(o.Size)
+	}
+	return len(orders)
+}
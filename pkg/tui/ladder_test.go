@@ -0,0 +1,90 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/choestelus/super-duper-succotash/pkg/order"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+func d(s string) decimal.Decimal {
+	return decimal.RequireFromString(s)
+}
+
+var testBook = order.Book{
+	Bids: []order.Order{
+		{Price: d("170.95"), Size: d("3")},
+		{Price: d("170.90"), Size: d("5")},
+		{Price: d("170.80"), Size: d("2")},
+	},
+	Asks: []order.Order{
+		{Price: d("170.97"), Size: d("2")},
+		{Price: d("171.00"), Size: d("10")},
+	},
+	UpdatedAt: time.Date(2019, 10, 17, 0, 0, 0, 0, time.UTC),
+}
+
+func newTestModel() *Model {
+	m := NewModel([]*Pair{
+		{Name: "BTC-USD", Base: "btc", Quote: "usd", Targets: []Target{{InputAsset: "btc", Amount: d("4")}, {InputAsset: "usd", Amount: d("100")}}},
+		{Name: "ETH-USD", Base: "eth", Quote: "usd", Targets: []Target{{InputAsset: "eth", Amount: d("1")}}},
+	}, 2)
+	m.Color = false
+	return m
+}
+
+func render(t *testing.T, m *Model) []string {
+	var b strings.Builder
+	require.NoError(t, m.Render(&b))
+	return strings.Split(strings.TrimSuffix(b.String(), "\r\n"), "\r\n")
+}
+
+func TestModelRender(t *testing.T) {
+	r := require.New(t)
+	m := newTestModel()
+	r.True(m.Update("BTC-USD", testBook))
+
+	lines := render(t, m)
+	r.Len(lines, 8, strings.Join(lines, "\n"))
+	r.Equal("BTC-USD [1/2]  sell 4 btc [1/2]  updated 2019-10-17T00:00:00Z", lines[0])
+	// asks from deepest, bids from best, depth 2 of each side
+	r.Contains(lines[2], " 171 ")
+	r.Contains(lines[2], "12.00000000  "+strings.Repeat("█", 30))
+	r.Contains(lines[3], "170.97")
+	r.Equal("  ---- spread 0.02 (1.17 bps)  mid 170.96 ----", lines[4])
+	// selling 4 btc consumes 3 at 170.95 and 1 at 170.90
+	r.True(strings.HasPrefix(lines[5], ">"), lines[5])
+	r.True(strings.HasPrefix(lines[6], ">"), lines[6])
+	r.Contains(lines[6], "8.00000000  "+strings.Repeat("█", 20))
+	r.False(strings.HasPrefix(lines[3], ">"))
+
+	// buying with 100 usd consumes only best ask
+	r.False(m.Key(NextAmount))
+	lines = render(t, m)
+	r.Contains(lines[0], "buy with 100 usd [2/2]")
+	r.False(strings.HasPrefix(lines[2], ">"))
+	r.True(strings.HasPrefix(lines[3], ">"))
+	r.False(strings.HasPrefix(lines[5], ">"))
+}
+
+func TestModelKeys(t *testing.T) {
+	r := require.New(t)
+	m := newTestModel()
+
+	r.False(m.Key(NextPair))
+	r.Equal("ETH-USD", m.Current().Name)
+	r.False(m.Update("BTC-USD", testBook), "BTC-USD is not shown")
+	r.Contains(render(t, m)[0], "ETH-USD [2/2]")
+	r.Contains(render(t, m)[2], "no spread", "nothing received yet")
+
+	r.False(m.Key(NextPair))
+	r.Equal("BTC-USD", m.Current().Name)
+	r.False(m.Key(PrevAmount))
+	r.Equal("usd", m.Current().Targets[m.Current().target].InputAsset)
+	r.False(m.Key(PrevPair))
+	r.Equal("ETH-USD", m.Current().Name)
+	r.True(m.Key(Quit))
+}
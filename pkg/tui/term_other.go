@@ -0,0 +1,15 @@
+// +build !linux,!darwin
+
+package tui
+
+import (
+	"fmt"
+
+	"emperror.dev/errors"
+)
+
+// MakeRaw is not supported on this platform, caller falls back to line mode
+// where keys have to be followed by enter
+func MakeRaw(fd int) (func() error, error) {
+	return nil, errors.Wrap(fmt.Errorf("raw mode is not supported"), "[tui] unable to set terminal to raw mode")
+}
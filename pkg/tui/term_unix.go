@@ -0,0 +1,27 @@
+// +build linux darwin
+
+package tui
+
+import (
+	"emperror.dev/errors"
+	"golang.org/x/sys/unix"
+)
+
+// MakeRaw disables line buffering, echo and signal keys of terminal fd,
+// so every key press is read immediately. Returned function restores terminal.
+func MakeRaw(fd int) (func() error, error) {
+	termios, err := unix.IoctlGetTermios(fd, ioctlGetTermios)
+	if err != nil {
+		return nil, errors.Wrap(err, "[tui] stdin is not a terminal")
+	}
+	original := *termios
+	termios.Lflag &^= unix.ECHO | unix.ICANON | unix.ISIG
+	termios.Cc[unix.VMIN] = 1
+	termios.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(fd, ioctlSetTermios, termios); err != nil {
+		return nil, errors.Wrap(err, "[tui] unable to set terminal to raw mode")
+	}
+	return func() error {
+		return unix.IoctlSetTermios(fd, ioctlSetTermios, &original)
+	}, nil
+}